@@ -0,0 +1,345 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Credentials supplies the credentials used to answer authentication
+// challenges from a notary server. serverURL is the scheme and host of the
+// server, e.g. "https://notary.example.com".
+type Credentials interface {
+	// Basic returns the user name and password for the server. They are
+	// used for HTTP Basic Auth, and to request tokens from the token
+	// service a server delegates to.
+	Basic(serverURL string) (username, password string)
+	// Token returns a bearer token to present to the server as is, or ""
+	// if tokens should be requested from the server's token service.
+	Token(serverURL string) string
+}
+
+// StaticCredentials returns the same credentials for every server
+type StaticCredentials struct {
+	Username    string
+	Password    string
+	BearerToken string
+}
+
+// Basic implements Credentials
+func (c StaticCredentials) Basic(string) (string, string) {
+	return c.Username, c.Password
+}
+
+// Token implements Credentials
+func (c StaticCredentials) Token(string) string {
+	return c.BearerToken
+}
+
+// helperTokenUser is the user name a credential helper returns when the
+// secret is a token rather than a password
+const helperTokenUser = "<token>"
+
+type helperResponse struct {
+	Username string
+	Secret   string
+}
+
+// CredentialHelper gets credentials from an external program, using the
+// same protocol as docker credential helpers so they can be shared: the
+// program is run with the argument "get" and the server URL on stdin, and
+// prints a JSON object with "Username" and "Secret" fields. A Username of
+// "<token>" means Secret is a bearer token.
+type CredentialHelper struct {
+	Program string
+
+	lock  sync.Mutex
+	cache map[string]helperResponse
+}
+
+// NewCredentialHelper instantiates a CredentialHelper running program
+func NewCredentialHelper(program string) *CredentialHelper {
+	return &CredentialHelper{
+		Program: program,
+		cache:   make(map[string]helperResponse),
+	}
+}
+
+func (h *CredentialHelper) get(serverURL string) helperResponse {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if resp, ok := h.cache[serverURL]; ok {
+		return resp
+	}
+	resp := helperResponse{}
+	cmd := exec.Command(h.Program, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	out, err := cmd.Output()
+	if err != nil {
+		logrus.Errorf("credential helper %s failed for %s: %v", h.Program, serverURL, err)
+		return resp
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		logrus.Errorf("credential helper %s returned invalid output: %v", h.Program, err)
+		return helperResponse{}
+	}
+	// failures are not cached, so that the helper is asked again once the
+	// user has logged in
+	h.cache[serverURL] = resp
+	return resp
+}
+
+// Basic implements Credentials
+func (h *CredentialHelper) Basic(serverURL string) (string, string) {
+	resp := h.get(serverURL)
+	if resp.Username == helperTokenUser {
+		return "", ""
+	}
+	return resp.Username, resp.Secret
+}
+
+// Token implements Credentials
+func (h *CredentialHelper) Token(serverURL string) string {
+	resp := h.get(serverURL)
+	if resp.Username != helperTokenUser {
+		return ""
+	}
+	return resp.Secret
+}
+
+// authTransport is an http.RoundTripper that answers the WWW-Authenticate
+// challenges of a notary server. Basic challenges are answered with the
+// user name and password. Bearer challenges are answered with a static
+// token if there is one, otherwise a token is requested from the realm of
+// the challenge, as in the docker registry token flow. The Authorization
+// header that last succeeded for a host is sent preemptively on the
+// following requests, so normally only the first request is challenged.
+//
+// The user name and password are only sent to a realm on the server's own
+// host or on one of realmHosts, and only over https unless the server itself
+// is plain http, so that a server can't have them sent elsewhere.
+type authTransport struct {
+	rt         http.RoundTripper
+	creds      Credentials
+	realmHosts []string
+
+	lock    sync.Mutex
+	headers map[string]string
+}
+
+// NewAuthTransport wraps rt so that requests are authenticated with creds.
+// realmHosts are the hosts, other than the server's, of token services that
+// may be sent the user name and password to request a token.
+func NewAuthTransport(rt http.RoundTripper, creds Credentials, realmHosts ...string) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &authTransport{
+		rt:         rt,
+		creds:      creds,
+		realmHosts: realmHosts,
+		headers:    make(map[string]string),
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// buffer the body so the request can be retried after a challenge
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t.lock.Lock()
+	header := t.headers[req.URL.Host]
+	t.lock.Unlock()
+
+	resp, err := t.rt.RoundTrip(withAuthorization(req, header, body))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	header, err = t.answer(req, challenge)
+	if err != nil || header == "" {
+		if err != nil {
+			logrus.Debugf("unable to answer challenge %q: %v", challenge, err)
+		}
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	resp, err = t.rt.RoundTrip(withAuthorization(req, header, body))
+	if err == nil && resp.StatusCode != http.StatusUnauthorized {
+		t.lock.Lock()
+		t.headers[req.URL.Host] = header
+		t.lock.Unlock()
+	}
+	return resp, err
+}
+
+// withAuthorization returns a copy of req with the Authorization header
+// set and a fresh reader over body
+func withAuthorization(req *http.Request, header string, body []byte) *http.Request {
+	r := *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	if header != "" {
+		r.Header.Set("Authorization", header)
+	}
+	if body != nil {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	return &r
+}
+
+// answer returns the Authorization header that answers a challenge, or ""
+// if there are no credentials for it
+func (t *authTransport) answer(req *http.Request, challenge string) (string, error) {
+	serverURL := req.URL.Scheme + "://" + req.URL.Host
+	scheme, params := parseChallenge(challenge)
+	switch scheme {
+	case "basic":
+		username, password := t.creds.Basic(serverURL)
+		if username == "" {
+			return "", nil
+		}
+		r := &http.Request{Header: make(http.Header)}
+		r.SetBasicAuth(username, password)
+		return r.Header.Get("Authorization"), nil
+	case "bearer":
+		if token := t.creds.Token(serverURL); token != "" {
+			return "Bearer " + token, nil
+		}
+		token, err := t.fetchToken(req.URL, params)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	}
+	return "", fmt.Errorf("unsupported authentication scheme %q", scheme)
+}
+
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+}
+
+// fetchToken requests a token from the realm of a bearer challenge from
+// server
+func (t *authTransport) fetchToken(server *url.URL, params map[string]string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Scheme == "" {
+		return "", fmt.Errorf("bearer challenge has no valid realm")
+	}
+	if realm.Scheme != "https" && !(realm.Scheme == "http" && server.Scheme == "http") {
+		return "", fmt.Errorf("refusing to request a token from %s over %s", realm.Host, realm.Scheme)
+	}
+	query := realm.Query()
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	if scope, ok := params["scope"]; ok {
+		query.Set("scope", scope)
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("GET", realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if t.mayAuthenticate(server, realm) {
+		if username, password := t.creds.Basic(server.Scheme + "://" + server.Host); username != "" {
+			req.SetBasicAuth(username, password)
+		}
+	} else {
+		logrus.Debugf("requesting an anonymous token from %s, which is not the server's host or a configured realm host", realm.Host)
+	}
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token service returned %s", resp.Status)
+	}
+	tr := tokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", err
+	}
+	if tr.Token != "" {
+		return tr.Token, nil
+	}
+	if tr.AccessToken != "" {
+		return tr.AccessToken, nil
+	}
+	return "", fmt.Errorf("token service did not return a token")
+}
+
+// mayAuthenticate reports whether the credentials for server may be sent to
+// realm
+func (t *authTransport) mayAuthenticate(server, realm *url.URL) bool {
+	if strings.EqualFold(realm.Host, server.Host) {
+		return true
+	}
+	for _, host := range t.realmHosts {
+		if strings.EqualFold(realm.Host, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseChallenge splits a WWW-Authenticate header into its lower cased
+// scheme and parameters
+func parseChallenge(header string) (string, map[string]string) {
+	params := make(map[string]string)
+	parts := strings.SplitN(strings.TrimSpace(header), " ", 2)
+	scheme := strings.ToLower(parts[0])
+	if len(parts) < 2 {
+		return scheme, params
+	}
+	rest := parts[1]
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.Index(rest, ",")
+			if end < 0 {
+				value, rest = rest, ""
+			} else {
+				value, rest = rest[:end], rest[end:]
+			}
+		}
+		params[key] = value
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return scheme, params
+}
@@ -0,0 +1,197 @@
+package client
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.example.com/token",service="notary",scope="repository:a/b:pull,push"`)
+	assert.Equal(t, "bearer", scheme)
+	assert.Equal(t, "https://auth.example.com/token", params["realm"])
+	assert.Equal(t, "notary", params["service"])
+	assert.Equal(t, "repository:a/b:pull,push", params["scope"])
+
+	scheme, params = parseChallenge(`Basic realm=notary`)
+	assert.Equal(t, "basic", scheme)
+	assert.Equal(t, "notary", params["realm"])
+}
+
+func TestAuthTransportBasic(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "alice" || pass != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="notary"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: NewAuthTransport(nil, StaticCredentials{Username: "alice", Password: "secret"})}
+	resp, err := client.Post(ts.URL, "text/plain", strings.NewReader("body"))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, requests)
+
+	// the header is remembered, so the next request isn't challenged
+	resp, err = client.Get(ts.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, requests)
+}
+
+func TestAuthTransportTokenFlow(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _, _ := r.BasicAuth()
+		assert.Equal(t, "alice", user)
+		assert.Equal(t, "notary", r.URL.Query().Get("service"))
+		assert.Equal(t, "repository:gun:pull", r.URL.Query().Get("scope"))
+		json.NewEncoder(w).Encode(tokenResponse{Token: "issued"})
+	}))
+	defer tokenServer.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer issued" {
+			w.Header().Set("WWW-Authenticate",
+				`Bearer realm="`+tokenServer.URL+`",service="notary",scope="repository:gun:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	// the token service is on another port, so is a different host
+	realm, err := url.Parse(tokenServer.URL)
+	assert.NoError(t, err)
+	client := &http.Client{Transport: NewAuthTransport(nil, StaticCredentials{Username: "alice", Password: "secret"}, realm.Host)}
+	resp, err := client.Get(ts.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestAuthTransportTokenRealmOnOtherHost(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, ok := r.BasicAuth()
+		assert.False(t, ok, "credentials were sent to a realm that wasn't configured")
+		json.NewEncoder(w).Encode(tokenResponse{Token: "anonymous"})
+	}))
+	defer tokenServer.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer anonymous" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+tokenServer.URL+`"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: NewAuthTransport(nil, StaticCredentials{Username: "alice", Password: "secret"})}
+	resp, err := client.Get(ts.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestAuthTransportInsecureTokenRealm(t *testing.T) {
+	tokenRequests := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		json.NewEncoder(w).Encode(tokenResponse{Token: "issued"})
+	}))
+	defer tokenServer.Close()
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+tokenServer.URL+`"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	realm, err := url.Parse(tokenServer.URL)
+	assert.NoError(t, err)
+	rt := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	client := &http.Client{Transport: NewAuthTransport(rt, StaticCredentials{Username: "alice", Password: "secret"}, realm.Host)}
+	resp, err := client.Get(ts.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, 0, tokenRequests, "a token was requested over http for an https server")
+}
+
+func TestCredentialHelperCachesSuccessOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notary-helper")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the helper fails until the user has logged in, creating the file
+	loggedIn := filepath.Join(dir, "logged-in")
+	helper := filepath.Join(dir, "helper")
+	script := "#!/bin/sh\n[ -f " + loggedIn + " ] || exit 1\n" +
+		`echo '{"Username": "alice", "Secret": "secret"}'` + "\n"
+	assert.NoError(t, ioutil.WriteFile(helper, []byte(script), 0755))
+
+	h := NewCredentialHelper(helper)
+	username, _ := h.Basic("https://notary.example.com")
+	assert.Equal(t, "", username)
+
+	assert.NoError(t, ioutil.WriteFile(loggedIn, nil, 0644))
+	username, password := h.Basic("https://notary.example.com")
+	assert.Equal(t, "alice", username)
+	assert.Equal(t, "secret", password)
+
+	// successes are cached
+	assert.NoError(t, os.Remove(loggedIn))
+	username, _ = h.Basic("https://notary.example.com")
+	assert.Equal(t, "alice", username)
+}
+
+func TestAuthTransportStaticToken(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer static" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="notary"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: NewAuthTransport(nil, StaticCredentials{BearerToken: "static"})}
+	resp, err := client.Get(ts.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestAuthTransportNoCredentials(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="notary"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: NewAuthTransport(nil, StaticCredentials{})}
+	resp, err := client.Get(ts.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
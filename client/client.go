@@ -23,6 +23,7 @@ import (
 	"github.com/endophage/gotuf/keys"
 	"github.com/endophage/gotuf/signed"
 	"github.com/endophage/gotuf/store"
+	"golang.org/x/net/context"
 )
 
 const maxSize = 5 << 20
@@ -53,13 +54,18 @@ type ErrExpired struct {
 }
 
 const (
-	tufDir = "tuf"
+	tufDir       = "tuf"
+	httpCacheDir = "cache"
 )
 
 // ErrRepositoryNotExist gets returned when trying to make an action over a repository
 /// that doesn't exist.
 var ErrRepositoryNotExist = errors.New("repository does not exist")
 
+// ErrNeedsStores is returned when a repository kept in memory is not given
+// its metadata and key stores
+var ErrNeedsStores = errors.New("a repository kept in memory needs metadata and key stores")
+
 // NotaryRepository stores all the information needed to operate on a notary
 // repository.
 type NotaryRepository struct {
@@ -72,6 +78,19 @@ type NotaryRepository struct {
 	tufRepo         *tuf.TufRepo
 	roundTrip       http.RoundTripper
 	KeyStoreManager *keystoremanager.KeyStoreManager
+	// inMemory is set if nothing about the repository is kept under
+	// baseDir, in which case changelist holds the pending changes
+	inMemory   bool
+	changelist changelist.Changelist
+	// stateStore keeps the trusted versions if they are not kept in the
+	// state file beside the metadata cache
+	stateStore store.MetadataStore
+	// cacheOnDisk is set if fileStore is the metadata cache under baseDir
+	cacheOnDisk bool
+	// Offline makes the repository read trust data only from its local
+	// cache, verifying it without contacting the server. Operations that
+	// need the server return ErrOffline.
+	Offline bool
 }
 
 // Target represents a simplified version of the data TUF operates on, so external
@@ -99,27 +118,54 @@ func NewTarget(targetName string, targetPath string) (*Target, error) {
 
 // NewNotaryRepository is a helper method that returns a new notary repository.
 // It takes the base directory under where all the trust files will be stored
-// (usually ~/.docker/trust/).
+// (usually ~/.docker/trust/). Options can keep the trust files elsewhere, in
+// which case baseDir is not used for them.
 func NewNotaryRepository(baseDir, gun, baseURL string, rt http.RoundTripper,
-	passphraseRetriever passphrase.Retriever) (*NotaryRepository, error) {
+	passphraseRetriever passphrase.Retriever, options ...RepositoryOption) (*NotaryRepository, error) {
 
-	keyStoreManager, err := keystoremanager.NewKeyStoreManager(baseDir, passphraseRetriever)
-	if err != nil {
-		return nil, err
+	var opts repositoryOptions
+	for _, option := range options {
+		option(&opts)
+	}
+	if opts.inMemory && (opts.metadataStore == nil || opts.keyStoreManager == nil) {
+		return nil, ErrNeedsStores
+	}
+
+	keyStoreManager := opts.keyStoreManager
+	if keyStoreManager == nil {
+		var err error
+		keyStoreManager, err = keystoremanager.NewKeyStoreManager(baseDir, passphraseRetriever)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	cryptoService := cryptoservice.NewCryptoService(gun, keyStoreManager.NonRootKeyStore())
 
+	tufRepoPath := filepath.Join(baseDir, tufDir, filepath.FromSlash(gun))
 	nRepo := &NotaryRepository{
 		gun:             gun,
 		baseDir:         baseDir,
 		baseURL:         baseURL,
-		tufRepoPath:     filepath.Join(baseDir, tufDir, filepath.FromSlash(gun)),
+		tufRepoPath:     tufRepoPath,
 		cryptoService:   cryptoService,
 		roundTrip:       rt,
 		KeyStoreManager: keyStoreManager,
 	}
 
+	nRepo.stateStore = opts.stateStore
+	if opts.inMemory {
+		nRepo.inMemory = true
+		nRepo.changelist = changelist.NewMemChangelist()
+		if nRepo.stateStore == nil {
+			nRepo.stateStore = store.NewMemoryStore(nil, nil)
+		}
+	}
+	if opts.metadataStore != nil {
+		nRepo.fileStore = opts.metadataStore
+		return nRepo, nil
+	}
+
 	fileStore, err := store.NewFilesystemStore(
 		nRepo.tufRepoPath,
 		"metadata",
@@ -130,13 +176,47 @@ func NewNotaryRepository(baseDir, gun, baseURL string, rt http.RoundTripper,
 		return nil, err
 	}
 	nRepo.fileStore = fileStore
+	nRepo.cacheOnDisk = true
 
 	return nRepo, nil
 }
 
+// transport returns the RoundTripper for requests made to the server on
+// behalf of ctx
+func (r *NotaryRepository) transport(ctx context.Context) http.RoundTripper {
+	rt := newUpdateErrorTransport(newContextTransport(ctx, r.roundTrip))
+	if r.inMemory {
+		return rt
+	}
+	return newConditionalTransport(rt, filepath.Join(r.tufRepoPath, httpCacheDir))
+}
+
+// getChangelist returns the changelist of the repository
+func (r *NotaryRepository) getChangelist() (changelist.Changelist, error) {
+	if r.inMemory {
+		return r.changelist, nil
+	}
+	return changelist.NewFileChangelist(r.changelistDir())
+}
+
+// changelistDir is where the changelist is kept unless the repository is
+// in memory
+func (r *NotaryRepository) changelistDir() string {
+	return filepath.Join(r.tufRepoPath, "changelist")
+}
+
 // Initialize creates a new repository by using rootKey as the root Key for the
 // TUF repository.
 func (r *NotaryRepository) Initialize(uCryptoService *cryptoservice.UnlockedCryptoService) error {
+	return r.InitializeContext(context.Background(), uCryptoService)
+}
+
+// InitializeContext is Initialize, failing with ctx.Err() if ctx is done
+// before the server has been contacted
+func (r *NotaryRepository) InitializeContext(ctx context.Context, uCryptoService *cryptoservice.UnlockedCryptoService) error {
+	if r.Offline {
+		return ErrOffline
+	}
 	rootCert, err := uCryptoService.GenerateCertificate(r.gun)
 	if err != nil {
 		return err
@@ -166,18 +246,21 @@ func (r *NotaryRepository) Initialize(uCryptoService *cryptoservice.UnlockedCryp
 	// is associated with. This is used to be able to retrieve the root private key
 	// associated with a particular certificate
 	logrus.Debugf("Linking %s to %s.", rootKey.ID(), uCryptoService.ID())
-	err = r.KeyStoreManager.RootKeyStore().Link(uCryptoService.ID()+"_root", rootKey.ID()+"_root")
+	err = r.KeyStoreManager.LinkRootKey(uCryptoService.ID(), rootKey.ID())
 	if err != nil {
 		return err
 	}
 
 	// All the timestamp keys are generated by the remote server.
-	remote, err := getRemoteStore(r.baseURL, r.gun, r.roundTrip)
+	remote, err := getRemoteStore(r.baseURL, r.gun, r.transport(ctx))
 	if err != nil {
 		return err
 	}
 	rawTSKey, err := remote.GetKey("timestamp")
 	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		return err
 	}
 
@@ -241,7 +324,7 @@ func (r *NotaryRepository) Initialize(uCryptoService *cryptoservice.UnlockedCryp
 
 // AddTarget adds a new target to the repository, forcing a timestamps check from TUF
 func (r *NotaryRepository) AddTarget(target *Target) error {
-	cl, err := changelist.NewFileChangelist(filepath.Join(r.tufRepoPath, "changelist"))
+	cl, err := r.getChangelist()
 	if err != nil {
 		return err
 	}
@@ -264,7 +347,7 @@ func (r *NotaryRepository) AddTarget(target *Target) error {
 // RemoveTarget creates a new changelist entry to remove a target from the repository
 // when the changelist gets applied at publish time
 func (r *NotaryRepository) RemoveTarget(targetName string) error {
-	cl, err := changelist.NewFileChangelist(filepath.Join(r.tufRepoPath, "changelist"))
+	cl, err := r.getChangelist()
 	if err != nil {
 		return err
 	}
@@ -279,16 +362,13 @@ func (r *NotaryRepository) RemoveTarget(targetName string) error {
 
 // ListTargets lists all targets for the current repository
 func (r *NotaryRepository) ListTargets() ([]*Target, error) {
-	c, err := r.bootstrapClient()
-	if err != nil {
-		return nil, err
-	}
+	return r.ListTargetsContext(context.Background())
+}
 
-	err = c.Update()
-	if err != nil {
-		if err, ok := err.(signed.ErrExpired); ok {
-			return nil, ErrExpired{err}
-		}
+// ListTargetsContext is ListTargets, failing with ctx.Err() if ctx is done
+// before the trust data has been fetched
+func (r *NotaryRepository) ListTargetsContext(ctx context.Context) ([]*Target, error) {
+	if _, err := r.update(ctx); err != nil {
 		return nil, err
 	}
 
@@ -303,20 +383,21 @@ func (r *NotaryRepository) ListTargets() ([]*Target, error) {
 
 // GetTargetByName returns a target given a name
 func (r *NotaryRepository) GetTargetByName(name string) (*Target, error) {
-	c, err := r.bootstrapClient()
-	if err != nil {
-		return nil, err
-	}
+	return r.GetTargetByNameContext(context.Background(), name)
+}
 
-	err = c.Update()
+// GetTargetByNameContext is GetTargetByName, failing with ctx.Err() if ctx
+// is done before the trust data has been fetched
+func (r *NotaryRepository) GetTargetByNameContext(ctx context.Context, name string) (*Target, error) {
+	c, err := r.update(ctx)
 	if err != nil {
-		if err, ok := err.(signed.ErrExpired); ok {
-			return nil, ErrExpired{err}
-		}
 		return nil, err
 	}
 
 	meta, err := c.TargetMeta(name)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 	if meta == nil {
 		return nil, fmt.Errorf("No trust data for %s", name)
 	} else if err != nil {
@@ -329,10 +410,21 @@ func (r *NotaryRepository) GetTargetByName(name string) (*Target, error) {
 // Publish pushes the local changes in signed material to the remote notary-server
 // Conceptually it performs an operation similar to a `git rebase`
 func (r *NotaryRepository) Publish() error {
+	return r.PublishContext(context.Background())
+}
+
+// PublishContext is Publish, failing with ctx.Err() if ctx is done before
+// the changes have been published. If ctx ends while the changes are being
+// uploaded, the server may still apply them; the changelist is kept either
+// way, so publishing again is safe.
+func (r *NotaryRepository) PublishContext(ctx context.Context) error {
+	if r.Offline {
+		return ErrOffline
+	}
 	var updateRoot bool
 	var root *data.Signed
 	// attempt to initialize the repo from the remote store
-	c, err := r.bootstrapClient()
+	c, err := r.bootstrapClient(ctx)
 	if err != nil {
 		if _, ok := err.(store.ErrMetaNotFound); ok {
 			// if the remote store return a 404 (translated into ErrMetaNotFound),
@@ -365,15 +457,20 @@ func (r *NotaryRepository) Publish() error {
 		// applying the changelist.
 		err = c.Update()
 		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			if err, ok := err.(signed.ErrExpired); ok {
-				return ErrExpired{err}
+				return freezeError(err)
 			}
 			return err
 		}
+		if err := r.checkState(); err != nil {
+			return err
+		}
 	}
 	// load the changelist for this repo
-	changelistDir := filepath.Join(r.tufRepoPath, "changelist")
-	cl, err := changelist.NewFileChangelist(changelistDir)
+	cl, err := r.getChangelist()
 	if err != nil {
 		logrus.Debug("Error initializing changelist")
 		return err
@@ -411,7 +508,7 @@ func (r *NotaryRepository) Publish() error {
 		return err
 	}
 
-	remote, err := getRemoteStore(r.baseURL, r.gun, r.roundTrip)
+	remote, err := getRemoteStore(r.baseURL, r.gun, r.transport(ctx))
 	if err != nil {
 		return err
 	}
@@ -438,6 +535,9 @@ func (r *NotaryRepository) Publish() error {
 	update["snapshot"] = snapshotJSON
 	err = remote.SetMultiMeta(update)
 	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		return err
 	}
 	err = cl.Clear("")
@@ -445,7 +545,11 @@ func (r *NotaryRepository) Publish() error {
 		// This is not a critical problem when only a single host is pushing
 		// but will cause weird behaviour if changelist cleanup is failing
 		// and there are multiple hosts writing to the repo.
-		logrus.Warn("Unable to clear changelist. You may want to manually delete the folder ", changelistDir)
+		if r.inMemory {
+			logrus.Warn("Unable to clear changelist: ", err)
+		} else {
+			logrus.Warn("Unable to clear changelist. You may want to manually delete the folder ", r.changelistDir())
+		}
 	}
 	return nil
 }
@@ -541,12 +645,58 @@ func (r *NotaryRepository) saveMetadata(rootCryptoService signed.CryptoService)
 	return r.fileStore.SetMeta("snapshot", snapshotJSON)
 }
 
-func (r *NotaryRepository) bootstrapClient() (*tufclient.Client, error) {
-	var rootJSON []byte
-	remote, err := getRemoteStore(r.baseURL, r.gun, r.roundTrip)
-	if err == nil {
-		// if remote store successfully set up, try and get root from remote
-		rootJSON, err = remote.GetMeta("root", maxSize)
+// update bootstraps the TUF client and brings the repository up to date,
+// from the cache alone in offline mode
+func (r *NotaryRepository) update(ctx context.Context) (*tufclient.Client, error) {
+	c, err := r.bootstrapClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.Update()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if r.Offline && err == ErrOffline {
+			// some metadata was missing from the cache, or did not verify
+			return nil, r.offlineError()
+		}
+		if err, ok := err.(signed.ErrExpired); ok {
+			if r.Offline {
+				return nil, ErrExpired{err}
+			}
+			return nil, freezeError(err)
+		}
+		return nil, err
+	}
+	if err := r.checkState(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (r *NotaryRepository) bootstrapClient(ctx context.Context) (*tufclient.Client, error) {
+	var (
+		rootJSON []byte
+		remote   store.RemoteStore
+		err      error
+	)
+	if r.Offline {
+		remote = offlineStore{}
+		rootJSON, err = r.fileStore.GetMeta("root", maxSize)
+		if err != nil || len(rootJSON) == 0 {
+			return nil, ErrNotCached{gun: r.gun}
+		}
+	} else {
+		remote, err = getRemoteStore(r.baseURL, r.gun, r.transport(ctx))
+		if err == nil {
+			// if remote store successfully set up, try and get root from remote
+			rootJSON, err = remote.GetMeta("root", maxSize)
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 	}
 
 	// if remote store couldn't be setup, or we failed to get a root from it
@@ -558,7 +708,7 @@ func (r *NotaryRepository) bootstrapClient() (*tufclient.Client, error) {
 			return nil, err
 		}
 		rootJSON, err = r.fileStore.GetMeta("root", maxSize)
-		if err != nil {
+		if err != nil || len(rootJSON) == 0 {
 			// if cache didn't return a root, we cannot proceed
 			return nil, store.ErrMetaNotFound{}
 		}
@@ -572,18 +722,31 @@ func (r *NotaryRepository) bootstrapClient() (*tufclient.Client, error) {
 		return nil, err
 	}
 
-	err = r.KeyStoreManager.ValidateRoot(root, r.gun)
+	signedRoot, err := data.RootFromSigned(root)
 	if err != nil {
 		return nil, err
 	}
 
-	kdb := keys.NewDB()
-	r.tufRepo = tuf.NewTufRepo(kdb, r.cryptoService)
+	var chainKeys map[string]data.PublicKey
+	if !r.Offline {
+		chainKeys, err = r.walkRootChain(remote, signedRoot)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	signedRoot, err := data.RootFromSigned(root)
+	if chainKeys != nil {
+		err = r.KeyStoreManager.ValidateRootSignedBy(root, r.gun, chainKeys)
+	} else {
+		err = r.KeyStoreManager.ValidateRoot(root, r.gun)
+	}
 	if err != nil {
 		return nil, err
 	}
+
+	kdb := keys.NewDB()
+	r.tufRepo = tuf.NewTufRepo(kdb, r.cryptoService)
+
 	err = r.tufRepo.SetRoot(signedRoot)
 	if err != nil {
 		return nil, err
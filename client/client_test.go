@@ -94,9 +94,10 @@ func testInitRepo(t *testing.T, rootType data.KeyAlgorithm) {
 
 	// Look for keys in private. The filenames should match the key IDs
 	// in the private key store.
-	privKeyList := repo.KeyStoreManager.NonRootKeyStore().ListFiles(true)
+	nonRootKeyStore := repo.KeyStoreManager.NonRootKeyStore().(*trustmanager.KeyFileStore)
+	privKeyList := nonRootKeyStore.ListFiles(true)
 	for _, privKeyName := range privKeyList {
-		privKeyFileName := filepath.Join(repo.KeyStoreManager.NonRootKeyStore().BaseDir(), privKeyName)
+		privKeyFileName := filepath.Join(nonRootKeyStore.BaseDir(), privKeyName)
 		_, err := os.Stat(privKeyFileName)
 		assert.NoError(t, err, "missing private key: %s", privKeyName)
 	}
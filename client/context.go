@@ -0,0 +1,100 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// canceler is implemented by RoundTrippers, such as http.Transport, that
+// can abort a request in flight
+type canceler interface {
+	CancelRequest(*http.Request)
+}
+
+// contextTransport fails requests once its context is done. The request is
+// cancelled if the wrapped RoundTripper supports it; otherwise it is
+// abandoned and its response discarded when it arrives.
+type contextTransport struct {
+	ctx context.Context
+	rt  http.RoundTripper
+}
+
+func newContextTransport(ctx context.Context, rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	if ctx.Done() == nil {
+		// the context can never be done
+		return rt
+	}
+	return &contextTransport{ctx: ctx, rt: rt}
+}
+
+func (t *contextTransport) cancel(req *http.Request) {
+	if c, ok := t.rt.(canceler); ok {
+		c.CancelRequest(req)
+	}
+}
+
+type roundTripResult struct {
+	resp *http.Response
+	err  error
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case <-t.ctx.Done():
+		return nil, t.ctx.Err()
+	default:
+	}
+
+	result := make(chan roundTripResult, 1)
+	go func() {
+		resp, err := t.rt.RoundTrip(req)
+		result <- roundTripResult{resp, err}
+	}()
+
+	select {
+	case <-t.ctx.Done():
+		t.cancel(req)
+		go func() {
+			if res := <-result; res.resp != nil {
+				res.resp.Body.Close()
+			}
+		}()
+		return nil, t.ctx.Err()
+	case res := <-result:
+		if res.err != nil {
+			return nil, res.err
+		}
+		body := &contextBody{ReadCloser: res.resp.Body, closed: make(chan struct{})}
+		res.resp.Body = body
+		// the body is read after RoundTrip returns, so the request is
+		// cancelled if the context ends before it has been closed
+		go func() {
+			select {
+			case <-t.ctx.Done():
+				t.cancel(req)
+				body.ReadCloser.Close()
+			case <-body.closed:
+			}
+		}()
+		return res.resp, nil
+	}
+}
+
+// contextBody signals when a response body is closed
+type contextBody struct {
+	io.ReadCloser
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (b *contextBody) Close() error {
+	b.once.Do(func() { close(b.closed) })
+	return b.ReadCloser.Close()
+}
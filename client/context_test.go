@@ -0,0 +1,113 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// blockingServer returns a server whose handler writes headers and then
+// blocks until release is closed, counting the requests it receives
+func blockingServer(release chan struct{}, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+}
+
+func TestNewContextTransportBackground(t *testing.T) {
+	rt := &http.Transport{}
+	assert.Equal(t, rt, newContextTransport(context.Background(), rt))
+}
+
+func TestContextTransportCancelsBody(t *testing.T) {
+	release := make(chan struct{})
+	var requests int32
+	ts := blockingServer(release, &requests)
+	defer ts.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rt := newContextTransport(ctx, &http.Transport{})
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	assert.NoError(t, err)
+	resp, err := rt.RoundTrip(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	read := make(chan error, 1)
+	go func() {
+		_, err := ioutil.ReadAll(resp.Body)
+		read <- err
+	}()
+	cancel()
+	select {
+	case err := <-read:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("reading the body was not cancelled")
+	}
+
+	_, err = rt.RoundTrip(req)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestListTargetsContextDeadline(t *testing.T) {
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	assert.NoError(t, err, "failed to create a temporary directory: %s", err)
+	defer os.RemoveAll(tempBaseDir)
+
+	release := make(chan struct{})
+	var requests int32
+	ts := blockingServer(release, &requests)
+	defer ts.Close()
+	defer close(release)
+
+	repo, err := NewNotaryRepository(tempBaseDir, "docker.com/notary", ts.URL, &http.Transport{}, passphraseRetriever)
+	assert.NoError(t, err, "error creating repository: %s", err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = repo.ListTargetsContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < 5*time.Second, "the deadline was not enforced")
+	_, err = repo.GetTargetByNameContext(ctx, "latest")
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestCancelledContextSkipsServer(t *testing.T) {
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	assert.NoError(t, err, "failed to create a temporary directory: %s", err)
+	defer os.RemoveAll(tempBaseDir)
+
+	release := make(chan struct{})
+	var requests int32
+	ts := blockingServer(release, &requests)
+	defer ts.Close()
+	defer close(release)
+
+	repo, err := NewNotaryRepository(tempBaseDir, "docker.com/notary", ts.URL, http.DefaultTransport, passphraseRetriever)
+	assert.NoError(t, err, "error creating repository: %s", err)
+	rootKeyID, err := repo.KeyStoreManager.GenRootKey("ecdsa")
+	assert.NoError(t, err, "error generating root key: %s", err)
+	rootCryptoService, err := repo.KeyStoreManager.GetRootCryptoService(rootKeyID)
+	assert.NoError(t, err, "error retrieving root key: %s", err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, repo.InitializeContext(ctx, rootCryptoService))
+	assert.Equal(t, context.Canceled, repo.PublishContext(ctx))
+	_, err = repo.ListTargetsContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requests))
+}
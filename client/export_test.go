@@ -0,0 +1,60 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/notary/cryptoservice"
+	"github.com/docker/notary/server/export"
+	"github.com/docker/notary/server/storage"
+	"github.com/docker/notary/trustmanager"
+	"github.com/stretchr/testify/assert"
+)
+
+// A client that trusted an export can carry on reading from the server, and
+// sees updates published after the export.
+func TestExportThenServer(t *testing.T) {
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	assert.NoError(t, err, "failed to create a temporary directory: %s", err)
+	defer os.RemoveAll(tempBaseDir)
+
+	gun := "docker.com/notary"
+	store := storage.NewMemStorage()
+	crypto := cryptoservice.NewCryptoService("", trustmanager.NewKeyMemoryStore(passphraseRetriever))
+	ts := createFullTestServerWithCrypto(t, store, crypto)
+	defer ts.Close()
+	publisher := publishTestRepo(t, filepath.Join(tempBaseDir, "publisher"), gun, ts.URL)
+	// the server has signed a timestamp before the export signs the next
+	_, err = publisher.ListTargets()
+	assert.NoError(t, err)
+
+	exportDir := filepath.Join(tempBaseDir, "export")
+	assert.NoError(t, export.Export(export.Options{Dir: exportDir}, store, crypto))
+	static := httptest.NewServer(http.FileServer(http.Dir(exportDir)))
+	defer static.Close()
+
+	readerDir := filepath.Join(tempBaseDir, "reader")
+	reader, err := NewNotaryRepository(readerDir, gun, static.URL, http.DefaultTransport, passphraseRetriever)
+	assert.NoError(t, err, "error creating repository: %s", err)
+	targets, err := reader.ListTargets()
+	assert.NoError(t, err)
+	assert.Len(t, targets, 1)
+
+	reader, err = NewNotaryRepository(readerDir, gun, ts.URL, http.DefaultTransport, passphraseRetriever)
+	assert.NoError(t, err, "error creating repository: %s", err)
+	targets, err = reader.ListTargets()
+	assert.NoError(t, err)
+	assert.Len(t, targets, 1)
+
+	target, err := NewTarget("current", "../fixtures/intermediate-ca.crt")
+	assert.NoError(t, err, "error creating target")
+	assert.NoError(t, publisher.AddTarget(target))
+	assert.NoError(t, publisher.Publish())
+	targets, err = reader.ListTargets()
+	assert.NoError(t, err)
+	assert.Len(t, targets, 2)
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// TargetChange describes a single addition, removal or modification of a
+// target, as reported by the server's changefeed for a repository
+type TargetChange struct {
+	Target  string    `json:"target"`
+	Change  string    `json:"change"`
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+}
+
+type historyResponse struct {
+	Version int            `json:"version"`
+	Changes []TargetChange `json:"changes"`
+	More    bool           `json:"more"`
+}
+
+// GetChanges returns the changes made to the repository's targets after
+// the targets version fromVersion, along with the latest targets version
+// known to the server. A fromVersion of 0 returns the full history.
+// The history is informational: it is not signed, so it must not be used
+// in place of ListTargets or GetTargetByName for trust decisions.
+func (r *NotaryRepository) GetChanges(fromVersion int) ([]TargetChange, int, error) {
+	if r.Offline {
+		return nil, 0, ErrOffline
+	}
+	u, err := url.Parse(r.baseURL)
+	if err != nil {
+		return nil, 0, err
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/v2/" + r.gun + "/_trust/changefeed"
+
+	client := &http.Client{Transport: r.transport(context.Background())}
+	var changes []TargetChange
+	for {
+		history, err := r.getHistoryPage(client, u, fromVersion)
+		if err != nil {
+			return nil, 0, err
+		}
+		changes = append(changes, history.Changes...)
+		if !history.More || history.Version <= fromVersion {
+			return changes, history.Version, nil
+		}
+		fromVersion = history.Version
+	}
+}
+
+// getHistoryPage retrieves the page of the history starting after
+// fromVersion
+func (r *NotaryRepository) getHistoryPage(client *http.Client, u *url.URL, fromVersion int) (*historyResponse, error) {
+	page := *u
+	page.RawQuery = url.Values{"from": {strconv.Itoa(fromVersion)}}.Encode()
+	resp, err := client.Get(page.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to retrieve history for %s: %s", r.gun, resp.Status)
+	}
+
+	history := &historyResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// cachedResponse is the on disk representation of a previously downloaded
+// piece of metadata and the entity tag the server sent with it
+type cachedResponse struct {
+	ETag string `json:"etag"`
+	Body []byte `json:"body"`
+}
+
+// conditionalTransport is an http.RoundTripper that remembers the ETag of
+// metadata it has downloaded and makes subsequent requests for the same
+// URL conditional, so unchanged metadata isn't downloaded again. A 304
+// response is translated into a 200 carrying the cached body, so it is
+// transparent to the gotuf HTTPStore. The cached body is never trusted on
+// its own: it goes through the same TUF validation as a fresh download.
+type conditionalTransport struct {
+	cacheDir string
+	rt       http.RoundTripper
+}
+
+func newConditionalTransport(rt http.RoundTripper, cacheDir string) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &conditionalTransport{
+		cacheDir: cacheDir,
+		rt:       rt,
+	}
+}
+
+func (t *conditionalTransport) cachePath(req *http.Request) string {
+	digest := sha256.Sum256([]byte(req.URL.String()))
+	return filepath.Join(t.cacheDir, hex.EncodeToString(digest[:]))
+}
+
+func (t *conditionalTransport) load(path string) *cachedResponse {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	cached := &cachedResponse{}
+	if err := json.Unmarshal(raw, cached); err != nil || cached.ETag == "" {
+		return nil
+	}
+	return cached
+}
+
+func (t *conditionalTransport) save(path string, cached *cachedResponse) {
+	raw, err := json.Marshal(cached)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(t.cacheDir, 0700); err != nil {
+		logrus.Debug("unable to create http cache directory: ", err.Error())
+		return
+	}
+	if err := ioutil.WriteFile(path, raw, 0600); err != nil {
+		logrus.Debug("unable to write http cache entry: ", err.Error())
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *conditionalTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" {
+		return t.rt.RoundTrip(req)
+	}
+
+	path := t.cachePath(req)
+	cached := t.load(path)
+	if cached != nil {
+		// don't modify the caller's request
+		conditional := *req
+		conditional.Header = make(http.Header, len(req.Header)+1)
+		for k, v := range req.Header {
+			conditional.Header[k] = v
+		}
+		conditional.Header.Set("If-None-Match", cached.ETag)
+		req = &conditional
+	}
+
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		logrus.Debugf("%s not modified, using cached copy", req.URL.String())
+		resp.Body.Close()
+		resp.StatusCode = http.StatusOK
+		resp.Status = http.StatusText(http.StatusOK)
+		resp.ContentLength = int64(len(cached.Body))
+		resp.Body = ioutil.NopCloser(bytes.NewReader(cached.Body))
+	case resp.StatusCode == http.StatusOK && resp.Header.Get("ETag") != "" && resp.ContentLength <= maxSize:
+		// ContentLength is -1 for chunked responses, so the read is bounded
+		// too: anything larger than maxSize is passed through uncached
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		if len(body) > maxSize {
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+			return resp, nil
+		}
+		resp.Body.Close()
+		t.save(path, &cachedResponse{ETag: resp.Header.Get("ETag"), Body: body})
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	return resp, nil
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditionalTransport(t *testing.T) {
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	assert.NoError(t, err, "failed to create a temporary directory: %s", err)
+	defer os.RemoveAll(tempBaseDir)
+
+	body := "metadata"
+	var downloads, notModified int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"`+body+`"`)
+		if r.Header.Get("If-None-Match") == `"`+body+`"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: newConditionalTransport(http.DefaultTransport, tempBaseDir)}
+
+	get := func() string {
+		res, err := client.Get(ts.URL)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		b, err := ioutil.ReadAll(res.Body)
+		assert.NoError(t, err)
+		return string(b)
+	}
+
+	assert.Equal(t, "metadata", get())
+	assert.Equal(t, "metadata", get())
+	assert.Equal(t, 1, downloads)
+	assert.Equal(t, 1, notModified)
+
+	// a change on the server must be picked up
+	body = "updated"
+	assert.Equal(t, "updated", get())
+	assert.Equal(t, 2, downloads)
+	assert.Equal(t, "updated", get())
+	assert.Equal(t, 2, notModified)
+}
+
+func TestConditionalTransportSkipsLargeChunkedBodies(t *testing.T) {
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	assert.NoError(t, err, "failed to create a temporary directory: %s", err)
+	defer os.RemoveAll(tempBaseDir)
+
+	chunk := bytes.Repeat([]byte("a"), 1<<20)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"large"`)
+		// flushing before the end forces a chunked response
+		for i := 0; i < maxSize>>20+1; i++ {
+			w.Write(chunk)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: newConditionalTransport(http.DefaultTransport, tempBaseDir)}
+	res, err := client.Get(ts.URL)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, int64(-1), res.ContentLength)
+	b, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Len(t, b, (maxSize>>20+1)<<20, "the whole body should be passed through")
+
+	cached, err := ioutil.ReadDir(tempBaseDir)
+	assert.NoError(t, err)
+	assert.Len(t, cached, 0, "bodies larger than maxSize should not be cached")
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/signed"
+)
+
+// ErrOffline is returned by operations that need the server, such as
+// Initialize and Publish, when the repository is in offline mode
+var ErrOffline = errors.New("the notary server cannot be contacted in offline mode")
+
+// ErrNotCached is returned in offline mode when the cached trust data for a
+// repository is missing, incomplete or does not verify. Reading the
+// repository while online refreshes the cache.
+type ErrNotCached struct {
+	gun string
+}
+
+func (err ErrNotCached) Error() string {
+	return fmt.Sprintf("no valid cached trust data for %s, it must be fetched while online", err.gun)
+}
+
+// CacheStatus describes the cached timestamp that offline mode reads trust
+// data through, and so how out of date that data may be
+type CacheStatus struct {
+	// Version is the version of the cached timestamp
+	Version int
+	// Fetched is when the timestamp was downloaded from the server. It is
+	// zero if that is not known.
+	Fetched time.Time
+	// Expires is when the timestamp expires, after which the cached trust
+	// data can no longer be used
+	Expires time.Time
+}
+
+// Age returns how long ago the cached timestamp was fetched, or zero if
+// that is not known
+func (s *CacheStatus) Age() time.Duration {
+	if s.Fetched.IsZero() {
+		return 0
+	}
+	return time.Since(s.Fetched)
+}
+
+// GetCacheStatus returns the status of the cached timestamp for the
+// repository
+func (r *NotaryRepository) GetCacheStatus() (*CacheStatus, error) {
+	raw, err := r.fileStore.GetMeta(data.CanonicalTimestampRole, maxSize)
+	if err != nil || len(raw) == 0 {
+		return nil, ErrNotCached{gun: r.gun}
+	}
+	s := &data.Signed{}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+	ts, err := data.TimestampFromSigned(s)
+	if err != nil {
+		return nil, err
+	}
+	status := &CacheStatus{Version: ts.Signed.Version, Expires: ts.Signed.Expires}
+	// the timestamp is written to the cache every time it is downloaded,
+	// but only a cache on disk records when
+	if !r.cacheOnDisk {
+		return status, nil
+	}
+	if fi, err := os.Stat(filepath.Join(r.tufRepoPath, "metadata", data.CanonicalTimestampRole+".json")); err == nil {
+		status.Fetched = fi.ModTime()
+	}
+	return status, nil
+}
+
+// offlineError explains why trust data could not be read from the cache
+func (r *NotaryRepository) offlineError() error {
+	status, err := r.GetCacheStatus()
+	if err == nil && !status.Expires.After(time.Now()) {
+		return ErrExpired{signed.ErrExpired{
+			Role:    data.CanonicalTimestampRole,
+			Expired: status.Expires.Format("Mon Jan 2 15:04:05 MST 2006"),
+		}}
+	}
+	return ErrNotCached{gun: r.gun}
+}
+
+// offlineStore is the store.RemoteStore used in offline mode. It fails
+// every request, so the TUF client only uses the metadata it has cached.
+type offlineStore struct{}
+
+func (offlineStore) GetMeta(name string, size int64) ([]byte, error) {
+	return nil, ErrOffline
+}
+
+func (offlineStore) SetMeta(name string, blob []byte) error {
+	return ErrOffline
+}
+
+func (offlineStore) SetMultiMeta(metas map[string][]byte) error {
+	return ErrOffline
+}
+
+func (offlineStore) GetKey(role string) ([]byte, error) {
+	return nil, ErrOffline
+}
+
+func (offlineStore) GetTarget(path string) (io.ReadCloser, error) {
+	return nil, ErrOffline
+}
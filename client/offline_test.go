@@ -0,0 +1,131 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/notary/cryptoservice"
+	"github.com/docker/notary/server/handlers"
+	"github.com/docker/notary/server/storage"
+	"github.com/docker/notary/trustmanager"
+	"github.com/docker/notary/utils"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/signed"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// createFullTestServer starts a notary-server backed by store
+func createFullTestServer(t *testing.T, store storage.MetaStore) *httptest.Server {
+	return createFullTestServerWithCrypto(t, store,
+		cryptoservice.NewCryptoService("", trustmanager.NewKeyMemoryStore(passphraseRetriever)))
+}
+
+// createFullTestServerWithCrypto starts a notary-server backed by store that
+// signs timestamps with crypto
+func createFullTestServerWithCrypto(t *testing.T, store storage.MetaStore, crypto signed.CryptoService) *httptest.Server {
+	ctx := context.WithValue(context.Background(), "metaStore", store)
+	ctx = context.WithValue(ctx, "keyAlgorithm", "ecdsa")
+	hand := utils.RootHandlerFactory(nil, ctx, crypto)
+
+	prefix := "/v2/{imageName:" + v2.RepositoryNameRegexp.String() + "}/_trust/tuf/"
+	r := mux.NewRouter()
+	r.Methods("POST").Path(prefix).Handler(hand(handlers.AtomicUpdateHandler, "push", "pull"))
+	r.Methods("GET").Path(prefix + "{tufRole:(root|targets|snapshot)}.json").Handler(hand(handlers.GetHandler, "pull"))
+	r.Methods("GET").Path(prefix + "{tufRole:root}.{version:[0-9]+}.json").Handler(hand(handlers.GetVersionHandler, "pull"))
+	r.Methods("GET").Path(prefix + "timestamp.json").Handler(hand(handlers.GetTimestampHandler, "pull"))
+	r.Methods("GET").Path(prefix + "timestamp.key").Handler(hand(handlers.GetTimestampKeyHandler, "push", "pull"))
+	return httptest.NewServer(r)
+}
+
+// publishTestRepo initializes a repository under baseDir and publishes it
+// with a single target named "latest"
+func publishTestRepo(t *testing.T, baseDir, gun, url string) *NotaryRepository {
+	repo, err := NewNotaryRepository(baseDir, gun, url, http.DefaultTransport, passphraseRetriever)
+	assert.NoError(t, err, "error creating repository: %s", err)
+	rootKeyID, err := repo.KeyStoreManager.GenRootKey(data.ECDSAKey.String())
+	assert.NoError(t, err, "error generating root key: %s", err)
+	rootCryptoService, err := repo.KeyStoreManager.GetRootCryptoService(rootKeyID)
+	assert.NoError(t, err, "error retrieving root key: %s", err)
+	assert.NoError(t, repo.Initialize(rootCryptoService))
+
+	target, err := NewTarget("latest", "../fixtures/intermediate-ca.crt")
+	assert.NoError(t, err, "error creating target")
+	assert.NoError(t, repo.AddTarget(target))
+	assert.NoError(t, repo.Publish())
+	return repo
+}
+
+func TestOfflineListTargets(t *testing.T) {
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	assert.NoError(t, err, "failed to create a temporary directory: %s", err)
+	defer os.RemoveAll(tempBaseDir)
+
+	gun := "docker.com/notary"
+	ts := createFullTestServer(t, storage.NewMemStorage())
+	publishTestRepo(t, tempBaseDir, gun, ts.URL)
+
+	repo, err := NewNotaryRepository(tempBaseDir, gun, ts.URL, http.DefaultTransport, passphraseRetriever)
+	assert.NoError(t, err, "error creating repository: %s", err)
+	repo.Offline = true
+
+	// nothing has been read from the server, so no timestamp is cached
+	_, err = repo.ListTargets()
+	assert.IsType(t, ErrNotCached{}, err)
+	_, err = repo.GetCacheStatus()
+	assert.IsType(t, ErrNotCached{}, err)
+
+	repo.Offline = false
+	_, err = repo.ListTargets()
+	assert.NoError(t, err)
+
+	// the server is no longer needed
+	ts.Close()
+	repo.Offline = true
+	targets, err := repo.ListTargets()
+	assert.NoError(t, err)
+	assert.Len(t, targets, 1)
+	target, err := repo.GetTargetByName("latest")
+	assert.NoError(t, err)
+	assert.Equal(t, "latest", target.Name)
+
+	status, err := repo.GetCacheStatus()
+	assert.NoError(t, err)
+	assert.True(t, status.Version > 0)
+	assert.True(t, status.Age() < time.Minute, "timestamp should have just been fetched")
+	assert.True(t, status.Expires.After(time.Now()))
+
+	assert.Equal(t, ErrOffline, repo.Publish())
+	_, _, err = repo.GetChanges(0)
+	assert.Equal(t, ErrOffline, err)
+}
+
+func TestOfflineRejectsTamperedCache(t *testing.T) {
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	assert.NoError(t, err, "failed to create a temporary directory: %s", err)
+	defer os.RemoveAll(tempBaseDir)
+
+	gun := "docker.com/notary"
+	ts := createFullTestServer(t, storage.NewMemStorage())
+	defer ts.Close()
+	repo := publishTestRepo(t, tempBaseDir, gun, ts.URL)
+	_, err = repo.ListTargets()
+	assert.NoError(t, err)
+
+	// the cached targets no longer match the hash in the cached snapshot
+	targetsFile := filepath.Join(tempBaseDir, "tuf", filepath.FromSlash(gun), "metadata", "targets.json")
+	raw, err := ioutil.ReadFile(targetsFile)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(targetsFile, append(raw, ' '), 0644))
+
+	repo.Offline = true
+	_, err = repo.ListTargets()
+	assert.IsType(t, ErrNotCached{}, err)
+}
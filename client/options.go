@@ -0,0 +1,57 @@
+package client
+
+import (
+	"github.com/docker/notary/keystoremanager"
+	"github.com/docker/notary/trustmanager"
+	"github.com/endophage/gotuf/store"
+)
+
+// RepositoryOption changes where NewNotaryRepository keeps the data of a
+// repository. By default everything is kept under baseDir.
+type RepositoryOption func(*repositoryOptions)
+
+type repositoryOptions struct {
+	metadataStore   store.MetadataStore
+	stateStore      store.MetadataStore
+	keyStoreManager *keystoremanager.KeyStoreManager
+	inMemory        bool
+}
+
+// WithMetadataStore caches trust metadata in metadataStore instead of under
+// baseDir.
+func WithMetadataStore(metadataStore store.MetadataStore) RepositoryOption {
+	return func(opts *repositoryOptions) {
+		opts.metadataStore = metadataStore
+	}
+}
+
+// WithStateStore keeps the versions trusted to detect rollbacks in
+// stateStore instead of beside the metadata cache. It should not be emptied
+// along with the metadata cache, or older metadata is trusted again.
+func WithStateStore(stateStore store.MetadataStore) RepositoryOption {
+	return func(opts *repositoryOptions) {
+		opts.stateStore = stateStore
+	}
+}
+
+// InMemory keeps nothing under baseDir: the changelist is kept in memory and
+// server responses are not cached. It needs WithMetadataStore and
+// WithKeyStores, and the trusted versions are forgotten with the repository
+// unless WithStateStore is given too.
+func InMemory() RepositoryOption {
+	return func(opts *repositoryOptions) {
+		opts.inMemory = true
+	}
+}
+
+// WithKeyStores keeps private keys and trusted certificates in the given
+// stores instead of under baseDir. Keys cannot be imported or exported
+// unless the key stores are trustmanager.KeyFileStores.
+func WithKeyStores(rootKeyStore, nonRootKeyStore trustmanager.KeyStore,
+	trustedCAStore, trustedCertificateStore trustmanager.X509Store) RepositoryOption {
+
+	return func(opts *repositoryOptions) {
+		opts.keyStoreManager = keystoremanager.NewKeyStoreManagerFromStores(
+			rootKeyStore, nonRootKeyStore, trustedCAStore, trustedCertificateStore)
+	}
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/notary/server/storage"
+	"github.com/docker/notary/trustmanager"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepositoryWithoutDisk(t *testing.T) {
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	assert.NoError(t, err, "failed to create a temporary directory: %s", err)
+	defer os.RemoveAll(tempBaseDir)
+	baseDir := filepath.Join(tempBaseDir, "unused")
+
+	gun := "docker.com/notary"
+	ts := createFullTestServer(t, storage.NewMemStorage())
+	defer ts.Close()
+
+	metadataStore := store.NewMemoryStore(nil, nil)
+	stateStore := store.NewMemoryStore(nil, nil)
+	keyStores := WithKeyStores(
+		trustmanager.NewKeyMemoryStore(passphraseRetriever),
+		trustmanager.NewKeyMemoryStore(passphraseRetriever),
+		trustmanager.NewX509MemStore(),
+		trustmanager.NewX509MemStore(),
+	)
+	repo, err := NewNotaryRepository(baseDir, gun, ts.URL, http.DefaultTransport, passphraseRetriever,
+		InMemory(), WithMetadataStore(metadataStore), WithStateStore(stateStore), keyStores)
+	assert.NoError(t, err, "error creating repository: %s", err)
+
+	rootKeyID, err := repo.KeyStoreManager.GenRootKey(data.ECDSAKey.String())
+	assert.NoError(t, err, "error generating root key: %s", err)
+	rootCryptoService, err := repo.KeyStoreManager.GetRootCryptoService(rootKeyID)
+	assert.NoError(t, err, "error retrieving root key: %s", err)
+	assert.NoError(t, repo.Initialize(rootCryptoService))
+
+	target, err := NewTarget("latest", "../fixtures/intermediate-ca.crt")
+	assert.NoError(t, err, "error creating target")
+	assert.NoError(t, repo.AddTarget(target))
+	assert.NoError(t, repo.Publish())
+
+	targets, err := repo.ListTargets()
+	assert.NoError(t, err)
+	assert.Len(t, targets, 1)
+	found, err := repo.GetTargetByName("latest")
+	assert.NoError(t, err)
+	assert.Equal(t, target.Hashes, found.Hashes)
+
+	// the trusted versions are kept in the state store, not with the metadata
+	state, err := repo.loadState()
+	assert.NoError(t, err)
+	assert.Equal(t, repo.tufRepo.Timestamp.Signed.Version, state.Roles[data.CanonicalTimestampRole].Version)
+	raw, err := stateStore.GetMeta(stateMeta, maxSize)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, raw)
+	raw, err = metadataStore.GetMeta(stateMeta, maxSize)
+	assert.NoError(t, err)
+	assert.Empty(t, raw)
+
+	// when the timestamp was fetched is only known for a cache on disk
+	status, err := repo.GetCacheStatus()
+	assert.NoError(t, err)
+	assert.True(t, status.Fetched.IsZero())
+	assert.Equal(t, 0, int(status.Age()))
+
+	repo.Offline = true
+	targets, err = repo.ListTargets()
+	assert.NoError(t, err)
+	assert.Len(t, targets, 1)
+
+	_, err = os.Stat(baseDir)
+	assert.True(t, os.IsNotExist(err), "nothing should have been written under %s", baseDir)
+}
+
+func TestRepositoryInMemoryNeedsStores(t *testing.T) {
+	_, err := NewNotaryRepository("", "docker.com/notary", "", http.DefaultTransport, passphraseRetriever,
+		InMemory(), WithMetadataStore(store.NewMemoryStore(nil, nil)))
+	assert.Equal(t, ErrNeedsStores, err)
+}
+
+func TestRepositoryWithMetadataStoreKeepsDisk(t *testing.T) {
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	assert.NoError(t, err, "failed to create a temporary directory: %s", err)
+	defer os.RemoveAll(tempBaseDir)
+
+	gun := "docker.com/notary"
+	ts := createFullTestServer(t, storage.NewMemStorage())
+	defer ts.Close()
+
+	metadataStore := store.NewMemoryStore(nil, nil)
+	repo, err := NewNotaryRepository(tempBaseDir, gun, ts.URL, http.DefaultTransport, passphraseRetriever,
+		WithMetadataStore(metadataStore))
+	assert.NoError(t, err, "error creating repository: %s", err)
+
+	rootKeyID, err := repo.KeyStoreManager.GenRootKey(data.ECDSAKey.String())
+	assert.NoError(t, err, "error generating root key: %s", err)
+	rootCryptoService, err := repo.KeyStoreManager.GetRootCryptoService(rootKeyID)
+	assert.NoError(t, err, "error retrieving root key: %s", err)
+	assert.NoError(t, repo.Initialize(rootCryptoService))
+
+	// the changelist is still kept on disk
+	target, err := NewTarget("latest", "../fixtures/intermediate-ca.crt")
+	assert.NoError(t, err, "error creating target")
+	assert.NoError(t, repo.AddTarget(target))
+	_, err = os.Stat(repo.changelistDir())
+	assert.NoError(t, err)
+	assert.NoError(t, repo.Publish())
+	_, err = repo.ListTargets()
+	assert.NoError(t, err)
+
+	// the trusted versions are kept in the state file, not in the metadata
+	// store, so emptying it does not reset them
+	_, err = os.Stat(repo.statePath())
+	assert.NoError(t, err)
+	raw, err := metadataStore.GetMeta(stateMeta, maxSize)
+	assert.NoError(t, err)
+	assert.Empty(t, raw)
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/keys"
+	"github.com/endophage/gotuf/signed"
+	"github.com/endophage/gotuf/store"
+
+	"github.com/docker/notary/trustmanager"
+)
+
+// ErrRootChain is returned when an intermediate root between the trusted
+// root and the newest one cannot be verified
+type ErrRootChain struct {
+	Version int
+	Err     error
+}
+
+func (err ErrRootChain) Error() string {
+	return fmt.Sprintf("could not verify root version %d: %s", err.Version, err.Err)
+}
+
+// trustedRootVersion returns the version of the newest root trusted for the
+// repository, or 0 if none has been
+func (r *NotaryRepository) trustedRootVersion() int {
+	if state, err := r.loadState(); err == nil {
+		if root, ok := state.Roles[data.CanonicalRootRole]; ok {
+			return root.Version
+		}
+	}
+	raw, err := r.fileStore.GetMeta(data.CanonicalRootRole, maxSize)
+	if err != nil {
+		return 0
+	}
+	s := &data.Signed{}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return 0
+	}
+	root, err := data.RootFromSigned(s)
+	if err != nil {
+		return 0
+	}
+	return root.Signed.Version
+}
+
+// walkRootChain verifies, in order, every root version between the trusted
+// root and newest, so newest can be validated even if the root was rotated
+// several times since the repository was last read. Each intermediate root
+// must be signed by the root keys of the one before it, and by its own;
+// the expiry of the roots and their certificates is not checked, as only
+// newest needs to be current. It returns the root keys of the last
+// intermediate root, which newest must be signed by, or nil if there were
+// none and newest is validated against the trusted certificates.
+func (r *NotaryRepository) walkRootChain(remote store.RemoteStore, newest *data.SignedRoot) (map[string]data.PublicKey, error) {
+	certs, err := r.KeyStoreManager.TrustedCertificateStore().GetCertificatesByCN(r.gun)
+	if err != nil || len(certs) == 0 {
+		// nothing trusted yet, the newest root is trusted on first use
+		return nil, nil
+	}
+	prevKeys, threshold := trustmanager.CertsToKeys(certs), 1
+
+	// if the version of the trusted root is unknown, for example because the
+	// metadata cache was deleted, the chain starts at the first root signed
+	// by the trusted certificates
+	trusted := r.trustedRootVersion()
+	found := trusted > 0
+	var chainKeys map[string]data.PublicKey
+	for version := trusted + 1; version < newest.Signed.Version; version++ {
+		raw, err := remote.GetMeta(fmt.Sprintf("%s.%d", data.CanonicalRootRole, version), maxSize)
+		if err != nil {
+			if _, ok := err.(store.ErrMetaNotFound); ok {
+				// the server does not serve versioned roots; the newest root
+				// is validated against the trusted certificates as before
+				logrus.Debugf("root version %d not available, validating root version %d directly",
+					version, newest.Signed.Version)
+				return nil, nil
+			}
+			return nil, err
+		}
+		root := &data.Signed{}
+		if err := json.Unmarshal(raw, root); err != nil {
+			return nil, ErrRootChain{Version: version, Err: err}
+		}
+		signedRoot, err := data.RootFromSigned(root)
+		if err != nil {
+			return nil, ErrRootChain{Version: version, Err: err}
+		}
+		if signedRoot.Signed.Version != version {
+			return nil, ErrRootChain{Version: version, Err: fmt.Errorf("server provided version %d", signedRoot.Signed.Version)}
+		}
+		if err := verifyRootSignedBy(root, prevKeys, threshold); err != nil {
+			if !found {
+				continue
+			}
+			return nil, ErrRootChain{Version: version, Err: err}
+		}
+		keys, keysThreshold := rootKeys(signedRoot)
+		if err := verifyRootSignedBy(root, keys, keysThreshold); err != nil {
+			return nil, ErrRootChain{Version: version, Err: err}
+		}
+		found = true
+		prevKeys, threshold = keys, keysThreshold
+		chainKeys = keys
+		logrus.Debugf("verified intermediate root version %d", version)
+	}
+	return chainKeys, nil
+}
+
+// rootKeys returns the root keys listed in root, and how many of them must
+// sign a root
+func rootKeys(root *data.SignedRoot) (map[string]data.PublicKey, int) {
+	keys := make(map[string]data.PublicKey)
+	role, ok := root.Signed.Roles[data.CanonicalRootRole]
+	if !ok {
+		return keys, 1
+	}
+	for _, keyID := range role.KeyIDs {
+		if key, ok := root.Signed.Keys[keyID]; ok {
+			keys[keyID] = key
+		}
+	}
+	return keys, role.Threshold
+}
+
+// verifyRootSignedBy checks that root has valid signatures from threshold
+// of keys, without checking its expiry
+func verifyRootSignedBy(root *data.Signed, pubKeys map[string]data.PublicKey, threshold int) error {
+	kdb := keys.NewDB()
+	keyIDs := make([]string, 0, len(pubKeys))
+	for keyID, key := range pubKeys {
+		kdb.AddKey(key)
+		keyIDs = append(keyIDs, keyID)
+	}
+	role, err := data.NewRole(data.CanonicalRootRole, threshold, keyIDs, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := kdb.AddRole(role); err != nil {
+		return err
+	}
+	return signed.VerifySignatures(root, data.CanonicalRootRole, kdb)
+}
@@ -0,0 +1,233 @@
+package client
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/notary/cryptoservice"
+	"github.com/docker/notary/keystoremanager"
+	"github.com/docker/notary/server/storage"
+	"github.com/docker/notary/trustmanager"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/signed"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// rotateRoot returns the next version of root, with its root key replaced
+// by a new certificate and signed by both the old and new root keys
+func rotateRoot(t *testing.T, repo *NotaryRepository, root *data.SignedRoot) (*data.SignedRoot, []byte) {
+	privKey, err := trustmanager.GenerateECDSAKey(rand.Reader)
+	assert.NoError(t, err)
+	cert, err := cryptoservice.NewUnlockedCryptoService(privKey, nil).GenerateCertificate(repo.gun)
+	assert.NoError(t, err)
+	return rotateRootTo(t, repo, root, privKey, cert)
+}
+
+// rotateRootExpired is rotateRoot with a certificate that has expired
+func rotateRootExpired(t *testing.T, repo *NotaryRepository, root *data.SignedRoot) (*data.SignedRoot, []byte) {
+	privKey, err := trustmanager.GenerateECDSAKey(rand.Reader)
+	assert.NoError(t, err)
+	ecdsaKey, err := x509.ParseECPrivateKey(privKey.Private())
+	assert.NoError(t, err)
+	template, err := trustmanager.NewCertificate(repo.gun)
+	assert.NoError(t, err)
+	template.NotBefore = time.Now().Add(-48 * time.Hour)
+	template.NotAfter = time.Now().Add(-24 * time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, template, template, ecdsaKey.Public(), ecdsaKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return rotateRootTo(t, repo, root, privKey, cert)
+}
+
+// rotateRootTo is rotateRoot with the given root key and certificate
+func rotateRootTo(t *testing.T, repo *NotaryRepository, root *data.SignedRoot, privKey data.PrivateKey, cert *x509.Certificate) (*data.SignedRoot, []byte) {
+	newKey := data.NewPublicKey(data.ECDSAx509Key, trustmanager.CertToPEM(cert))
+	assert.NoError(t, repo.KeyStoreManager.RootKeyStore().AddKey(newKey.ID(), "root", privKey))
+
+	next := data.Root{
+		Type:    root.Signed.Type,
+		Version: root.Signed.Version + 1,
+		Expires: root.Signed.Expires,
+		Keys:    make(map[string]*data.TUFKey),
+		Roles:   make(map[string]*data.RootRole),
+	}
+	oldKeyIDs := root.Signed.Roles[data.CanonicalRootRole].KeyIDs
+	signingKeys := []data.PublicKey{newKey}
+	for _, keyID := range oldKeyIDs {
+		signingKeys = append(signingKeys, root.Signed.Keys[keyID])
+	}
+	for keyID, key := range root.Signed.Keys {
+		next.Keys[keyID] = key
+	}
+	for _, keyID := range oldKeyIDs {
+		delete(next.Keys, keyID)
+	}
+	next.Keys[newKey.ID()] = &data.TUFKey{Type: newKey.Algorithm(), Value: data.KeyPair{Public: newKey.Public()}}
+	for role, rootRole := range root.Signed.Roles {
+		next.Roles[role] = rootRole
+	}
+	next.Roles[data.CanonicalRootRole] = &data.RootRole{KeyIDs: []string{newKey.ID()}, Threshold: 1}
+
+	s, err := (data.SignedRoot{Signed: next}).ToSigned()
+	assert.NoError(t, err)
+	rootService := cryptoservice.NewCryptoService("", repo.KeyStoreManager.RootKeyStore())
+	assert.NoError(t, signed.Sign(rootService, s, signingKeys...))
+	raw, err := json.Marshal(s)
+	assert.NoError(t, err)
+	signedRoot, err := data.RootFromSigned(s)
+	assert.NoError(t, err)
+	return signedRoot, raw
+}
+
+// hidingStore hides one version of every role from GetVersions
+type hidingStore struct {
+	storage.MetaStore
+	hidden int
+}
+
+func (s *hidingStore) GetVersions(gun, role string, fromVersion, limit int) ([]storage.StoredMeta, error) {
+	versions, err := s.MetaStore.GetVersions(gun, role, fromVersion, limit)
+	var visible []storage.StoredMeta
+	for _, v := range versions {
+		if v.Version != s.hidden {
+			visible = append(visible, v)
+		}
+	}
+	return visible, err
+}
+
+func TestBootstrapWalksRootChain(t *testing.T) {
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	assert.NoError(t, err, "failed to create a temporary directory: %s", err)
+	defer os.RemoveAll(tempBaseDir)
+
+	gun := "docker.com/notary"
+	store := &hidingStore{MetaStore: storage.NewMemStorage()}
+	ts := createFullTestServer(t, store)
+	defer ts.Close()
+	repo := publishTestRepo(t, tempBaseDir, gun, ts.URL)
+	_, err = repo.ListTargets()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, repo.trustedRootVersion())
+
+	// the root is rotated twice while the client is not looking
+	root2, raw2 := rotateRoot(t, repo, repo.tufRepo.Root)
+	root3, raw3 := rotateRoot(t, repo, root2)
+	assert.NoError(t, store.UpdateCurrent(gun, storage.MetaUpdate{Role: "root", Version: 2, Data: raw2}))
+	assert.NoError(t, store.UpdateCurrent(gun, storage.MetaUpdate{Role: "root", Version: 3, Data: raw3}))
+
+	// without the intermediate root, the newest is not signed by a trusted key
+	store.hidden = 2
+	repo, err = NewNotaryRepository(tempBaseDir, gun, ts.URL, http.DefaultTransport, passphraseRetriever)
+	assert.NoError(t, err)
+	_, err = repo.bootstrapClient(context.Background())
+	assert.IsType(t, &keystoremanager.ErrValidationFail{}, err)
+
+	store.hidden = 0
+	_, err = repo.bootstrapClient(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, repo.tufRepo.Root.Signed.Version)
+
+	certs, err := repo.KeyStoreManager.TrustedCertificateStore().GetCertificatesByCN(gun)
+	assert.NoError(t, err)
+	assert.Len(t, certs, 1)
+	for keyID := range trustmanager.CertsToKeys(certs) {
+		assert.Equal(t, root3.Signed.Roles[data.CanonicalRootRole].KeyIDs[0], keyID)
+	}
+}
+
+func TestBootstrapWalksExpiredIntermediateRoot(t *testing.T) {
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	assert.NoError(t, err, "failed to create a temporary directory: %s", err)
+	defer os.RemoveAll(tempBaseDir)
+
+	gun := "docker.com/notary"
+	store := storage.NewMemStorage()
+	ts := createFullTestServer(t, store)
+	defer ts.Close()
+	repo := publishTestRepo(t, tempBaseDir, gun, ts.URL)
+	_, err = repo.ListTargets()
+	assert.NoError(t, err)
+
+	// the certificate of the intermediate root has expired since
+	root2, raw2 := rotateRootExpired(t, repo, repo.tufRepo.Root)
+	_, raw3 := rotateRoot(t, repo, root2)
+	assert.NoError(t, store.UpdateCurrent(gun, storage.MetaUpdate{Role: "root", Version: 2, Data: raw2}))
+	assert.NoError(t, store.UpdateCurrent(gun, storage.MetaUpdate{Role: "root", Version: 3, Data: raw3}))
+
+	repo, err = NewNotaryRepository(tempBaseDir, gun, ts.URL, http.DefaultTransport, passphraseRetriever)
+	assert.NoError(t, err)
+	_, err = repo.bootstrapClient(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, repo.tufRepo.Root.Signed.Version)
+}
+
+func TestBootstrapWalksRootChainWithoutCache(t *testing.T) {
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	assert.NoError(t, err, "failed to create a temporary directory: %s", err)
+	defer os.RemoveAll(tempBaseDir)
+
+	gun := "docker.com/notary"
+	store := storage.NewMemStorage()
+	ts := createFullTestServer(t, store)
+	defer ts.Close()
+	repo := publishTestRepo(t, tempBaseDir, gun, ts.URL)
+	_, err = repo.ListTargets()
+	assert.NoError(t, err)
+
+	root2, raw2 := rotateRoot(t, repo, repo.tufRepo.Root)
+	assert.NoError(t, store.UpdateCurrent(gun, storage.MetaUpdate{Role: "root", Version: 2, Data: raw2}))
+	repo, err = NewNotaryRepository(tempBaseDir, gun, ts.URL, http.DefaultTransport, passphraseRetriever)
+	assert.NoError(t, err)
+	_, err = repo.bootstrapClient(context.Background())
+	assert.NoError(t, err)
+
+	// the metadata is deleted, but the certificates of root 2 are still
+	// trusted when it is rotated twice more
+	assert.NoError(t, os.RemoveAll(filepath.Join(tempBaseDir, tufDir, filepath.FromSlash(gun))))
+	root3, raw3 := rotateRoot(t, repo, root2)
+	_, raw4 := rotateRoot(t, repo, root3)
+	assert.NoError(t, store.UpdateCurrent(gun, storage.MetaUpdate{Role: "root", Version: 3, Data: raw3}))
+	assert.NoError(t, store.UpdateCurrent(gun, storage.MetaUpdate{Role: "root", Version: 4, Data: raw4}))
+
+	repo, err = NewNotaryRepository(tempBaseDir, gun, ts.URL, http.DefaultTransport, passphraseRetriever)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, repo.trustedRootVersion())
+	_, err = repo.bootstrapClient(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 4, repo.tufRepo.Root.Signed.Version)
+}
+
+func TestWalkRootChainRejectsWrongVersion(t *testing.T) {
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	assert.NoError(t, err, "failed to create a temporary directory: %s", err)
+	defer os.RemoveAll(tempBaseDir)
+
+	gun := "docker.com/notary"
+	store := storage.NewMemStorage()
+	ts := createFullTestServer(t, store)
+	defer ts.Close()
+	repo := publishTestRepo(t, tempBaseDir, gun, ts.URL)
+	_, err = repo.ListTargets()
+	assert.NoError(t, err)
+
+	// the server provides version 1 of the root as version 2
+	raw, err := repo.fileStore.GetMeta("root", maxSize)
+	assert.NoError(t, err)
+	assert.NoError(t, store.UpdateCurrent(gun, storage.MetaUpdate{Role: "root", Version: 2, Data: raw}))
+
+	remote, err := getRemoteStore(ts.URL, gun, http.DefaultTransport)
+	assert.NoError(t, err)
+	_, err = repo.walkRootChain(remote, &data.SignedRoot{Signed: data.Root{Version: 3}})
+	assert.IsType(t, ErrRootChain{}, err)
+	assert.Equal(t, 2, err.(ErrRootChain).Version)
+}
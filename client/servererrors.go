@@ -0,0 +1,164 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// PolicyViolation describes a rule of the server's targets policy that an
+// update broke
+type PolicyViolation struct {
+	Role    string `json:"role"`
+	Rule    string `json:"rule"`
+	Target  string `json:"target,omitempty"`
+	Message string `json:"message"`
+}
+
+// ErrPolicyViolation is returned by Publish when the server refuses the
+// update because its targets break the policy configured for the GUN
+type ErrPolicyViolation struct {
+	Violations []PolicyViolation
+}
+
+func (err ErrPolicyViolation) Error() string {
+	msgs := make([]string, 0, len(err.Violations))
+	for _, v := range err.Violations {
+		prefix := ""
+		if v.Role != "" {
+			prefix = v.Role + ": "
+		}
+		if v.Target != "" {
+			prefix += v.Target + ": "
+		}
+		msgs = append(msgs, fmt.Sprintf("%s%s (%s)", prefix, v.Message, v.Rule))
+	}
+	return "update rejected by server policy:\n  " + strings.Join(msgs, "\n  ")
+}
+
+// ErrBadRoot is returned by Publish when the server rejects the root
+type ErrBadRoot struct {
+	Reason string
+}
+
+func (err ErrBadRoot) Error() string {
+	return fmt.Sprintf("server rejected the root: %s", err.Reason)
+}
+
+// ErrBadTargets is returned by Publish when the server rejects a targets role
+type ErrBadTargets struct {
+	Role   string
+	Reason string
+}
+
+func (err ErrBadTargets) Error() string {
+	return fmt.Sprintf("server rejected %s: %s", err.Role, err.Reason)
+}
+
+// ErrBadSnapshot is returned by Publish when the server rejects the snapshot
+type ErrBadSnapshot struct {
+	Reason string
+}
+
+func (err ErrBadSnapshot) Error() string {
+	return fmt.Sprintf("server rejected the snapshot: %s", err.Reason)
+}
+
+// ErrBadHierarchy is returned by Publish when the update is missing roles
+// the server requires alongside the ones being changed
+type ErrBadHierarchy struct {
+	Reason string
+}
+
+func (err ErrBadHierarchy) Error() string {
+	return fmt.Sprintf("server rejected the update: %s", err.Reason)
+}
+
+// ErrVersionConflict is returned by Publish when another update was
+// published first. Publishing again will apply the changes on top of it.
+type ErrVersionConflict struct {
+	Reason string
+}
+
+func (err ErrVersionConflict) Error() string {
+	return fmt.Sprintf("a newer version of the trust data was published first: %s", err.Reason)
+}
+
+// serverError is an error as serialized by the server
+type serverError struct {
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Detail  json.RawMessage `json:"detail"`
+}
+
+// updateErrorTransport turns the errors the server returns when it rejects
+// an update into typed errors. The gotuf HTTPStore discards error response
+// bodies, but returns errors from the RoundTripper as they are.
+type updateErrorTransport struct {
+	rt http.RoundTripper
+}
+
+func newUpdateErrorTransport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &updateErrorTransport{rt: rt}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *updateErrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil || req.Method != "POST" || resp.StatusCode < 400 {
+		return resp, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if typed := parseServerError(body); typed != nil {
+		return nil, typed
+	}
+	resp.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+	return resp, nil
+}
+
+// parseServerError returns the typed error for an error response body, or
+// nil if it isn't one the client knows about
+func parseServerError(body []byte) error {
+	var errs struct {
+		Errors []serverError `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &errs); err != nil {
+		return nil
+	}
+	for _, e := range errs.Errors {
+		var detail struct {
+			Role   string `json:"role"`
+			Reason string `json:"reason"`
+		}
+		json.Unmarshal(e.Detail, &detail)
+		switch e.Code {
+		case "BAD_ROOT":
+			return ErrBadRoot{Reason: detail.Reason}
+		case "BAD_TARGETS":
+			return ErrBadTargets{Role: detail.Role, Reason: detail.Reason}
+		case "BAD_SNAPSHOT":
+			return ErrBadSnapshot{Reason: detail.Reason}
+		case "BAD_HIERARCHY":
+			return ErrBadHierarchy{Reason: detail.Reason}
+		case "VERSION_CONFLICT":
+			return ErrVersionConflict{Reason: detail.Reason}
+		case "POLICY_VIOLATION":
+			var detail struct {
+				Violations []PolicyViolation `json:"violations"`
+			}
+			if err := json.Unmarshal(e.Detail, &detail); err == nil {
+				return ErrPolicyViolation{Violations: detail.Violations}
+			}
+		}
+	}
+	return nil
+}
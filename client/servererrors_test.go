@@ -0,0 +1,60 @@
+package client
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateErrorTransportPolicyViolation(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"errors": [{"code": "POLICY_VIOLATION", "message": "m",
+			"detail": {"violations": [{"rule": "max_targets", "message": "too many"}]}}]}`))
+	}))
+	defer ts.Close()
+
+	rt := newUpdateErrorTransport(nil)
+	req, _ := http.NewRequest("POST", ts.URL, bytes.NewReader(nil))
+	_, err := rt.RoundTrip(req)
+	assert.Equal(t, ErrPolicyViolation{Violations: []PolicyViolation{{Rule: "max_targets", Message: "too many"}}}, err)
+
+	// only updates are translated
+	req, _ = http.NewRequest("GET", ts.URL, nil)
+	resp, err := rt.RoundTrip(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestUpdateErrorTransportUnknownError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"errors": [{"code": "UNKNOWN"}]}`))
+	}))
+	defer ts.Close()
+
+	req, _ := http.NewRequest("POST", ts.URL, bytes.NewReader(nil))
+	resp, err := newUpdateErrorTransport(nil).RoundTrip(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
+
+func TestParseServerError(t *testing.T) {
+	cases := map[string]error{
+		`{"errors": [{"code": "BAD_ROOT", "detail": {"role": "root", "reason": "r"}}]}`:         ErrBadRoot{Reason: "r"},
+		`{"errors": [{"code": "BAD_TARGETS", "detail": {"role": "targets", "reason": "r"}}]}`:   ErrBadTargets{Role: "targets", Reason: "r"},
+		`{"errors": [{"code": "BAD_SNAPSHOT", "detail": {"role": "snapshot", "reason": "r"}}]}`: ErrBadSnapshot{Reason: "r"},
+		`{"errors": [{"code": "BAD_HIERARCHY", "detail": {"reason": "r"}}]}`:                    ErrBadHierarchy{Reason: "r"},
+		`{"errors": [{"code": "VERSION_CONFLICT", "detail": {"reason": "r"}}]}`:                 ErrVersionConflict{Reason: "r"},
+		`{"errors": [{"code": "MALFORMED_UPLOAD"}]}`:                                            nil,
+		`not json`: nil,
+	}
+	for body, expected := range cases {
+		assert.Equal(t, expected, parseServerError([]byte(body)), body)
+	}
+}
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/signed"
+	"github.com/endophage/gotuf/store"
+)
+
+// stateFile records the newest metadata the client has trusted for a
+// repository. It is kept beside the metadata cache rather than in it, so
+// that wiping the cache does not allow older metadata to be trusted again.
+// A repository with a state store keeps the state in it as stateMeta.
+const (
+	stateFile = "state.json"
+	stateMeta = "state"
+)
+
+// ErrRollback is returned when the server provides metadata for a role that
+// is older than a version the client has already trusted
+type ErrRollback struct {
+	Role    string
+	Trusted int
+	Served  int
+}
+
+func (err ErrRollback) Error() string {
+	return fmt.Sprintf("the server provided version %d of %s, but version %d has already been trusted",
+		err.Served, err.Role, err.Trusted)
+}
+
+// ErrFreezeSuspected is returned when the server appears to be providing
+// stale trust data: either its timestamp has expired, which a notary-server
+// never allows, or it is the version already trusted but expires earlier
+type ErrFreezeSuspected struct {
+	Expires time.Time
+	Trusted time.Time
+}
+
+func (err ErrFreezeSuspected) Error() string {
+	if err.Trusted.IsZero() {
+		return fmt.Sprintf("the server provided a timestamp that expired at %s, its trust data may be frozen",
+			err.Expires.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("the server provided a timestamp expiring at %s, before the trusted timestamp expiring at %s; its trust data may be frozen",
+		err.Expires.Format(time.RFC3339), err.Trusted.Format(time.RFC3339))
+}
+
+// roleState is the newest version of a role the client has trusted
+type roleState struct {
+	Version int       `json:"version"`
+	Expires time.Time `json:"expires"`
+}
+
+// repoState is the content of the state file, keyed by role
+type repoState struct {
+	Roles map[string]roleState `json:"roles"`
+}
+
+func (r *NotaryRepository) statePath() string {
+	return filepath.Join(r.tufRepoPath, stateFile)
+}
+
+// loadState reads the state file, which is empty if nothing has been
+// trusted yet
+func (r *NotaryRepository) loadState() (*repoState, error) {
+	state := &repoState{Roles: make(map[string]roleState)}
+	var (
+		raw []byte
+		err error
+	)
+	if r.stateStore != nil {
+		raw, err = r.stateStore.GetMeta(stateMeta, maxSize)
+		if _, ok := err.(store.ErrMetaNotFound); ok {
+			err = nil
+		}
+	} else {
+		raw, err = ioutil.ReadFile(r.statePath())
+	}
+	if os.IsNotExist(err) || (err == nil && len(raw) == 0) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, state); err != nil {
+		return nil, fmt.Errorf("corrupt trust state for %s: %s", r.gun, err)
+	}
+	if state.Roles == nil {
+		state.Roles = make(map[string]roleState)
+	}
+	return state, nil
+}
+
+// saveState atomically replaces the state file
+func (r *NotaryRepository) saveState(state *repoState) error {
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if r.stateStore != nil {
+		return r.stateStore.SetMeta(stateMeta, raw)
+	}
+	if err := os.MkdirAll(r.tufRepoPath, 0700); err != nil {
+		return err
+	}
+	tmp := r.statePath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.statePath())
+}
+
+// loadedRoles returns the version and expiry of each role in r.tufRepo
+func (r *NotaryRepository) loadedRoles() map[string]roleState {
+	roles := make(map[string]roleState)
+	if r.tufRepo.Root != nil {
+		roles[data.CanonicalRootRole] = roleState{r.tufRepo.Root.Signed.Version, r.tufRepo.Root.Signed.Expires}
+	}
+	if r.tufRepo.Timestamp != nil {
+		roles[data.CanonicalTimestampRole] = roleState{r.tufRepo.Timestamp.Signed.Version, r.tufRepo.Timestamp.Signed.Expires}
+	}
+	if r.tufRepo.Snapshot != nil {
+		roles[data.CanonicalSnapshotRole] = roleState{r.tufRepo.Snapshot.Signed.Version, r.tufRepo.Snapshot.Signed.Expires}
+	}
+	for role, targets := range r.tufRepo.Targets {
+		roles[role] = roleState{targets.Signed.Version, targets.Signed.Expires}
+	}
+	return roles
+}
+
+// checkState rejects the metadata loaded into r.tufRepo if it is older than
+// what has already been trusted, and otherwise records it as trusted
+func (r *NotaryRepository) checkState() error {
+	state, err := r.loadState()
+	if err != nil {
+		return err
+	}
+	loaded := r.loadedRoles()
+	for role, served := range loaded {
+		trusted, ok := state.Roles[role]
+		if !ok {
+			continue
+		}
+		if served.Version < trusted.Version {
+			return ErrRollback{Role: role, Trusted: trusted.Version, Served: served.Version}
+		}
+		// newer timestamps may expire earlier, for example after the
+		// server's timestamp lifetime is shortened; expired ones are
+		// rejected when they are downloaded
+		if role == data.CanonicalTimestampRole && served.Version == trusted.Version && served.Expires.Before(trusted.Expires) {
+			return ErrFreezeSuspected{Expires: served.Expires, Trusted: trusted.Expires}
+		}
+	}
+	changed := false
+	for role, served := range loaded {
+		if trusted, ok := state.Roles[role]; !ok || served != trusted {
+			state.Roles[role] = served
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return r.saveState(state)
+}
+
+// freezeError converts the expiry of a timestamp downloaded from the
+// server into ErrFreezeSuspected
+func freezeError(err signed.ErrExpired) error {
+	if err.Role != data.CanonicalTimestampRole {
+		return ErrExpired{err}
+	}
+	expires, perr := time.Parse("Mon Jan 2 15:04:05 MST 2006", err.Expired)
+	if perr != nil {
+		return ErrExpired{err}
+	}
+	return ErrFreezeSuspected{Expires: expires}
+}
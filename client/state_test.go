@@ -0,0 +1,115 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/notary/server/storage"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/signed"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateRecordsTrustedVersions(t *testing.T) {
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	assert.NoError(t, err, "failed to create a temporary directory: %s", err)
+	defer os.RemoveAll(tempBaseDir)
+
+	ts := createFullTestServer(t, storage.NewMemStorage())
+	defer ts.Close()
+	repo := publishTestRepo(t, tempBaseDir, "docker.com/notary", ts.URL)
+	_, err = repo.ListTargets()
+	assert.NoError(t, err)
+
+	state, err := repo.loadState()
+	assert.NoError(t, err)
+	for _, role := range []string{data.CanonicalRootRole, data.CanonicalTargetsRole,
+		data.CanonicalSnapshotRole, data.CanonicalTimestampRole} {
+		_, ok := state.Roles[role]
+		assert.True(t, ok, "no state recorded for %s", role)
+	}
+	assert.Equal(t, repo.tufRepo.Timestamp.Signed.Version, state.Roles[data.CanonicalTimestampRole].Version)
+	assert.True(t, state.Roles[data.CanonicalTimestampRole].Expires.After(time.Now()))
+}
+
+func TestStateRejectsRollbackAfterCacheWipe(t *testing.T) {
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	assert.NoError(t, err, "failed to create a temporary directory: %s", err)
+	defer os.RemoveAll(tempBaseDir)
+
+	ts := createFullTestServer(t, storage.NewMemStorage())
+	defer ts.Close()
+	repo := publishTestRepo(t, tempBaseDir, "docker.com/notary", ts.URL)
+	_, err = repo.ListTargets()
+	assert.NoError(t, err)
+
+	// pretend a newer targets was trusted before the server was rolled back
+	state, err := repo.loadState()
+	assert.NoError(t, err)
+	trusted := state.Roles[data.CanonicalTargetsRole]
+	trusted.Version += 5
+	state.Roles[data.CanonicalTargetsRole] = trusted
+	assert.NoError(t, repo.saveState(state))
+	cached, err := filepath.Glob(filepath.Join(repo.tufRepoPath, "metadata", "*.json"))
+	assert.NoError(t, err)
+	for _, f := range cached {
+		assert.NoError(t, os.Remove(f))
+	}
+
+	_, err = repo.ListTargets()
+	assert.IsType(t, ErrRollback{}, err)
+	assert.Equal(t, data.CanonicalTargetsRole, err.(ErrRollback).Role)
+	assert.Equal(t, trusted.Version, err.(ErrRollback).Trusted)
+
+	// the rejected metadata is not trusted from the cache either
+	repo.Offline = true
+	_, err = repo.ListTargets()
+	assert.IsType(t, ErrRollback{}, err)
+}
+
+func TestStateSuspectsFreeze(t *testing.T) {
+	tempBaseDir, err := ioutil.TempDir("", "notary-test-")
+	assert.NoError(t, err, "failed to create a temporary directory: %s", err)
+	defer os.RemoveAll(tempBaseDir)
+
+	ts := createFullTestServer(t, storage.NewMemStorage())
+	defer ts.Close()
+	repo := publishTestRepo(t, tempBaseDir, "docker.com/notary", ts.URL)
+	_, err = repo.ListTargets()
+	assert.NoError(t, err)
+
+	// the served version of the timestamp was already trusted, expiring
+	// later
+	state, err := repo.loadState()
+	assert.NoError(t, err)
+	trusted := state.Roles[data.CanonicalTimestampRole]
+	trusted.Expires = trusted.Expires.Add(24 * time.Hour)
+	state.Roles[data.CanonicalTimestampRole] = trusted
+	assert.NoError(t, repo.saveState(state))
+
+	_, err = repo.ListTargets()
+	assert.IsType(t, ErrFreezeSuspected{}, err)
+
+	// a newer timestamp may expire earlier than the trusted one
+	trusted.Version--
+	state.Roles[data.CanonicalTimestampRole] = trusted
+	assert.NoError(t, repo.saveState(state))
+	_, err = repo.ListTargets()
+	assert.NoError(t, err)
+}
+
+func TestFreezeError(t *testing.T) {
+	expired := time.Now().Add(-time.Hour)
+	err := freezeError(signed.ErrExpired{
+		Role:    data.CanonicalTimestampRole,
+		Expired: expired.Format("Mon Jan 2 15:04:05 MST 2006"),
+	})
+	assert.IsType(t, ErrFreezeSuspected{}, err)
+	assert.Equal(t, expired.Unix(), err.(ErrFreezeSuspected).Expires.Unix())
+
+	err = freezeError(signed.ErrExpired{Role: data.CanonicalTargetsRole})
+	assert.IsType(t, ErrExpired{}, err)
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+)
+
+// PublicKeyPin returns the pin of a certificate's public key: the base64
+// encoded SHA256 digest of its DER encoded SubjectPublicKeyInfo, as used by
+// HTTP Public Key Pinning
+func PublicKeyPin(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// PinnedDialTLS returns a function suitable for http.Transport's DialTLS.
+// Connections are verified as usual using config and, if the address being
+// dialed is pinnedAddr, the public key of the server's certificate must
+// also match one of pins. Pins survive the server's certificate being
+// reissued with the same key, and protect against a compromised CA.
+func PinnedDialTLS(config *tls.Config, pinnedAddr string, pins []string) func(network, addr string) (net.Conn, error) {
+	return func(network, addr string) (net.Conn, error) {
+		conn, err := tls.Dial(network, addr, config)
+		if err != nil {
+			return nil, err
+		}
+		if addr != pinnedAddr {
+			return conn, nil
+		}
+		certs := conn.ConnectionState().PeerCertificates
+		if len(certs) > 0 {
+			pin := PublicKeyPin(certs[0])
+			for _, p := range pins {
+				if p == pin {
+					return conn, nil
+				}
+			}
+		}
+		conn.Close()
+		return nil, fmt.Errorf("the certificate presented by %s does not match any pinned public key", addr)
+	}
+}
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPinnedDialTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	addr := strings.TrimPrefix(ts.URL, "https://")
+	cert, err := x509.ParseCertificate(ts.TLS.Certificates[0].Certificate[0])
+	assert.NoError(t, err)
+	pin := PublicKeyPin(cert)
+
+	// only the pins are being tested, the test server's certificate is self signed
+	config := &tls.Config{InsecureSkipVerify: true}
+
+	conn, err := PinnedDialTLS(config, addr, []string{"bad", pin})("tcp", addr)
+	assert.NoError(t, err)
+	conn.Close()
+
+	_, err = PinnedDialTLS(config, addr, []string{"bad"})("tcp", addr)
+	assert.Error(t, err)
+
+	// other hosts aren't pinned
+	conn, err = PinnedDialTLS(config, "other:443", []string{"bad"})("tcp", addr)
+	assert.NoError(t, err)
+	conn.Close()
+}
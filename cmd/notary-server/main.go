@@ -1,28 +1,43 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
 	_ "expvar"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/bugsnag/bugsnag-go"
-	_ "github.com/docker/distribution/registry/auth/htpasswd"
-	_ "github.com/docker/distribution/registry/auth/token"
+	"github.com/docker/distribution/registry/auth"
 	"github.com/endophage/gotuf/signed"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/mitchellh/mapstructure"
 	"golang.org/x/net/context"
 
 	bugsnag_hook "github.com/Sirupsen/logrus/hooks/bugsnag"
+	"github.com/docker/notary/pkg/metrics"
 	"github.com/docker/notary/server"
+	"github.com/docker/notary/server/access"
+	"github.com/docker/notary/server/events"
+	"github.com/docker/notary/server/export"
+	"github.com/docker/notary/server/gc"
+	"github.com/docker/notary/server/handlers"
+	"github.com/docker/notary/server/mirror"
+	"github.com/docker/notary/server/policy"
 	"github.com/docker/notary/server/storage"
+	"github.com/docker/notary/server/timestamp"
 	"github.com/docker/notary/signer"
+	"github.com/docker/notary/utils"
 	"github.com/docker/notary/version"
 	"github.com/spf13/viper"
 )
@@ -53,7 +68,14 @@ func main() {
 	// when the server starts print the version for debugging and issue logs later
 	logrus.Infof("Version: %s, Git commit: %s", version.NotaryVersion, version.GitCommit)
 
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		sig := <-stop
+		logrus.Infof("Received %s, shutting down", sig)
+		cancel()
+	}()
 
 	filename := filepath.Base(configFile)
 	ext := filepath.Ext(configFile)
@@ -74,12 +96,7 @@ func main() {
 		logrus.Error("Could not read config at ", configFile)
 		os.Exit(1)
 	}
-	lvl, err := logrus.ParseLevel(viper.GetString("logging.level"))
-	if err != nil {
-		lvl = logrus.ErrorLevel
-		logrus.Error("Could not parse log level from config. Defaulting to ErrorLevel")
-	}
-	logrus.SetLevel(lvl)
+	setLogLevel()
 
 	// set up bugsnag and attach to logrus
 	bugs := viper.GetString("reporting.bugsnag")
@@ -97,56 +114,360 @@ func main() {
 			logrus.AddHook(hook)
 		}
 	}
-	keyAlgo := viper.GetString("trust_service.key_algorithm")
-	if keyAlgo == "" {
-		logrus.Fatal("no key algorithm configured.")
-		os.Exit(1)
-	}
-	ctx = context.WithValue(ctx, "keyAlgorithm", keyAlgo)
+	mirroring := viper.GetString("mirror.upstream") != ""
 
 	var trust signed.CryptoService
-	if viper.GetString("trust_service.type") == "remote" {
-		logrus.Info("Using remote signing service")
-		trust = signer.NewNotarySigner(
-			viper.GetString("trust_service.hostname"),
-			viper.GetString("trust_service.port"),
-			viper.GetString("trust_service.tls_ca_file"),
-		)
+	if mirroring {
+		// mirrors serve the upstream's timestamps and never sign
+		logrus.Info("Running as a read-only mirror of ", viper.GetString("mirror.upstream"))
+		ctx = context.WithValue(ctx, "readOnly", true)
 	} else {
-		logrus.Info("Using local signing service")
-		trust = signed.NewEd25519()
+		keyAlgo := viper.GetString("trust_service.key_algorithm")
+		if keyAlgo == "" {
+			logrus.Fatal("no key algorithm configured.")
+			os.Exit(1)
+		}
+		ctx = context.WithValue(ctx, "keyAlgorithm", keyAlgo)
+		if lifetime := viper.GetDuration("timestamp.lifetime"); lifetime > 0 {
+			timestamp.SetLifetime(lifetime)
+		}
+
+		if viper.GetString("trust_service.type") == "remote" {
+			logrus.Info("Using remote signing service")
+			trust = signer.NewNotarySigner(
+				viper.GetString("trust_service.hostname"),
+				viper.GetString("trust_service.port"),
+				viper.GetString("trust_service.tls_ca_file"),
+			)
+		} else {
+			logrus.Info("Using local signing service")
+			trust = signed.NewEd25519()
+		}
 	}
 
+	var (
+		db    *sql.DB
+		store storage.MetaStore
+	)
 	if viper.GetString("storage.backend") == "mysql" {
 		logrus.Info("Using mysql backend")
 		dbURL := viper.GetString("storage.db_url")
-		db, err := sql.Open("mysql", dbURL)
+		db, err = sql.Open("mysql", dbURL)
 		if err != nil {
 			logrus.Fatal("Error starting DB driver: ", err.Error())
 			return // not strictly needed but let's be explicit
 		}
-		ctx = context.WithValue(ctx, "metaStore", storage.NewMySQLStorage(db))
+		store = storage.NewInstrumentedStore(storage.NewMySQLStorage(db))
+	} else if viper.GetString("storage.backend") == "filesystem" {
+		dir := viper.GetString("storage.directory")
+		if dir == "" {
+			logrus.Fatal("no storage directory configured.")
+			return
+		}
+		logrus.Info("Using filesystem backend in ", dir)
+		fileStore, err := storage.NewFileStorage(dir)
+		if err != nil {
+			logrus.Fatal("Error opening storage directory: ", err.Error())
+			return
+		}
+		store = storage.NewInstrumentedStore(fileStore)
 	} else {
 		logrus.Debug("Using memory backend")
-		ctx = context.WithValue(ctx, "metaStore", storage.NewMemStorage())
+		store = storage.NewInstrumentedStore(storage.NewMemStorage())
+	}
+	if cacheSize := viper.GetInt("storage.cache_size"); cacheSize > 0 {
+		logrus.Infof("Caching up to %d roles", cacheSize)
+		cachingStore, err := storage.NewCachingStore(store, storage.CacheOptions{
+			Size: cacheSize,
+			TTL:  viper.GetDuration("storage.cache_ttl"),
+		})
+		if err != nil {
+			logrus.Fatal("Error configuring the storage cache: ", err.Error())
+		}
+		store = cachingStore
+	}
+	ctx = context.WithValue(ctx, "metaStore", store)
+
+	if flag.Arg(0) == "export" {
+		err := runExport(store, trust, mirroring, flag.Args()[1:])
+		if db != nil {
+			db.Close()
+		}
+		if err != nil {
+			logrus.Fatal("Error exporting trust data: ", err.Error())
+		}
+		return
 	}
+
+	if flag.Arg(0) == "gc" {
+		err := runGC(store)
+		if db != nil {
+			db.Close()
+		}
+		if err != nil {
+			logrus.Fatal("Error collecting old metadata: ", err.Error())
+		}
+		return
+	}
+	if addr := viper.GetString("metrics.addr"); addr != "" {
+		go metricsServer(addr)
+	}
+	if viper.IsSet("storage.retention") {
+		collector, err := newCollector(store)
+		if err != nil {
+			logrus.Fatal("Error configuring retention: ", err.Error())
+			return
+		}
+		go collector.Run(ctx)
+	}
+
+	if mirroring {
+		m, err := newMirror(store)
+		if err != nil {
+			logrus.Fatal("Error configuring mirror: ", err.Error())
+			return
+		}
+		go m.Run(ctx)
+	}
+	broker, err := eventBroker()
+	if err != nil {
+		logrus.Fatal("Error configuring events: ", err.Error())
+		return
+	}
+	ctx = context.WithValue(ctx, "eventBroker", broker)
+	policies, err := targetsPolicy()
+	if err != nil {
+		logrus.Fatal("Error configuring targets policy: ", err.Error())
+		return
+	}
+	ctx = context.WithValue(ctx, "targetsPolicy", policies)
+	ctx = context.WithValue(ctx, "uploadLimits", handlers.UploadLimits{
+		MaxRequestSize:  int64(viper.GetInt("server.max_request_size")),
+		MaxMetadataSize: int64(viper.GetInt("server.max_metadata_size")),
+		MaxParts:        viper.GetInt("server.max_parts"),
+	})
+
+	ac, err := accessController()
+	if err != nil {
+		logrus.Fatal("Error configuring auth: ", err.Error())
+		return
+	}
+	reloadableAC := access.NewReloadableController(ac)
+
+	tlsConfig, reloader, err := serverTLS()
+	if err != nil {
+		logrus.Fatal("Error configuring TLS: ", err.Error())
+		return
+	}
+
+	utils.OnSIGHUP(func() {
+		logrus.Info("Received SIGHUP, reloading configuration")
+		if err := viper.ReadInConfig(); err != nil {
+			logrus.Error("Unable to reread configuration: ", err.Error())
+			return
+		}
+		setLogLevel()
+		if ac, err := accessController(); err != nil {
+			logrus.Error("Unable to reload auth configuration: ", err.Error())
+		} else {
+			reloadableAC.Set(ac)
+		}
+		if reloader != nil {
+			if err := reloader.Reload(); err != nil {
+				logrus.Error("Unable to reload TLS certificate: ", err.Error())
+			}
+		}
+	})
+
 	logrus.Info("Starting Server")
 	err = server.Run(
 		ctx,
 		viper.GetString("server.addr"),
-		viper.GetString("server.tls_cert_file"),
-		viper.GetString("server.tls_key_file"),
+		tlsConfig,
 		trust,
+		reloadableAC,
+	)
+	if err != nil {
+		logrus.Error(err.Error())
+	}
+
+	if db != nil {
+		if err := db.Close(); err != nil {
+			logrus.Error("Error closing DB: ", err.Error())
+		}
+	}
+	logrus.Info("Server stopped")
+}
+
+func setLogLevel() {
+	lvl, err := logrus.ParseLevel(viper.GetString("logging.level"))
+	if err != nil {
+		lvl = logrus.ErrorLevel
+		logrus.Error("Could not parse log level from config. Defaulting to ErrorLevel")
+	}
+	logrus.SetLevel(lvl)
+}
+
+// accessController creates the access controller described by the auth
+// section
+func accessController() (auth.AccessController, error) {
+	return access.NewAccessController(
 		viper.GetString("auth.type"),
 		viper.Get("auth.options"),
+		viper.GetString("auth.policy_file"),
 	)
+}
+
+// serverTLS builds the TLS configuration from the server section, or
+// returns nil if no certificate is configured
+func serverTLS() (*tls.Config, *utils.CertificateReloader, error) {
+	certFile := viper.GetString("server.tls_cert_file")
+	keyFile := viper.GetString("server.tls_key_file")
+	if certFile == "" && keyFile == "" {
+		return nil, nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, nil, fmt.Errorf("Partial TLS configuration found. Either include both a cert and key file in the configuration, or include neither to disable TLS.")
+	}
+	return utils.ConfigureServerTLS(&utils.ServerTLSOpts{
+		ServerCertFile: certFile,
+		ServerKeyFile:  keyFile,
+		ClientCAFile:   viper.GetString("server.tls_client_ca_file"),
+		ClientAuth:     viper.GetString("server.tls_client_auth"),
+		MinVersion:     viper.GetString("server.tls_min_version"),
+		CipherSuites:   viper.GetStringSlice("server.tls_cipher_suites"),
+	})
+}
+
+// newMirror creates the mirror.Mirror described by the mirror section,
+// replicating into store
+func newMirror(store storage.MetaStore) (*mirror.Mirror, error) {
+	var config mirror.Config
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		WeaklyTypedInput: true,
+		Result:           &config,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := decoder.Decode(viper.Get("mirror")); err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{}
+	if caFile := viper.GetString("mirror.tls_ca_file"); caFile != "" {
+		pemBytes, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pemBytes) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+	}
+	return mirror.NewMirror(config, store, &http.Transport{TLSClientConfig: tlsConfig})
+}
+
+// targetsPolicy creates the policy.Engine enforcing the rules in the
+// targets_policy section
+func targetsPolicy() (*policy.Engine, error) {
+	var configs []policy.Config
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		WeaklyTypedInput: true,
+		Result:           &configs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := decoder.Decode(viper.Get("targets_policy")); err != nil {
+		return nil, err
+	}
+	return policy.NewEngine(configs)
+}
+
+// eventBroker creates the events.Broker that records updates in the
+// changefeed and delivers them to any configured webhooks
+func eventBroker() (*events.Broker, error) {
+	var webhookConfigs []events.WebhookConfig
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		WeaklyTypedInput: true,
+		Result:           &webhookConfigs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := decoder.Decode(viper.Get("events.webhooks")); err != nil {
+		return nil, err
+	}
+	webhooks := make([]*events.Webhook, 0, len(webhookConfigs))
+	for _, config := range webhookConfigs {
+		if config.URL == "" {
+			return nil, fmt.Errorf("webhooks must have a url")
+		}
+		logrus.Info("Delivering events to ", config.URL)
+		webhooks = append(webhooks, events.NewWebhook(config))
+	}
+	return events.NewBroker(events.NewFeed(viper.GetInt("events.feed_size")), webhooks...), nil
+}
+
+// runExport implements the export command, writing the trust data for the
+// GUNs in args, or every GUN, to a directory for static hosting
+func runExport(store storage.MetaStore, trust signed.CryptoService, mirroring bool, args []string) error {
+	// the local signing service is created empty on every start and holds
+	// none of the timestamp keys the server generated
+	if !mirroring && viper.GetString("trust_service.type") != "remote" {
+		return fmt.Errorf("exporting requires a remote trust_service to sign timestamps")
+	}
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	dir := flags.String("dir", "./export", "Directory to write the trust data to")
+	flags.Parse(args)
+
+	return export.Export(export.Options{
+		Dir:  *dir,
+		GUNs: flags.Args(),
+	}, store, trust)
+}
+
+// newCollector creates the gc.Collector enforcing the retention policy in
+// the storage section
+func newCollector(store storage.MetaStore) (*gc.Collector, error) {
+	var config gc.Config
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		WeaklyTypedInput: true,
+		Result:           &config,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := decoder.Decode(viper.Get("storage.retention")); err != nil {
+		return nil, err
+	}
+	return gc.NewCollector(config, store)
+}
 
-	logrus.Error(err.Error())
-	return
+// runGC implements the gc command, deleting the old metadata the retention
+// policy no longer keeps
+func runGC(store storage.MetaStore) error {
+	if !viper.IsSet("storage.retention") {
+		return fmt.Errorf("no retention policy configured")
+	}
+	collector, err := newCollector(store)
+	if err != nil {
+		return err
+	}
+	pruned, err := collector.Collect()
+	fmt.Printf("Deleted %d old metadata versions\n", pruned)
+	return err
 }
 
 func usage() {
-	fmt.Println("usage:", os.Args[0])
+	fmt.Println("usage:", os.Args[0], "[options]")
+	fmt.Println("      ", os.Args[0], "[options] export [-dir DIR] [GUN...]")
+	fmt.Println("      ", os.Args[0], "[options] gc")
 	flag.PrintDefaults()
 }
 
@@ -159,3 +480,12 @@ func debugServer(addr string) {
 		logrus.Fatal("error listening on debug interface: ", err)
 	}
 }
+
+// metricsServer serves the Prometheus metrics on /metrics at addr, which is
+// separate from the debug server so that it can be exposed to a scraper
+func metricsServer(addr string) {
+	logrus.Info("Metrics server listening on ", addr)
+	if err := metrics.ListenAndServe(addr); err != nil {
+		logrus.Fatal("error listening on metrics interface: ", err)
+	}
+}
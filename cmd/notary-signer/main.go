@@ -1,7 +1,6 @@
 package main
 
 import (
-	"crypto/rand"
 	"crypto/tls"
 	"database/sql"
 	"errors"
@@ -13,14 +12,18 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 
 	_ "github.com/docker/distribution/health"
 	"github.com/docker/notary/cryptoservice"
+	"github.com/docker/notary/pkg/metrics"
 	"github.com/docker/notary/signer"
 	"github.com/docker/notary/signer/api"
+	"github.com/docker/notary/utils"
 	"github.com/docker/notary/version"
 	"github.com/endophage/gotuf/data"
 	_ "github.com/go-sql-driver/mysql"
@@ -37,6 +40,10 @@ const (
 	envPrefix       = "NOTARY_SIGNER"
 	defaultAliasEnv = "DEFAULT_ALIAS"
 	pinCode         = "PIN"
+
+	// healthCheckPeriod is how often the health checks are run, requests
+	// to the health endpoint are answered with the latest results
+	healthCheckPeriod = 10 * time.Second
 )
 
 var debug bool
@@ -92,6 +99,10 @@ func main() {
 
 	logrus.SetLevel(logrus.Level(viper.GetInt("logging.level")))
 
+	if addr := viper.GetString("metrics.addr"); addr != "" {
+		go metricsServer(addr)
+	}
+
 	certFile := viper.GetString("server.cert_file")
 	keyFile := viper.GetString("server.key_file")
 	if certFile == "" || keyFile == "" {
@@ -99,22 +110,25 @@ func main() {
 		log.Fatalf("Certificate and key are mandatory")
 	}
 
-	tlsConfig := &tls.Config{
-		MinVersion:               tls.VersionTLS12,
-		PreferServerCipherSuites: true,
-		CipherSuites: []uint16{
-			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
-			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
-			tls.TLS_RSA_WITH_AES_128_CBC_SHA,
-			tls.TLS_RSA_WITH_AES_256_CBC_SHA},
+	tlsConfig, reloader, err := utils.ConfigureServerTLS(&utils.ServerTLSOpts{
+		ServerCertFile: certFile,
+		ServerKeyFile:  keyFile,
+		ClientCAFile:   viper.GetString("server.tls_client_ca_file"),
+		ClientAuth:     viper.GetString("server.tls_client_auth"),
+		MinVersion:     viper.GetString("server.tls_min_version"),
+		CipherSuites:   viper.GetStringSlice("server.tls_cipher_suites"),
+	})
+	if err != nil {
+		log.Fatalf("Unable to configure TLS: %v", err)
 	}
-	tlsConfig.Rand = rand.Reader
+	utils.OnSIGHUP(func() {
+		if err := reloader.Reload(); err != nil {
+			logrus.Error("Unable to reload TLS certificate: ", err.Error())
+		}
+	})
 
 	cryptoServices := make(signer.CryptoServiceIndex)
+	healthChecks := utils.NewHealthChecks()
 
 	pin := viper.GetString(pinCode)
 	pkcs11Lib := viper.GetString("crypto.pkcs11lib")
@@ -128,6 +142,11 @@ func main() {
 		defer cleanup(ctx, session)
 
 		cryptoServices[data.RSAKey] = api.NewRSAHardwareCryptoService(ctx, session)
+
+		healthChecks.RegisterPeriodicFunc(context.Background(), "hsm", func() error {
+			_, err := ctx.GetSessionInfo(session)
+			return err
+		}, healthCheckPeriod)
 	}
 
 	configDBType := strings.ToLower(viper.GetString("storage.backend"))
@@ -147,6 +166,8 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to create a new keydbstore: %v", err)
 	}
+	healthChecks.RegisterPeriodicFunc(context.Background(), "key_storage", keyStore.CheckHealth, healthCheckPeriod)
+
 	cryptoService := cryptoservice.NewCryptoService("", keyStore)
 
 	cryptoServices[data.ED25519Key] = cryptoService
@@ -165,10 +186,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to listen %v", err)
 	}
-	creds, err := credentials.NewServerTLSFromFile(certFile, keyFile)
-	if err != nil {
-		log.Fatalf("failed to generate credentials %v", err)
-	}
+	creds := credentials.NewTLS(tlsConfig)
 	go grpcServer.Serve(creds.NewListener(lis))
 
 	httpAddr := viper.GetString("server.http_addr")
@@ -176,9 +194,11 @@ func main() {
 		log.Fatalf("Server address is required")
 	}
 	//HTTP server setup
+	router := api.Handlers(cryptoServices)
+	router.Methods("GET").Path("/_notary_signer/health").Handler(healthChecks)
 	server := http.Server{
 		Addr:      httpAddr,
-		Handler:   api.Handlers(cryptoServices),
+		Handler:   router,
 		TLSConfig: tlsConfig,
 	}
 
@@ -187,7 +207,13 @@ func main() {
 		log.Println("HTTP server listening on", httpAddr)
 	}
 
-	err = server.ListenAndServeTLS(certFile, keyFile)
+	// serve from a listener rather than ListenAndServeTLS, which would load
+	// the certificate itself and bypass the reloader
+	httpLis, err := net.Listen("tcp", httpAddr)
+	if err != nil {
+		log.Fatalf("failed to listen %v", err)
+	}
+	err = server.Serve(tls.NewListener(httpLis, tlsConfig))
 	if err != nil {
 		log.Fatal("HTTP server failed to start:", err)
 	}
@@ -208,6 +234,15 @@ func debugServer(addr string) {
 	}
 }
 
+// metricsServer serves the Prometheus metrics on /metrics at addr, which is
+// separate from the debug server so that it can be exposed to a scraper
+func metricsServer(addr string) {
+	logrus.Info("Metrics server listening on ", addr)
+	if err := metrics.ListenAndServe(addr); err != nil {
+		log.Fatalf("error listening on metrics interface: %v", err)
+	}
+}
+
 // SetupHSMEnv is a method that depends on the existences
 func SetupHSMEnv(libraryPath, pin string) (*pkcs11.Ctx, pkcs11.SessionHandle) {
 	p := pkcs11.New(libraryPath)
@@ -124,7 +124,7 @@ func keysRemoveKey(cmd *cobra.Command, args []string) {
 	}
 
 	// Choose the correct filestore to remove the key from
-	var keyStoreToRemove *trustmanager.KeyFileStore
+	var keyStoreToRemove trustmanager.KeyStore
 	var keyMap map[string]string
 	if keyRemoveRoot {
 		keyStoreToRemove = keyStoreManager.RootKeyStore()
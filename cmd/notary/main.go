@@ -21,8 +21,10 @@ const defaultServerURL = "https://notary-server:4443"
 const idSize = 64
 
 var rawOutput bool
+var historyFrom int
 var trustDir string
 var remoteTrustServer string
+var offline bool
 var verbose bool
 var retriever passphrase.Retriever
 
@@ -99,6 +101,7 @@ func main() {
 	notaryCmd.AddCommand(cmdTufList)
 	cmdTufList.Flags().BoolVarP(&rawOutput, "raw", "", false, "Instructs notary list to output a nonpretty printed version of the targets list. Useful if you need to parse the list.")
 	cmdTufList.Flags().StringVarP(&remoteTrustServer, "server", "s", defaultServerURL, "Remote trust server location")
+	cmdTufList.Flags().BoolVarP(&offline, "offline", "", false, "Only use trust data cached by an earlier online command")
 	notaryCmd.AddCommand(cmdTufAdd)
 	notaryCmd.AddCommand(cmdTufRemove)
 	notaryCmd.AddCommand(cmdTufPublish)
@@ -106,7 +109,12 @@ func main() {
 	notaryCmd.AddCommand(cmdTufLookup)
 	cmdTufLookup.Flags().BoolVarP(&rawOutput, "raw", "", false, "Instructs notary lookup to output a nonpretty printed version of the targets list. Useful if you need to parse the list.")
 	cmdTufLookup.Flags().StringVarP(&remoteTrustServer, "server", "s", defaultServerURL, "Remote trust server location")
+	cmdTufLookup.Flags().BoolVarP(&offline, "offline", "", false, "Only use trust data cached by an earlier online command")
+	notaryCmd.AddCommand(cmdTufHistory)
+	cmdTufHistory.Flags().IntVarP(&historyFrom, "from", "", 0, "Only show changes made after this version of the targets")
+	cmdTufHistory.Flags().StringVarP(&remoteTrustServer, "server", "s", defaultServerURL, "Remote trust server location")
 	notaryCmd.AddCommand(cmdVerify)
+	cmdVerify.Flags().BoolVarP(&offline, "offline", "", false, "Only use trust data cached by an earlier online command")
 
 	notaryCmd.Execute()
 }
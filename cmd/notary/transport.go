@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	notaryclient "github.com/docker/notary/client"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// remoteServerConfig holds the settings used to connect to a notary server.
+// They are read from the remote_server section of the config, and can be
+// overridden for a specific server URL in the remote_servers section.
+type remoteServerConfig struct {
+	rootCA        string
+	tlsClientCert string
+	tlsClientKey  string
+	pins          []string
+}
+
+func getRemoteServerConfig(serverURL string) remoteServerConfig {
+	config := remoteServerConfig{
+		rootCA:        viper.GetString("remote_server.root_ca"),
+		tlsClientCert: viper.GetString("remote_server.tls_client_cert"),
+		tlsClientKey:  viper.GetString("remote_server.tls_client_key"),
+		pins:          stringList(viper.Get("remote_server.server_pin_sha256")),
+	}
+	for u, raw := range viper.GetStringMap("remote_servers") {
+		if !strings.EqualFold(strings.TrimRight(u, "/"), strings.TrimRight(serverURL, "/")) {
+			continue
+		}
+		// YAML decodes nested objects as map[interface{}]interface{}
+		override, err := cast.ToStringMapE(raw)
+		if err != nil {
+			fatalf("remote_servers.%s must be an object", u)
+		}
+		if v, ok := override["root_ca"].(string); ok {
+			config.rootCA = v
+		}
+		if v, ok := override["tls_client_cert"].(string); ok {
+			config.tlsClientCert = v
+		}
+		if v, ok := override["tls_client_key"].(string); ok {
+			config.tlsClientKey = v
+		}
+		if v, ok := override["server_pin_sha256"]; ok {
+			config.pins = stringList(v)
+		}
+	}
+	return config
+}
+
+// stringList accepts either a single string or a list of strings
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func getTransport() http.RoundTripper {
+	config := getRemoteServerConfig(remoteTrustServer)
+
+	tlsConfig := &tls.Config{}
+	if viper.GetBool("skipTLSVerify") {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	if config.rootCA != "" {
+		pemBytes, err := ioutil.ReadFile(config.rootCA)
+		if err != nil {
+			fatalf("unable to read root CA: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pemBytes) {
+			fatalf("no certificates found in %s", config.rootCA)
+		}
+	}
+	if config.tlsClientCert != "" || config.tlsClientKey != "" {
+		keypair, err := tls.LoadX509KeyPair(config.tlsClientCert, config.tlsClientKey)
+		if err != nil {
+			fatalf("unable to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{keypair}
+	}
+	transport := &http.Transport{TLSClientConfig: tlsConfig}
+	if len(config.pins) > 0 {
+		transport.DialTLS = notaryclient.PinnedDialTLS(tlsConfig, serverAddr(remoteTrustServer), config.pins)
+	}
+
+	creds := getCredentials()
+	if creds == nil {
+		return transport
+	}
+	return notaryclient.NewAuthTransport(transport, creds, viper.GetStringSlice("auth.token_hosts")...)
+}
+
+// serverAddr returns the host:port a server URL is dialed on
+func serverAddr(serverURL string) string {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		fatalf("invalid server URL %s: %v", serverURL, err)
+	}
+	if _, _, err := net.SplitHostPort(u.Host); err == nil {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Host, "443")
+}
+
+// getCredentials returns the credentials configured in the auth section,
+// or nil if there are none
+func getCredentials() notaryclient.Credentials {
+	if helper := viper.GetString("auth.credential_helper"); helper != "" {
+		return notaryclient.NewCredentialHelper(helper)
+	}
+	creds := notaryclient.StaticCredentials{
+		Username:    viper.GetString("auth.username"),
+		Password:    viper.GetString("auth.password"),
+		BearerToken: viper.GetString("auth.token"),
+	}
+	if creds.Username == "" && creds.BearerToken == "" {
+		return nil
+	}
+	return creds
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+const jsonConfig = `{
+    "remote_server": {
+        "root_ca": "/etc/ssl/default-ca.pem",
+        "server_pin_sha256": "defaultpin"
+    },
+    "remote_servers": {
+        "https://notary.internal:4443/": {
+            "tls_client_cert": "/home/alice/alice.crt",
+            "tls_client_key": "/home/alice/alice.key",
+            "server_pin_sha256": ["pin1", "pin2"]
+        }
+    }
+}`
+
+const yamlConfig = `
+remote_server:
+  root_ca: /etc/ssl/default-ca.pem
+  server_pin_sha256: defaultpin
+remote_servers:
+  "https://notary.internal:4443/":
+    tls_client_cert: /home/alice/alice.crt
+    tls_client_key: /home/alice/alice.key
+    server_pin_sha256:
+      - pin1
+      - pin2
+`
+
+func readConfig(t *testing.T, configType, config string) {
+	viper.Reset()
+	viper.SetConfigType(configType)
+	if err := viper.ReadConfig(bytes.NewBufferString(config)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoteServerConfigOverride(t *testing.T) {
+	defer viper.Reset()
+	for configType, config := range map[string]string{"json": jsonConfig, "yaml": yamlConfig} {
+		readConfig(t, configType, config)
+
+		// the trailing slash and case of the URL don't matter
+		assert.Equal(t, remoteServerConfig{
+			rootCA:        "/etc/ssl/default-ca.pem",
+			tlsClientCert: "/home/alice/alice.crt",
+			tlsClientKey:  "/home/alice/alice.key",
+			pins:          []string{"pin1", "pin2"},
+		}, getRemoteServerConfig("https://Notary.Internal:4443"), configType)
+
+		assert.Equal(t, remoteServerConfig{
+			rootCA: "/etc/ssl/default-ca.pem",
+			pins:   []string{"defaultpin"},
+		}, getRemoteServerConfig("https://notary.example.com"), configType)
+	}
+}
+
+func TestStringList(t *testing.T) {
+	assert.Equal(t, []string{"a"}, stringList("a"))
+	assert.Equal(t, []string{"a", "b"}, stringList([]string{"a", "b"}))
+	assert.Equal(t, []string{"a", "b"}, stringList([]interface{}{"a", 1, "b"}))
+	assert.Nil(t, stringList(nil))
+}
+
+func TestServerAddr(t *testing.T) {
+	assert.Equal(t, "notary.example.com:443", serverAddr("https://notary.example.com"))
+	assert.Equal(t, "notary.example.com:4443", serverAddr("https://notary.example.com:4443/"))
+}
@@ -2,18 +2,16 @@ package main
 
 import (
 	"crypto/sha256"
-	"crypto/tls"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"os"
+	"time"
 
 	"crypto/subtle"
 
 	"github.com/Sirupsen/logrus"
 	notaryclient "github.com/docker/notary/client"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var cmdTufList = &cobra.Command{
@@ -58,6 +56,13 @@ var cmdTufPublish = &cobra.Command{
 	Run:   tufPublish,
 }
 
+var cmdTufHistory = &cobra.Command{
+	Use:   "history [ GUN ]",
+	Short: "Shows the history of changes to a trusted collection.",
+	Long:  "shows the targets added, removed and modified in each published version of the trusted collection identified by the Globally Unique Name.",
+	Run:   tufHistory,
+}
+
 var cmdVerify = &cobra.Command{
 	Use:   "verify [ GUN ] <target>",
 	Short: "verifies if the content is included in the trusted collection",
@@ -149,11 +154,14 @@ func tufList(cmd *cobra.Command, args []string) {
 		fatalf(err.Error())
 	}
 
+	nRepo.Offline = offline
+
 	// Retreive the remote list of signed targets
 	targetList, err := nRepo.ListTargets()
 	if err != nil {
 		fatalf(err.Error())
 	}
+	reportCacheStatus(nRepo)
 
 	// Print all the available targets
 	for _, t := range targetList {
@@ -161,6 +169,29 @@ func tufList(cmd *cobra.Command, args []string) {
 	}
 }
 
+func tufHistory(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		cmd.Usage()
+		fatalf("must specify a GUN")
+	}
+	gun := args[0]
+	parseConfig()
+
+	nRepo, err := notaryclient.NewNotaryRepository(trustDir, gun, remoteTrustServer, getTransport(), retriever)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	changes, _, err := nRepo.GetChanges(historyFrom)
+	if err != nil {
+		fatalf(err.Error())
+	}
+
+	for _, c := range changes {
+		fmt.Printf("%d %s %s %s\n", c.Version, c.Time.Format(time.RFC3339), c.Change, c.Target)
+	}
+}
+
 func tufLookup(cmd *cobra.Command, args []string) {
 	if len(args) < 2 {
 		cmd.Usage()
@@ -175,10 +206,13 @@ func tufLookup(cmd *cobra.Command, args []string) {
 		fatalf(err.Error())
 	}
 
+	nRepo.Offline = offline
+
 	target, err := nRepo.GetTargetByName(targetName)
 	if err != nil {
 		fatalf(err.Error())
 	}
+	reportCacheStatus(nRepo)
 
 	fmt.Println(target.Name, fmt.Sprintf("sha256:%x", target.Hashes["sha256"]), target.Length)
 }
@@ -247,11 +281,14 @@ func verify(cmd *cobra.Command, args []string) {
 		fatalf(err.Error())
 	}
 
+	nRepo.Offline = offline
+
 	target, err := nRepo.GetTargetByName(targetName)
 	if err != nil {
 		logrus.Error("notary: data not present in the trusted collection.")
 		os.Exit(-11)
 	}
+	reportCacheStatus(nRepo)
 
 	// Create hasher and hash data
 	stdinHash := sha256.Sum256(payload)
@@ -266,13 +303,20 @@ func verify(cmd *cobra.Command, args []string) {
 	return
 }
 
-func getTransport() *http.Transport {
-	if viper.GetBool("skipTLSVerify") {
-		return &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-		}
+// reportCacheStatus tells the user, on stderr, how old the trust data read
+// in offline mode is
+func reportCacheStatus(nRepo *notaryclient.NotaryRepository) {
+	if !nRepo.Offline {
+		return
+	}
+	status, err := nRepo.GetCacheStatus()
+	if err != nil {
+		return
+	}
+	fetched := "at an unknown time"
+	if !status.Fetched.IsZero() {
+		fetched = fmt.Sprintf("%s ago", status.Age()/time.Second*time.Second)
 	}
-	return &http.Transport{}
+	fmt.Fprintf(os.Stderr, "Offline: using trust data fetched %s, valid until %s\n",
+		fetched, status.Expires.Format(time.RFC3339))
 }
@@ -74,5 +74,95 @@ var (
 		Description:    "No key algorihtm has been configured for the server and it has been asked to perform an operation that requires generation.",
 		HTTPStatusCode: http.StatusInternalServerError,
 	})
+	ErrInvalidParameter = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "INVALID_PARAMETER",
+		Message:        "A query parameter in your request is invalid.",
+		Description:    "The user provided a query parameter that could not be parsed or is out of range.",
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+	ErrNoEventFeed = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "NO_EVENTFEED",
+		Message:        "The server does not have an event feed configured.",
+		Description:    "No event feed has been configured for the server and it has been asked to list changes.",
+		HTTPStatusCode: http.StatusInternalServerError,
+	})
+	ErrInvalidCursor = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "INVALID_CURSOR",
+		Message:        "The changefeed cursor has expired or is unknown to the server.",
+		Description:    "The events following the cursor have been evicted from the changefeed, or the cursor was issued by another server or before the server restarted. The client should resynchronize, then poll the changefeed without a cursor.",
+		HTTPStatusCode: http.StatusGone,
+	})
+	ErrAccessDenied = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "ACCESS_DENIED",
+		Message:        "You do not have access to the requested action.",
+		Description:    "The user was authenticated but the access policy does not allow them to perform the requested action on the GUN.",
+		HTTPStatusCode: http.StatusForbidden,
+	})
+	ErrDuplicateRole = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "DUPLICATE_ROLE",
+		Message:        "The update contains more than one copy of a role.",
+		Description:    "The user uploaded an update in which the same role appears in more than one part.",
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+	ErrUnexpectedRole = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "UNEXPECTED_ROLE",
+		Message:        "The update contains a role that cannot be uploaded.",
+		Description:    "The user uploaded a role, such as the timestamp, that the server does not accept from clients.",
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+	ErrUploadTooLarge = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "UPLOAD_TOO_LARGE",
+		Message:        "The update is larger than the server allows.",
+		Description:    "The body of the update, or the metadata for one of its roles, exceeds the size limit configured on the server.",
+		HTTPStatusCode: http.StatusRequestEntityTooLarge,
+	})
+	ErrTooManyParts = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "TOO_MANY_PARTS",
+		Message:        "The update contains more roles than the server allows.",
+		Description:    "The number of roles in the update, including delegations, exceeds the limit configured on the server.",
+		HTTPStatusCode: http.StatusRequestEntityTooLarge,
+	})
+	ErrPolicyViolation = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "POLICY_VIOLATION",
+		Message:        "The targets in the update violate the server's policy.",
+		Description:    "The update was correctly signed, but the targets it contains break one or more of the rules configured for the GUN. The detail lists every violation.",
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+	ErrBadHierarchy = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "BAD_HIERARCHY",
+		Message:        "The update is missing roles it depends on.",
+		Description:    "The update does not contain the roles required alongside the ones being changed, for example a new snapshot.",
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+	ErrBadRoot = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "BAD_ROOT",
+		Message:        "The root in the update is invalid.",
+		Description:    "The root could not be parsed, is not correctly signed, or is not signed by the keys of the previous root.",
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+	ErrBadTargets = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "BAD_TARGETS",
+		Message:        "The targets in the update are invalid.",
+		Description:    "The targets could not be parsed or are not signed by the keys the root delegates to.",
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+	ErrBadSnapshot = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "BAD_SNAPSHOT",
+		Message:        "The snapshot in the update is invalid.",
+		Description:    "The snapshot could not be parsed, is not correctly signed, or does not match the other roles in the update.",
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+	ErrVersionConflict = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "VERSION_CONFLICT",
+		Message:        "A newer version of the metadata already exists.",
+		Description:    "Another update was published first. The client should fetch the latest metadata and publish again.",
+		HTTPStatusCode: http.StatusConflict,
+	})
+	ErrReadOnly = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:          "READ_ONLY",
+		Message:        "The server is a read-only mirror.",
+		Description:    "The server mirrors metadata from another notary-server and does not accept updates or create timestamp keys. Publish to the upstream server instead.",
+		HTTPStatusCode: http.StatusMethodNotAllowed,
+	})
 	ErrUnknown = errcode.ErrorCodeUnknown
 )
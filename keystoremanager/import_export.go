@@ -33,12 +33,34 @@ var (
 	// ErrNoKeysFoundForGUN is returned if no keys are found for the
 	// specified GUN during export
 	ErrNoKeysFoundForGUN = errors.New("no keys found for specified GUN")
+
+	// ErrKeyStoreNotOnDisk is returned when importing or exporting keys
+	// with a KeyStoreManager whose key stores are not KeyFileStores
+	ErrKeyStoreNotOnDisk = errors.New("keys can only be imported and exported with key stores on disk")
 )
 
+// fileKeyStores returns the root and non-root key stores, which import and
+// export read and write as files
+func (km *KeyStoreManager) fileKeyStores() (*trustmanager.KeyFileStore, *trustmanager.KeyFileStore, error) {
+	rootKeyStore, ok := km.rootKeyStore.(*trustmanager.KeyFileStore)
+	if !ok {
+		return nil, nil, ErrKeyStoreNotOnDisk
+	}
+	nonRootKeyStore, ok := km.nonRootKeyStore.(*trustmanager.KeyFileStore)
+	if !ok {
+		return nil, nil, ErrKeyStoreNotOnDisk
+	}
+	return rootKeyStore, nonRootKeyStore, nil
+}
+
 // ExportRootKey exports the specified root key to an io.Writer in PEM format.
 // The key's existing encryption is preserved.
 func (km *KeyStoreManager) ExportRootKey(dest io.Writer, keyID string) error {
-	pemBytes, err := km.rootKeyStore.Get(keyID + "_root")
+	rootKeyStore, _, err := km.fileKeyStores()
+	if err != nil {
+		return err
+	}
+	pemBytes, err := rootKeyStore.Get(keyID + "_root")
 	if err != nil {
 		return err
 	}
@@ -109,7 +131,11 @@ func (km *KeyStoreManager) ImportRootKey(source io.Reader, keyID string) error {
 		return err
 	}
 
-	if err = km.rootKeyStore.Add(keyID+"_root", pemBytes); err != nil {
+	rootKeyStore, _, err := km.fileKeyStores()
+	if err != nil {
+		return err
+	}
+	if err = rootKeyStore.Add(keyID+"_root", pemBytes); err != nil {
 		return err
 	}
 
@@ -210,6 +236,11 @@ func addKeysToArchive(zipWriter *zip.Writer, newKeyStore *trustmanager.KeyFileSt
 // ExportAllKeys exports all keys to an io.Writer in zip format.
 // newPassphraseRetriever will be used to obtain passphrases to use to encrypt the existing keys.
 func (km *KeyStoreManager) ExportAllKeys(dest io.Writer, newPassphraseRetriever passphrase.Retriever) error {
+	rootKeyStore, nonRootKeyStore, err := km.fileKeyStores()
+	if err != nil {
+		return err
+	}
+
 	tempBaseDir, err := ioutil.TempDir("", "notary-key-export-")
 	defer os.RemoveAll(tempBaseDir)
 
@@ -229,10 +260,10 @@ func (km *KeyStoreManager) ExportAllKeys(dest io.Writer, newPassphraseRetriever
 		return err
 	}
 
-	if err := moveKeys(km.rootKeyStore, tempRootKeyStore); err != nil {
+	if err := moveKeys(rootKeyStore, tempRootKeyStore); err != nil {
 		return err
 	}
-	if err := moveKeys(km.nonRootKeyStore, tempNonRootKeyStore); err != nil {
+	if err := moveKeys(nonRootKeyStore, tempNonRootKeyStore); err != nil {
 		return err
 	}
 
@@ -260,6 +291,11 @@ func IsZipSymlink(f *zip.File) bool {
 // keys in the root_keys directory are left encrypted, but the other keys are
 // decrypted with the specified passphrase.
 func (km *KeyStoreManager) ImportKeysZip(zipReader zip.Reader) error {
+	rootKeyStore, nonRootKeyStore, err := km.fileKeyStores()
+	if err != nil {
+		return err
+	}
+
 	// Temporarily store the keys in maps, so we can bail early if there's
 	// an error (for example, wrong passphrase), without leaving the key
 	// store in an inconsistent state
@@ -290,7 +326,7 @@ func (km *KeyStoreManager) ImportKeysZip(zipReader zip.Reader) error {
 		// package guarantees that the separator will be /
 		if strings.HasPrefix(fNameTrimmed, rootKeysPrefix) {
 			if IsZipSymlink(f) {
-				newName := filepath.Join(km.rootKeyStore.BaseDir(), strings.TrimPrefix(f.Name, rootKeysPrefix))
+				newName := filepath.Join(rootKeyStore.BaseDir(), strings.TrimPrefix(f.Name, rootKeysPrefix))
 				err = os.Symlink(string(fileBytes), newName)
 				if err != nil {
 					return err
@@ -306,7 +342,7 @@ func (km *KeyStoreManager) ImportKeysZip(zipReader zip.Reader) error {
 			}
 		} else if strings.HasPrefix(fNameTrimmed, nonRootKeysPrefix) {
 			if IsZipSymlink(f) {
-				newName := filepath.Join(km.nonRootKeyStore.BaseDir(), strings.TrimPrefix(f.Name, nonRootKeysPrefix))
+				newName := filepath.Join(nonRootKeyStore.BaseDir(), strings.TrimPrefix(f.Name, nonRootKeysPrefix))
 				err = os.Symlink(string(fileBytes), newName)
 				if err != nil {
 					return err
@@ -330,13 +366,13 @@ func (km *KeyStoreManager) ImportKeysZip(zipReader zip.Reader) error {
 	}
 
 	for keyName, pemBytes := range newRootKeys {
-		if err := km.rootKeyStore.Add(keyName, pemBytes); err != nil {
+		if err := rootKeyStore.Add(keyName, pemBytes); err != nil {
 			return err
 		}
 	}
 
 	for keyName, pemBytes := range newNonRootKeys {
-		if err := km.nonRootKeyStore.Add(keyName, pemBytes); err != nil {
+		if err := nonRootKeyStore.Add(keyName, pemBytes); err != nil {
 			return err
 		}
 	}
@@ -370,6 +406,11 @@ func moveKeysByGUN(oldKeyStore, newKeyStore *trustmanager.KeyFileStore, gun stri
 // io.Writer in zip format. passphraseRetriever is used to select new passphrases to use to
 // encrypt the keys.
 func (km *KeyStoreManager) ExportKeysByGUN(dest io.Writer, gun string, passphraseRetriever passphrase.Retriever) error {
+	_, nonRootKeyStore, err := km.fileKeyStores()
+	if err != nil {
+		return err
+	}
+
 	tempBaseDir, err := ioutil.TempDir("", "notary-key-export-")
 	defer os.RemoveAll(tempBaseDir)
 
@@ -382,7 +423,7 @@ func (km *KeyStoreManager) ExportKeysByGUN(dest io.Writer, gun string, passphras
 		return err
 	}
 
-	if err := moveKeysByGUN(km.nonRootKeyStore, tempNonRootKeyStore, gun); err != nil {
+	if err := moveKeysByGUN(nonRootKeyStore, tempNonRootKeyStore, gun); err != nil {
 		return err
 	}
 
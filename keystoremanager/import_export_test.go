@@ -179,8 +179,8 @@ func TestImportExportZip(t *testing.T) {
 	// Look for symlinks in the new repo matching symlinks in the old repo
 	numSymlinks := 0
 
-	oldRootKeyStore := repo.KeyStoreManager.RootKeyStore()
-	newRootKeyStore := repo2.KeyStoreManager.RootKeyStore()
+	oldRootKeyStore := repo.KeyStoreManager.RootKeyStore().(*trustmanager.KeyFileStore)
+	newRootKeyStore := repo2.KeyStoreManager.RootKeyStore().(*trustmanager.KeyFileStore)
 
 	for _, relKeyPath := range oldRootKeyStore.ListFiles(true) {
 		fullKeyPath := filepath.Join(oldRootKeyStore.BaseDir(), relKeyPath)
@@ -20,8 +20,8 @@ import (
 // KeyStoreManager is an abstraction around the root and non-root key stores,
 // and related CA stores
 type KeyStoreManager struct {
-	rootKeyStore    *trustmanager.KeyFileStore
-	nonRootKeyStore *trustmanager.KeyFileStore
+	rootKeyStore    trustmanager.KeyStore
+	nonRootKeyStore trustmanager.KeyStore
 
 	trustedCAStore          trustmanager.X509Store
 	trustedCertificateStore trustmanager.X509Store
@@ -101,23 +101,32 @@ func NewKeyStoreManager(baseDir string, passphraseRetriever passphrase.Retriever
 		return nil, err
 	}
 
+	return NewKeyStoreManagerFromStores(rootKeyStore, nonRootKeyStore, trustedCAStore, trustedCertificateStore), nil
+}
+
+// NewKeyStoreManagerFromStores returns a KeyStoreManager using the given
+// stores, which need not be on disk. Keys can only be imported and exported
+// if the key stores are KeyFileStores.
+func NewKeyStoreManagerFromStores(rootKeyStore, nonRootKeyStore trustmanager.KeyStore,
+	trustedCAStore, trustedCertificateStore trustmanager.X509Store) *KeyStoreManager {
+
 	return &KeyStoreManager{
 		rootKeyStore:            rootKeyStore,
 		nonRootKeyStore:         nonRootKeyStore,
 		trustedCAStore:          trustedCAStore,
 		trustedCertificateStore: trustedCertificateStore,
-	}, nil
+	}
 }
 
 // RootKeyStore returns the root key store being managed by this
 // KeyStoreManager
-func (km *KeyStoreManager) RootKeyStore() *trustmanager.KeyFileStore {
+func (km *KeyStoreManager) RootKeyStore() trustmanager.KeyStore {
 	return km.rootKeyStore
 }
 
 // NonRootKeyStore returns the non-root key store being managed by this
 // KeyStoreManager
-func (km *KeyStoreManager) NonRootKeyStore() *trustmanager.KeyFileStore {
+func (km *KeyStoreManager) NonRootKeyStore() trustmanager.KeyStore {
 	return km.nonRootKeyStore
 }
 
@@ -170,6 +179,21 @@ func (km *KeyStoreManager) GenRootKey(algorithm string) (string, error) {
 	return privKey.ID(), nil
 }
 
+// LinkRootKey makes the root key with ID rootKeyID available under certKeyID,
+// the ID of the certificate generated for it, so that root metadata signed
+// with the certificate's key ID can find the key. A KeyFileStore links the
+// two; other key stores hold a copy of the key under certKeyID.
+func (km *KeyStoreManager) LinkRootKey(rootKeyID, certKeyID string) error {
+	if fileStore, ok := km.rootKeyStore.(*trustmanager.KeyFileStore); ok {
+		return fileStore.Link(rootKeyID+"_root", certKeyID+"_root")
+	}
+	privKey, alias, err := km.rootKeyStore.GetKey(rootKeyID)
+	if err != nil {
+		return err
+	}
+	return km.rootKeyStore.AddKey(certKeyID, alias, privKey)
+}
+
 // GetRootCryptoService retrieves a root key and a cryptoservice to use with it
 // TODO(mccauley): remove this as its no longer needed once we have key caching in the keystores
 func (km *KeyStoreManager) GetRootCryptoService(rootKeyID string) (*cryptoservice.UnlockedCryptoService, error) {
@@ -211,6 +235,20 @@ adding an extra layer of security over the normal (SSH style) trust model.
 We shall call this: TOFUS.
 */
 func (km *KeyStoreManager) ValidateRoot(root *data.Signed, gun string) error {
+	return km.validateRoot(root, gun, nil)
+}
+
+// ValidateRootSignedBy is ValidateRoot for a root that follows a chain of
+// rotations from the trusted root. Rather than by the trusted certificates,
+// it must be signed by one of keys, the root keys of the root before it,
+// whose own signatures have been verified back to the trusted certificates.
+func (km *KeyStoreManager) ValidateRootSignedBy(root *data.Signed, gun string, keys map[string]data.PublicKey) error {
+	return km.validateRoot(root, gun, keys)
+}
+
+// validateRoot implements ValidateRoot, checking root against prevKeys
+// rather than the trusted certificates if they are given
+func (km *KeyStoreManager) validateRoot(root *data.Signed, gun string, prevKeys map[string]data.PublicKey) error {
 	logrus.Debugf("entered ValidateRoot with dns: %s", gun)
 	signedRoot, err := data.RootFromSigned(root)
 	if err != nil {
@@ -238,7 +276,14 @@ func (km *KeyStoreManager) ValidateRoot(root *data.Signed, gun string) error {
 
 	// If we have certificates that match this specific GUN, let's make sure to
 	// use them first to validate that this new root is valid.
-	if len(certsForCN) != 0 {
+	if prevKeys != nil {
+		logrus.Debugf("validating root for %s against the previous root", gun)
+		err = signed.VerifyRoot(root, 0, prevKeys)
+		if err != nil {
+			logrus.Debugf("failed to verify TUF data for: %s, %v", gun, err)
+			return &ErrValidationFail{Reason: "failed to validate data with the previous root"}
+		}
+	} else if len(certsForCN) != 0 {
 		logrus.Debugf("found %d valid root certificates for %s", len(certsForCN), gun)
 		err = signed.VerifyRoot(root, 0, trustmanager.CertsToKeys(certsForCN))
 		if err != nil {
@@ -265,10 +265,10 @@ func testValidateSuccessfulRootRotation(t *testing.T, keyAlg data.KeyAlgorithm,
 	replRootKey := data.NewPublicKey(rootKeyType, replRootPEMCert)
 
 	// Link both certificates to the original public keys
-	err = keyStoreManager.RootKeyStore().Link(origRootKeyID+"_root", origRootKey.ID()+"_root")
+	err = keyStoreManager.LinkRootKey(origRootKeyID, origRootKey.ID())
 	assert.NoError(t, err)
 
-	err = keyStoreManager.RootKeyStore().Link(replRootKeyID+"_root", replRootKey.ID()+"_root")
+	err = keyStoreManager.LinkRootKey(replRootKeyID, replRootKey.ID())
 	assert.NoError(t, err)
 
 	rootRole, err := data.NewRole("root", 1, []string{replRootKey.ID()}, nil, nil)
@@ -358,10 +358,10 @@ func testValidateRootRotationMissingOrigSig(t *testing.T, keyAlg data.KeyAlgorit
 	replRootKey := data.NewPublicKey(rootKeyType, replRootPEMCert)
 
 	// Link both certificates to the original public keys
-	err = keyStoreManager.RootKeyStore().Link(origRootKeyID+"_root", origRootKey.ID()+"_root")
+	err = keyStoreManager.LinkRootKey(origRootKeyID, origRootKey.ID())
 	assert.NoError(t, err)
 
-	err = keyStoreManager.RootKeyStore().Link(replRootKeyID+"_root", replRootKey.ID()+"_root")
+	err = keyStoreManager.LinkRootKey(replRootKeyID, replRootKey.ID())
 	assert.NoError(t, err)
 
 	rootRole, err := data.NewRole("root", 1, []string{replRootKey.ID()}, nil, nil)
@@ -450,10 +450,10 @@ func testValidateRootRotationMissingNewSig(t *testing.T, keyAlg data.KeyAlgorith
 	replRootKey := data.NewPublicKey(rootKeyType, replRootPEMCert)
 
 	// Link both certificates to the original public keys
-	err = keyStoreManager.RootKeyStore().Link(origRootKeyID+"_root", origRootKey.ID()+"_root")
+	err = keyStoreManager.LinkRootKey(origRootKeyID, origRootKey.ID())
 	assert.NoError(t, err)
 
-	err = keyStoreManager.RootKeyStore().Link(replRootKeyID+"_root", replRootKey.ID()+"_root")
+	err = keyStoreManager.LinkRootKey(replRootKeyID, replRootKey.ID())
 	assert.NoError(t, err)
 
 	rootRole, err := data.NewRole("root", 1, []string{replRootKey.ID()}, nil, nil)
@@ -486,3 +486,30 @@ func testValidateRootRotationMissingNewSig(t *testing.T, keyAlg data.KeyAlgorith
 	assert.Len(t, certs, 1)
 	assert.Equal(t, certs[0], origRootCert)
 }
+
+func TestKeyStoreManagerFromMemoryStores(t *testing.T) {
+	keyStoreManager := NewKeyStoreManagerFromStores(
+		trustmanager.NewKeyMemoryStore(passphraseRetriever),
+		trustmanager.NewKeyMemoryStore(passphraseRetriever),
+		trustmanager.NewX509MemStore(),
+		trustmanager.NewX509MemStore(),
+	)
+
+	rootKeyID, err := keyStoreManager.GenRootKey("ecdsa")
+	assert.NoError(t, err)
+	rootCryptoService, err := keyStoreManager.GetRootCryptoService(rootKeyID)
+	assert.NoError(t, err)
+	cert, err := rootCryptoService.GenerateCertificate("docker.com/notary")
+	assert.NoError(t, err)
+	certKey := data.NewPublicKey(data.ECDSAx509Key, trustmanager.CertToPEM(cert))
+
+	// the root key is found by the certificate's key ID once linked
+	assert.NoError(t, keyStoreManager.LinkRootKey(rootKeyID, certKey.ID()))
+	privKey, _, err := keyStoreManager.RootKeyStore().GetKey(certKey.ID())
+	assert.NoError(t, err)
+	assert.Equal(t, rootKeyID, privKey.ID())
+
+	// keys can only be imported and exported from disk
+	assert.Equal(t, ErrKeyStoreNotOnDisk, keyStoreManager.ExportRootKey(&bytes.Buffer{}, rootKeyID))
+	assert.Equal(t, ErrKeyStoreNotOnDisk, keyStoreManager.ExportAllKeys(&bytes.Buffer{}, passphraseRetriever))
+}
@@ -5,6 +5,7 @@ CREATE TABLE `tuf_files` (
 	`role` varchar(255) NOT NULL,
 	`version` int(11) NOT NULL,
 	`data` longblob NOT NULL,
+	`created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
 	PRIMARY KEY (`id`),
 	UNIQUE KEY `gun` (`gun`,`role`,`version`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
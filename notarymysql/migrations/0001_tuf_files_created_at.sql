@@ -0,0 +1,4 @@
+-- Adds the time each version was stored, used by the repository changefeed
+-- and retention pruning. Only needed for databases created from an
+-- initial.sql that predates the column.
+ALTER TABLE `tuf_files` ADD COLUMN `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP;
@@ -0,0 +1,371 @@
+// Package metrics is a small implementation of labelled counters and
+// histograms that can be exposed in the Prometheus text exposition format,
+// without depending on the Prometheus client library.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// DefBuckets are the default histogram buckets, in seconds. They are
+// tailored to measure the latency of network and storage operations.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultRegistry is the registry used by the package level constructors
+// and Handler.
+var DefaultRegistry = NewRegistry()
+
+// collector is implemented by every metric type that can be written out
+// by a Registry
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds a set of metrics and serves them over HTTP
+type Registry struct {
+	lock       sync.Mutex
+	collectors map[string]collector
+}
+
+// NewRegistry instantiates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]collector),
+	}
+}
+
+// ErrDuplicate is returned when registering a metric whose name is already
+// registered
+type ErrDuplicate struct {
+	Name string
+}
+
+func (err ErrDuplicate) Error() string {
+	return "metric already registered: " + err.Name
+}
+
+// ErrLabelCount is returned when a metric is given the wrong number of
+// label values
+type ErrLabelCount struct {
+	Name     string
+	Expected int
+	Got      int
+}
+
+func (err ErrLabelCount) Error() string {
+	return fmt.Sprintf("metric %s expects %d label values, got %d", err.Name, err.Expected, err.Got)
+}
+
+func (r *Registry) register(c collector) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.collectors[c.name()]; ok {
+		return ErrDuplicate{Name: c.name()}
+	}
+	r.collectors[c.name()] = c
+	return nil
+}
+
+// logRegisterError is used by the package level constructors, which are
+// called from variable initializers and cannot return an error
+func logRegisterError(err error) {
+	if err != nil {
+		logrus.Errorf("%s, it will not be exported", err.Error())
+	}
+}
+
+// Export writes all the registered metrics, sorted by name, to w
+func (r *Registry) Export(w io.Writer) {
+	r.lock.Lock()
+	names := make([]string, 0, len(r.collectors))
+	for n := range r.collectors {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	collectors := make([]collector, 0, len(names))
+	for _, n := range names {
+		collectors = append(collectors, r.collectors[n])
+	}
+	r.lock.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// ServeHTTP implements http.Handler, writing out all the registered metrics
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.Export(w)
+}
+
+// Handler returns an http.Handler serving the metrics in the DefaultRegistry
+func Handler() http.Handler {
+	return DefaultRegistry
+}
+
+// ListenAndServe serves the metrics in the DefaultRegistry on /metrics at
+// addr. It uses its own mux, so that nothing registered on
+// http.DefaultServeMux, such as pprof, is exposed with the metrics.
+func ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	return http.ListenAndServe(addr, mux)
+}
+
+// label values and help text are escaped as the text exposition format
+// requires, which differs from Go's quoting for non-ASCII and control
+// characters
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// labelSet is shared by all vector types to map a list of label values
+// to the series they identify.
+type labelSet struct {
+	metric string
+	help   string
+	labels []string
+}
+
+func (l labelSet) name() string {
+	return l.metric
+}
+
+func (l labelSet) key(values []string) (string, error) {
+	if len(values) != len(l.labels) {
+		return "", ErrLabelCount{Name: l.metric, Expected: len(l.labels), Got: len(values)}
+	}
+	return strings.Join(values, "\xff"), nil
+}
+
+func (l labelSet) writeHeader(w io.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", l.metric, helpEscaper.Replace(l.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", l.metric, kind)
+}
+
+// format renders the label pairs for a series, including any extra pairs
+// (e.g. the "le" bucket label for histograms).
+func (l labelSet) format(values []string, extra ...string) string {
+	pairs := make([]string, 0, len(values)+len(extra)/2)
+	for i, v := range values {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, l.labels[i], labelEscaper.Replace(v)))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], labelEscaper.Replace(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+type counterSeries struct {
+	values []string
+	count  float64
+}
+
+// CounterVec is a set of monotonically increasing counters partitioned
+// by label values
+type CounterVec struct {
+	labelSet
+	lock   sync.Mutex
+	series map[string]*counterSeries
+}
+
+// NewCounterVec creates a CounterVec and registers it with the Registry.
+// The CounterVec is returned even if it could not be registered.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) (*CounterVec, error) {
+	c := &CounterVec{
+		labelSet: labelSet{metric: name, help: help, labels: labels},
+		series:   make(map[string]*counterSeries),
+	}
+	return c, r.register(c)
+}
+
+// NewCounterVec creates a CounterVec registered with the DefaultRegistry. If
+// the name is already registered the error is logged, and the CounterVec
+// works but is not exported.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c, err := DefaultRegistry.NewCounterVec(name, help, labels...)
+	logRegisterError(err)
+	return c
+}
+
+// Inc increments the counter identified by the label values by 1
+func (c *CounterVec) Inc(values ...string) error {
+	return c.Add(1, values...)
+}
+
+// Add increments the counter identified by the label values by delta
+func (c *CounterVec) Add(delta float64, values ...string) error {
+	k, err := c.key(values)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	s, ok := c.series[k]
+	if !ok {
+		s = &counterSeries{values: values}
+		c.series[k] = s
+	}
+	s.count += delta
+	return nil
+}
+
+// Value returns the current value of the counter identified by the label
+// values, or 0 if there is none
+func (c *CounterVec) Value(values ...string) float64 {
+	k, err := c.key(values)
+	if err != nil {
+		return 0
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if s, ok := c.series[k]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.writeHeader(w, "counter")
+	for _, k := range sortedKeys(c.series) {
+		s := c.series[k]
+		fmt.Fprintf(w, "%s%s %s\n", c.metric, c.format(s.values), formatFloat(s.count))
+	}
+}
+
+type histogramSeries struct {
+	values  []string
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// HistogramVec is a set of histograms partitioned by label values
+type HistogramVec struct {
+	labelSet
+	bounds []float64
+	lock   sync.Mutex
+	series map[string]*histogramSeries
+}
+
+// NewHistogramVec creates a HistogramVec and registers it with the Registry.
+// If buckets is nil, DefBuckets is used. The HistogramVec is returned even if
+// it could not be registered.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) (*HistogramVec, error) {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+	h := &HistogramVec{
+		labelSet: labelSet{metric: name, help: help, labels: labels},
+		bounds:   bounds,
+		series:   make(map[string]*histogramSeries),
+	}
+	return h, r.register(h)
+}
+
+// NewHistogramVec creates a HistogramVec registered with the DefaultRegistry.
+// If the name is already registered the error is logged, and the
+// HistogramVec works but is not exported.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h, err := DefaultRegistry.NewHistogramVec(name, help, buckets, labels...)
+	logRegisterError(err)
+	return h
+}
+
+// Observe records a single observation in the histogram identified by the
+// label values
+func (h *HistogramVec) Observe(v float64, values ...string) error {
+	k, err := h.key(values)
+	if err != nil {
+		return err
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	s, ok := h.series[k]
+	if !ok {
+		s = &histogramSeries{values: values, buckets: make([]uint64, len(h.bounds))}
+		h.series[k] = s
+	}
+	for i, b := range h.bounds {
+		if v <= b {
+			s.buckets[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+	return nil
+}
+
+// ObserveSince records the number of seconds elapsed since start
+func (h *HistogramVec) ObserveSince(start time.Time, values ...string) error {
+	return h.Observe(time.Since(start).Seconds(), values...)
+}
+
+// Count returns the number of observations made for the label values, or 0
+// if there are none
+func (h *HistogramVec) Count(values ...string) uint64 {
+	k, err := h.key(values)
+	if err != nil {
+		return 0
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if s, ok := h.series[k]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.writeHeader(w, "histogram")
+	for _, k := range sortedKeys(h.series) {
+		s := h.series[k]
+		for i, b := range h.bounds {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metric, h.format(s.values, "le", formatFloat(b)), s.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metric, h.format(s.values, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metric, h.format(s.values), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metric, h.format(s.values), s.count)
+	}
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch series := m.(type) {
+	case map[string]*counterSeries:
+		for k := range series {
+			keys = append(keys, k)
+		}
+	case map[string]*histogramSeries:
+		for k := range series {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
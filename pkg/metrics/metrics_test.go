@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterVec(t *testing.T) {
+	r := NewRegistry()
+	c, err := r.NewCounterVec("test_total", "A test counter.", "handler")
+	assert.NoError(t, err)
+	c.Inc("a")
+	c.Inc("a")
+	c.Add(3, "b")
+
+	assert.Equal(t, float64(2), c.Value("a"))
+	assert.Equal(t, float64(3), c.Value("b"))
+	assert.Equal(t, float64(0), c.Value("c"))
+
+	var buf bytes.Buffer
+	r.Export(&buf)
+	expected := `# HELP test_total A test counter.
+# TYPE test_total counter
+test_total{handler="a"} 2
+test_total{handler="b"} 3
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestCounterVecWrongLabels(t *testing.T) {
+	r := NewRegistry()
+	c, err := r.NewCounterVec("test_total", "A test counter.", "handler")
+	assert.NoError(t, err)
+	assert.Equal(t, ErrLabelCount{Name: "test_total", Expected: 1, Got: 0}, c.Inc())
+	assert.IsType(t, ErrLabelCount{}, c.Inc("a", "b"))
+	assert.Equal(t, float64(0), c.Value())
+
+	h, err := r.NewHistogramVec("test_seconds", "A test histogram.", nil)
+	assert.NoError(t, err)
+	assert.IsType(t, ErrLabelCount{}, h.Observe(1, "a"))
+	assert.Equal(t, uint64(0), h.Count("a"))
+}
+
+func TestDuplicateRegistration(t *testing.T) {
+	r := NewRegistry()
+	_, err := r.NewCounterVec("test_total", "A test counter.")
+	assert.NoError(t, err)
+	h, err := r.NewHistogramVec("test_total", "A test histogram.", nil)
+	assert.Equal(t, ErrDuplicate{Name: "test_total"}, err)
+
+	// the unregistered histogram still works, but is not exported
+	assert.NoError(t, h.Observe(1))
+	var buf bytes.Buffer
+	r.Export(&buf)
+	assert.NotContains(t, buf.String(), "histogram")
+}
+
+func TestHistogramVec(t *testing.T) {
+	r := NewRegistry()
+	h, err := r.NewHistogramVec("test_seconds", "A test histogram.", []float64{1, 0.5})
+	assert.NoError(t, err)
+	h.Observe(0.25)
+	h.Observe(0.75)
+	h.Observe(2)
+
+	assert.Equal(t, uint64(3), h.Count())
+
+	var buf bytes.Buffer
+	r.Export(&buf)
+	expected := `# HELP test_seconds A test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.5"} 1
+test_seconds_bucket{le="1"} 2
+test_seconds_bucket{le="+Inf"} 3
+test_seconds_sum 3
+test_seconds_count 3
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestRegistryServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	c, err := r.NewCounterVec("b_total", "B.")
+	assert.NoError(t, err)
+	c.Inc()
+	h, err := r.NewHistogramVec("a_seconds", "A.", nil, "op")
+	assert.NoError(t, err)
+	h.Observe(0.1, "get")
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.True(t, strings.HasPrefix(res.Header.Get("Content-Type"), "text/plain"))
+
+	body, err := ioutil.ReadAll(res.Body)
+	assert.Nil(t, err)
+	out := string(body)
+	assert.True(t, strings.Index(out, "a_seconds") < strings.Index(out, "b_total"), "metrics should be sorted by name")
+	assert.Contains(t, out, `a_seconds_count{op="get"} 1`)
+	assert.Contains(t, out, "b_total 1")
+}
+
+func TestLabelEscaping(t *testing.T) {
+	r := NewRegistry()
+	c, err := r.NewCounterVec("test_total", "A \\ test\ncounter.", "path")
+	assert.NoError(t, err)
+	c.Inc("a\\b\"c\ndé")
+
+	var buf bytes.Buffer
+	r.Export(&buf)
+	expected := `# HELP test_total A \\ test\ncounter.
+# TYPE test_total counter
+test_total{path="a\\b\"c\nd` + "é" + `"} 1
+`
+	assert.Equal(t, expected, buf.String())
+}
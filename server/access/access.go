@@ -0,0 +1,52 @@
+// Package access provides the access controllers notary-server supports in
+// addition to the htpasswd and token controllers from docker/distribution,
+// and a policy that restricts what authenticated users may do to each GUN.
+package access
+
+import (
+	"fmt"
+
+	"github.com/docker/distribution/registry/auth"
+	// register the docker/distribution access controllers
+	_ "github.com/docker/distribution/registry/auth/htpasswd"
+	_ "github.com/docker/distribution/registry/auth/token"
+)
+
+// Actions that can be granted on a GUN. Admin grants every other action.
+const (
+	ActionPull   = "pull"
+	ActionPush   = "push"
+	ActionDelete = "delete"
+	ActionAdmin  = "admin"
+)
+
+// NewAccessController creates the access controller registered under method,
+// wrapping it in a PolicyController if policyFile is set. If method is empty,
+// authentication is disabled and nil is returned.
+func NewAccessController(method string, options interface{}, policyFile string) (auth.AccessController, error) {
+	if method == "" {
+		if policyFile != "" {
+			return nil, fmt.Errorf("an auth type must be configured to use an access policy")
+		}
+		return nil, nil
+	}
+	opts := map[string]interface{}{}
+	if options != nil {
+		var ok bool
+		if opts, ok = options.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("auth.options must be a map[string]interface{}")
+		}
+	}
+	ac, err := auth.GetAccessController(method, opts)
+	if err != nil {
+		return nil, err
+	}
+	if policyFile == "" {
+		return ac, nil
+	}
+	policy, err := LoadPolicy(policyFile)
+	if err != nil {
+		return nil, err
+	}
+	return NewPolicyController(ac, policy), nil
+}
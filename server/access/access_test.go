@@ -0,0 +1,145 @@
+package access
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"testing"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/docker/notary/errors"
+)
+
+func requestContext(r *http.Request) context.Context {
+	return ctxu.WithRequest(context.Background(), r)
+}
+
+func repoAccess(gun, action string) auth.Access {
+	return auth.Access{
+		Resource: auth.Resource{Type: "repository", Name: gun},
+		Action:   action,
+	}
+}
+
+func TestPolicyAllowed(t *testing.T) {
+	policy, err := ParsePolicy([]byte(`{"rules": [
+		{"gun": "docker.com/*", "users": ["*"], "actions": ["pull"]},
+		{"gun": "docker.com/notary", "users": ["alice"], "actions": ["push"]},
+		{"gun": "*", "users": ["root"], "actions": ["admin"]}
+	]}`))
+	assert.NoError(t, err)
+
+	assert.True(t, policy.Allowed("bob", "docker.com/a/b", ActionPull))
+	assert.False(t, policy.Allowed("bob", "example.com/a", ActionPull))
+	assert.True(t, policy.Allowed("alice", "docker.com/notary", ActionPush))
+	assert.False(t, policy.Allowed("alice", "docker.com/notary", ActionDelete))
+	assert.False(t, policy.Allowed("bob", "docker.com/notary", ActionPush))
+	assert.True(t, policy.Allowed("root", "example.com/a", ActionDelete))
+}
+
+func TestParsePolicyInvalid(t *testing.T) {
+	_, err := ParsePolicy([]byte(`{"rules": [{"gun": "*", "users": ["*"], "actions": ["write"]}]}`))
+	assert.Error(t, err)
+	_, err = ParsePolicy([]byte(`{"rules": [{"users": ["*"], "actions": ["pull"]}]}`))
+	assert.Error(t, err)
+}
+
+func TestStaticToken(t *testing.T) {
+	ac, err := auth.GetAccessController("static_token", map[string]interface{}{
+		"realm":  "notary",
+		"tokens": map[string]interface{}{"secret": "alice"},
+	})
+	assert.NoError(t, err)
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	_, err = ac.Authorized(requestContext(r))
+	assert.IsType(t, &bearerChallenge{}, err)
+
+	r.Header.Set("Authorization", "Bearer wrong")
+	_, err = ac.Authorized(requestContext(r))
+	assert.IsType(t, &bearerChallenge{}, err)
+
+	r.Header.Set("Authorization", "Bearer secret")
+	ctx, err := ac.Authorized(requestContext(r))
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", ctx.Value("auth.user.name"))
+}
+
+func TestStaticTokenRequiresTokens(t *testing.T) {
+	_, err := auth.GetAccessController("static_token", map[string]interface{}{"realm": "notary"})
+	assert.Error(t, err)
+}
+
+func TestMTLS(t *testing.T) {
+	ac, err := auth.GetAccessController("mtls", map[string]interface{}{
+		"identities": map[string]interface{}{"builder.example.com": "ci"},
+	})
+	assert.NoError(t, err)
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	_, err = ac.Authorized(requestContext(r))
+	assert.Equal(t, ErrNoClientCertificate, err)
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "builder.example.com"}}
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	ctx, err := ac.Authorized(requestContext(r))
+	assert.NoError(t, err)
+	assert.Equal(t, "ci", ctx.Value("auth.user.name"))
+
+	cert.Subject.CommonName = "other.example.com"
+	_, err = ac.Authorized(requestContext(r))
+	assert.Equal(t, ErrNoClientCertificate, err)
+}
+
+func TestPolicyController(t *testing.T) {
+	ac, err := auth.GetAccessController("static_token", map[string]interface{}{
+		"realm":  "notary",
+		"tokens": map[string]interface{}{"secret": "alice"},
+	})
+	assert.NoError(t, err)
+	policy, err := ParsePolicy([]byte(`{"rules": [{"gun": "alice/*", "users": ["alice"], "actions": ["pull", "push"]}]}`))
+	assert.NoError(t, err)
+	pc := NewPolicyController(ac, policy)
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+
+	_, err = pc.Authorized(requestContext(r), repoAccess("alice/repo", ActionPush), repoAccess("alice/repo", ActionPull))
+	assert.NoError(t, err)
+
+	_, err = pc.Authorized(requestContext(r), repoAccess("alice/repo", ActionDelete))
+	coder, ok := err.(errcode.ErrorCoder)
+	assert.True(t, ok)
+	assert.Equal(t, errors.ErrAccessDenied, coder.ErrorCode())
+}
+
+func TestNewAccessControllerDisabled(t *testing.T) {
+	ac, err := NewAccessController("", nil, "")
+	assert.NoError(t, err)
+	assert.Nil(t, ac)
+
+	_, err = NewAccessController("", nil, "policy.json")
+	assert.Error(t, err)
+}
+
+func TestReloadableController(t *testing.T) {
+	rc := NewReloadableController(nil)
+	r, _ := http.NewRequest("GET", "/", nil)
+	_, err := rc.Authorized(requestContext(r), repoAccess("gun", ActionPull))
+	assert.NoError(t, err)
+
+	ac, err := auth.GetAccessController("static_token", map[string]interface{}{
+		"realm":  "notary",
+		"tokens": map[string]interface{}{"secret": "alice"},
+	})
+	assert.NoError(t, err)
+	rc.Set(ac)
+	_, err = rc.Authorized(requestContext(r), repoAccess("gun", ActionPull))
+	assert.IsType(t, &bearerChallenge{}, err)
+}
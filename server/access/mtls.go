@@ -0,0 +1,67 @@
+package access
+
+import (
+	"errors"
+	"fmt"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/auth"
+	"golang.org/x/net/context"
+)
+
+// ErrNoClientCertificate is returned when a request was not made with a
+// client certificate signed by one of the server's client CAs
+var ErrNoClientCertificate = errors.New("no verified client certificate")
+
+// mtlsController identifies users by the common name of the client
+// certificate they connected with. The server must be configured with a
+// client CA for certificates to be requested and verified. If the
+// "identities" option is set, it maps common names to user names and
+// certificates with any other common name are rejected.
+type mtlsController struct {
+	identities map[string]string
+}
+
+func newMTLSController(options map[string]interface{}) (auth.AccessController, error) {
+	ac := &mtlsController{}
+	if raw, ok := options["identities"]; ok {
+		identities, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf(`"identities" must map certificate common names to user names`)
+		}
+		ac.identities = make(map[string]string, len(identities))
+		for cn, user := range identities {
+			name, ok := user.(string)
+			if !ok {
+				return nil, fmt.Errorf("mtls user names must be strings")
+			}
+			ac.identities[cn] = name
+		}
+	}
+	return ac, nil
+}
+
+// Authorized implements auth.AccessController
+func (ac *mtlsController) Authorized(ctx context.Context, access ...auth.Access) (context.Context, error) {
+	req, err := ctxu.GetRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoClientCertificate
+	}
+	user := req.TLS.VerifiedChains[0][0].Subject.CommonName
+	if ac.identities != nil {
+		mapped, ok := ac.identities[user]
+		if !ok {
+			ctxu.GetLogger(ctx).Errorf("client certificate %q is not mapped to a user", user)
+			return nil, ErrNoClientCertificate
+		}
+		user = mapped
+	}
+	return auth.WithUser(ctx, auth.UserInfo{Name: user}), nil
+}
+
+func init() {
+	auth.Register("mtls", auth.InitFunc(newMTLSController))
+}
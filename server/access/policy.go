@@ -0,0 +1,126 @@
+package access
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/docker/distribution/registry/auth"
+	"golang.org/x/net/context"
+
+	"github.com/docker/notary/errors"
+)
+
+// Rule grants actions on the GUNs matching a glob to a set of users. In the
+// glob, "*" matches any sequence of characters, including "/". A user of
+// "*" matches any authenticated user.
+type Rule struct {
+	GUN     string   `json:"gun"`
+	Users   []string `json:"users"`
+	Actions []string `json:"actions"`
+
+	pattern *regexp.Regexp
+}
+
+// Policy is a list of rules. An action is allowed if any rule grants it.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// LoadPolicy reads a JSON policy from a file
+func LoadPolicy(path string) (*Policy, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(raw)
+}
+
+// ParsePolicy parses and validates a JSON policy
+func ParsePolicy(raw []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := json.Unmarshal(raw, p); err != nil {
+		return nil, fmt.Errorf("unable to parse access policy: %v", err)
+	}
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.GUN == "" {
+			return nil, fmt.Errorf("access policy rule %d has no gun", i)
+		}
+		for _, action := range rule.Actions {
+			switch action {
+			case ActionPull, ActionPush, ActionDelete, ActionAdmin:
+			default:
+				return nil, fmt.Errorf("access policy rule %d has unknown action %q", i, action)
+			}
+		}
+		glob := strings.Replace(regexp.QuoteMeta(rule.GUN), `\*`, ".*", -1)
+		rule.pattern = regexp.MustCompile("^" + glob + "$")
+	}
+	return p, nil
+}
+
+// Allowed returns true if the policy allows user to perform action on gun
+func (p *Policy) Allowed(user, gun, action string) bool {
+	for _, rule := range p.Rules {
+		if rule.pattern.MatchString(gun) && rule.grants(user, action) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) grants(user, action string) bool {
+	userMatches := false
+	for _, u := range r.Users {
+		if u == "*" || u == user {
+			userMatches = true
+			break
+		}
+	}
+	if !userMatches {
+		return false
+	}
+	for _, a := range r.Actions {
+		if a == action || a == ActionAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyController wraps an AccessController, which authenticates the user,
+// and checks every requested access against a Policy
+type PolicyController struct {
+	ac     auth.AccessController
+	policy *Policy
+}
+
+// NewPolicyController instantiates a PolicyController
+func NewPolicyController(ac auth.AccessController, policy *Policy) *PolicyController {
+	return &PolicyController{
+		ac:     ac,
+		policy: policy,
+	}
+}
+
+// Authorized implements auth.AccessController
+func (c *PolicyController) Authorized(ctx context.Context, access ...auth.Access) (context.Context, error) {
+	ctx, err := c.ac.Authorized(ctx, access...)
+	if err != nil {
+		return nil, err
+	}
+	user, _ := ctx.Value("auth.user.name").(string)
+	for _, a := range access {
+		if a.Type != "repository" {
+			continue
+		}
+		if !c.policy.Allowed(user, a.Name, a.Action) {
+			return nil, errors.ErrAccessDenied.WithDetail(
+				fmt.Sprintf("%s is not allowed to %s %s", user, a.Action, a.Name))
+		}
+	}
+	return ctx, nil
+}
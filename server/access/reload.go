@@ -0,0 +1,48 @@
+package access
+
+import (
+	"sync"
+
+	"github.com/docker/distribution/registry/auth"
+	"golang.org/x/net/context"
+)
+
+// ReloadableController is an AccessController whose underlying controller
+// can be replaced while the server is running, so auth configuration can be
+// reloaded. If it holds no controller, authentication is disabled.
+type ReloadableController struct {
+	lock sync.RWMutex
+	ac   auth.AccessController
+}
+
+// NewReloadableController instantiates a ReloadableController holding ac
+func NewReloadableController(ac auth.AccessController) *ReloadableController {
+	return &ReloadableController{ac: ac}
+}
+
+// Set replaces the underlying controller. Requests already being
+// authorized complete against the previous one.
+func (c *ReloadableController) Set(ac auth.AccessController) {
+	c.lock.Lock()
+	c.ac = ac
+	c.lock.Unlock()
+}
+
+// Enabled reports whether the controller holds an underlying controller,
+// i.e. whether authentication is enabled
+func (c *ReloadableController) Enabled() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.ac != nil
+}
+
+// Authorized implements auth.AccessController
+func (c *ReloadableController) Authorized(ctx context.Context, access ...auth.Access) (context.Context, error) {
+	c.lock.RLock()
+	ac := c.ac
+	c.lock.RUnlock()
+	if ac == nil {
+		return ctx, nil
+	}
+	return ac.Authorized(ctx, access...)
+}
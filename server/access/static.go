@@ -0,0 +1,106 @@
+package access
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/auth"
+	"golang.org/x/net/context"
+)
+
+// ErrInvalidToken is returned when a request has no bearer token, or
+// one that isn't configured
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// staticTokenController authenticates requests carrying one of a fixed set
+// of bearer tokens, each of which identifies a user. Tokens can be given
+// inline with the "tokens" option, or in a JSON file named by "tokens_file",
+// in both cases as an object mapping tokens to user names.
+type staticTokenController struct {
+	realm  string
+	tokens map[string]string
+}
+
+func newStaticTokenController(options map[string]interface{}) (auth.AccessController, error) {
+	realm, ok := options["realm"].(string)
+	if !ok {
+		return nil, fmt.Errorf(`"realm" must be set for static_token access controller`)
+	}
+	tokens := make(map[string]string)
+	if inline, ok := options["tokens"].(map[string]interface{}); ok {
+		for token, user := range inline {
+			name, ok := user.(string)
+			if !ok {
+				return nil, fmt.Errorf("static_token user names must be strings")
+			}
+			tokens[token] = name
+		}
+	}
+	if path, ok := options["tokens_file"].(string); ok {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		fromFile := make(map[string]string)
+		if err := json.Unmarshal(raw, &fromFile); err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %v", path, err)
+		}
+		for token, name := range fromFile {
+			tokens[token] = name
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf(`"tokens" or "tokens_file" must be set for static_token access controller`)
+	}
+	return &staticTokenController{realm: realm, tokens: tokens}, nil
+}
+
+// Authorized implements auth.AccessController
+func (ac *staticTokenController) Authorized(ctx context.Context, access ...auth.Access) (context.Context, error) {
+	req, err := ctxu.GetRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	header := req.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, &bearerChallenge{realm: ac.realm, err: ErrInvalidToken}
+	}
+	presented := []byte(strings.TrimPrefix(header, "Bearer "))
+
+	// compare against every token so timing doesn't reveal which matched
+	user := ""
+	for token, name := range ac.tokens {
+		if subtle.ConstantTimeCompare(presented, []byte(token)) == 1 {
+			user = name
+		}
+	}
+	if user == "" {
+		ctxu.GetLogger(ctx).Error("request presented an unknown bearer token")
+		return nil, &bearerChallenge{realm: ac.realm, err: ErrInvalidToken}
+	}
+	return auth.WithUser(ctx, auth.UserInfo{Name: user}), nil
+}
+
+// bearerChallenge implements auth.Challenge
+type bearerChallenge struct {
+	realm string
+	err   error
+}
+
+func (ch *bearerChallenge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q", ch.realm))
+}
+
+func (ch *bearerChallenge) Error() string {
+	return fmt.Sprintf("bearer authentication challenge: %v", ch.err)
+}
+
+func init() {
+	auth.Register("static_token", auth.InitFunc(newStaticTokenController))
+}
@@ -0,0 +1,29 @@
+package events
+
+// Broker is the Publisher used by the server. It records every event in a
+// Feed, which assigns the event its ID, then hands it to each Webhook.
+type Broker struct {
+	feed     *Feed
+	webhooks []*Webhook
+}
+
+// NewBroker instantiates a Broker
+func NewBroker(feed *Feed, webhooks ...*Webhook) *Broker {
+	return &Broker{
+		feed:     feed,
+		webhooks: webhooks,
+	}
+}
+
+// Publish implements Publisher
+func (b *Broker) Publish(event Event) {
+	event = b.feed.Append(event)
+	for _, w := range b.webhooks {
+		w.Send(event)
+	}
+}
+
+// Feed returns the Feed events are recorded in
+func (b *Broker) Feed() *Feed {
+	return b.feed
+}
@@ -0,0 +1,119 @@
+// Package events records changes made to repositories on the notary server
+// and notifies interested parties about them, either by delivering them to
+// webhooks or by serving them from a changefeed that can be polled.
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/endophage/gotuf/data"
+
+	"github.com/docker/notary/server/storage"
+)
+
+// RoleVersion identifies the version of a role that was written by an update
+type RoleVersion struct {
+	Role    string `json:"role"`
+	Version int    `json:"version"`
+}
+
+// TargetsDiff lists the names of the targets that changed between two
+// versions of a targets file
+type TargetsDiff struct {
+	Added    []string `json:"added,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+	Modified []string `json:"modified,omitempty"`
+}
+
+// Empty returns true if no targets changed
+func (d TargetsDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// Event describes a single successful update to a GUN
+type Event struct {
+	ID    int64         `json:"id"`
+	GUN   string        `json:"gun"`
+	Time  time.Time     `json:"time"`
+	Roles []RoleVersion `json:"roles"`
+	TargetsDiff
+	// Missed is only set on webhook deliveries: it is the number of events
+	// that were dropped since the previous delivery because the webhook's
+	// queue was full. They can be read from the changefeed.
+	Missed int64 `json:"missed,omitempty"`
+}
+
+// Publisher is implemented by anything that can be notified of events
+type Publisher interface {
+	Publish(event Event)
+}
+
+// NewUpdateEvent builds the Event for an update that has been successfully
+// applied to a GUN. oldTargets is the targets file that was current before
+// the update, or nil if there wasn't one.
+func NewUpdateEvent(gun string, updates []storage.MetaUpdate, oldTargets []byte) Event {
+	event := Event{
+		GUN:  gun,
+		Time: time.Now().UTC(),
+	}
+	for _, u := range updates {
+		event.Roles = append(event.Roles, RoleVersion{Role: u.Role, Version: u.Version})
+		if u.Role == data.CanonicalTargetsRole {
+			event.TargetsDiff = DiffTargets(oldTargets, u.Data)
+		}
+	}
+	return event
+}
+
+// DiffTargets compares two serialized targets files, returning the names
+// of the targets that were added, removed or modified. Either side may be
+// nil, in which case it is treated as having no targets.
+func DiffTargets(oldTargets, newTargets []byte) TargetsDiff {
+	oldFiles := parseTargets(oldTargets)
+	newFiles := parseTargets(newTargets)
+
+	diff := TargetsDiff{}
+	for name, meta := range newFiles {
+		old, ok := oldFiles[name]
+		if !ok {
+			diff.Added = append(diff.Added, name)
+		} else if !sameFile(old, meta) {
+			diff.Modified = append(diff.Modified, name)
+		}
+	}
+	for name := range oldFiles {
+		if _, ok := newFiles[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Modified)
+	return diff
+}
+
+func parseTargets(raw []byte) data.Files {
+	if raw == nil {
+		return nil
+	}
+	t := &data.SignedTargets{}
+	if err := json.Unmarshal(raw, t); err != nil {
+		return nil
+	}
+	return t.Signed.Targets
+}
+
+func sameFile(a, b data.FileMeta) bool {
+	if a.Length != b.Length || len(a.Hashes) != len(b.Hashes) {
+		return false
+	}
+	for alg, digest := range a.Hashes {
+		if !bytes.Equal(digest, b.Hashes[alg]) {
+			return false
+		}
+	}
+	return true
+}
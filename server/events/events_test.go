@@ -0,0 +1,110 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/docker/notary/server/storage"
+)
+
+func targetsJSON(t *testing.T, files data.Files) []byte {
+	targets := data.NewTargets()
+	targets.Signed.Targets = files
+	out, err := json.Marshal(targets)
+	assert.NoError(t, err)
+	return out
+}
+
+func TestDiffTargets(t *testing.T) {
+	old := targetsJSON(t, data.Files{
+		"kept":     {Length: 1, Hashes: data.Hashes{"sha256": []byte("a")}},
+		"removed":  {Length: 1, Hashes: data.Hashes{"sha256": []byte("b")}},
+		"modified": {Length: 1, Hashes: data.Hashes{"sha256": []byte("c")}},
+	})
+	updated := targetsJSON(t, data.Files{
+		"kept":     {Length: 1, Hashes: data.Hashes{"sha256": []byte("a")}},
+		"modified": {Length: 1, Hashes: data.Hashes{"sha256": []byte("d")}},
+		"added":    {Length: 1, Hashes: data.Hashes{"sha256": []byte("e")}},
+	})
+
+	diff := DiffTargets(old, updated)
+	assert.Equal(t, []string{"added"}, diff.Added)
+	assert.Equal(t, []string{"removed"}, diff.Removed)
+	assert.Equal(t, []string{"modified"}, diff.Modified)
+	assert.True(t, DiffTargets(old, old).Empty())
+}
+
+func TestNewUpdateEventWithoutPreviousTargets(t *testing.T) {
+	updates := []storage.MetaUpdate{
+		{Role: "targets", Version: 1, Data: targetsJSON(t, data.Files{"a": {Length: 1}})},
+		{Role: "snapshot", Version: 2, Data: []byte("{}")},
+	}
+	event := NewUpdateEvent("gun", updates, nil)
+	assert.Equal(t, "gun", event.GUN)
+	assert.Equal(t, []RoleVersion{{"targets", 1}, {"snapshot", 2}}, event.Roles)
+	assert.Equal(t, []string{"a"}, event.Added)
+	assert.Empty(t, event.Removed)
+}
+
+func TestFeedSince(t *testing.T) {
+	f := NewFeed(3)
+	evts, start, err := f.Since("", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, evts)
+	for i := 0; i < 5; i++ {
+		f.Append(Event{GUN: "gun"})
+	}
+
+	// events 1 and 2 have been evicted, which a new reader doesn't miss
+	evts, next, err := f.Since("", 10)
+	assert.NoError(t, err)
+	assert.Len(t, evts, 3)
+	assert.Equal(t, int64(3), evts[0].ID)
+	assert.Equal(t, f.cursor(5), next)
+
+	// but a reader that started before them does
+	_, _, err = f.Since(start, 10)
+	assert.Equal(t, ErrCursorExpired{Cursor: start}, err)
+
+	evts, next, err = f.Since(f.cursor(3), 1)
+	assert.NoError(t, err)
+	assert.Len(t, evts, 1)
+	assert.Equal(t, int64(4), evts[0].ID)
+	assert.Equal(t, f.cursor(4), next)
+
+	evts, next, err = f.Since(f.cursor(5), 10)
+	assert.NoError(t, err)
+	assert.Empty(t, evts)
+	assert.Equal(t, f.cursor(5), next)
+
+	// cursors from another server, or from before a restart, are rejected
+	other := NewFeed(3)
+	other.Append(Event{GUN: "gun"})
+	for _, cursor := range []string{other.cursor(1), f.cursor(6), "5", "abc"} {
+		_, _, err = f.Since(cursor, 10)
+		assert.Equal(t, ErrCursorUnknown{Cursor: cursor}, err)
+	}
+}
+
+func TestTargetsHistory(t *testing.T) {
+	v1 := targetsJSON(t, data.Files{"a": {Length: 1}})
+	v2 := targetsJSON(t, data.Files{"a": {Length: 2}, "b": {Length: 1}})
+	v3 := targetsJSON(t, data.Files{"b": {Length: 1}})
+
+	changes := TargetsHistory(nil, []storage.StoredMeta{
+		{Version: 1, Data: v1},
+		{Version: 2, Data: v2},
+		{Version: 3, Data: v3},
+	})
+	assert.Len(t, changes, 4)
+	assert.Equal(t, TargetChange{Target: "a", Change: TargetAdded, Version: 1}, changes[0])
+	assert.Equal(t, TargetChange{Target: "b", Change: TargetAdded, Version: 2}, changes[1])
+	assert.Equal(t, TargetChange{Target: "a", Change: TargetModified, Version: 2}, changes[2])
+	assert.Equal(t, TargetChange{Target: "a", Change: TargetRemoved, Version: 3}, changes[3])
+
+	changes = TargetsHistory(v2, []storage.StoredMeta{{Version: 3, Data: v3}})
+	assert.Equal(t, []TargetChange{{Target: "a", Change: TargetRemoved, Version: 3}}, changes)
+}
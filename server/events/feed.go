@@ -0,0 +1,123 @@
+package events
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/distribution/uuid"
+)
+
+// DefaultFeedSize is the number of events retained by a Feed when no
+// size is configured
+const DefaultFeedSize = 1000
+
+// ErrCursorExpired is returned for a cursor whose following events have
+// been evicted from the feed before they could be read
+type ErrCursorExpired struct {
+	Cursor string
+}
+
+func (err ErrCursorExpired) Error() string {
+	return fmt.Sprintf("events after cursor %s have been evicted", err.Cursor)
+}
+
+// ErrCursorUnknown is returned for a cursor that was not issued by the feed,
+// for example by another server or before the server restarted
+type ErrCursorUnknown struct {
+	Cursor string
+}
+
+func (err ErrCursorUnknown) Error() string {
+	return fmt.Sprintf("cursor %s was not issued by this server", err.Cursor)
+}
+
+// Feed retains the most recent events in memory so they can be polled.
+// Every event is assigned an increasing ID, and clients use cursors to ask
+// for the events that happened since the one a cursor points to. The feed
+// is not persisted, so a cursor identifies both the event and the feed that
+// issued it: cursors from another server or from before a restart are
+// rejected rather than silently pointing at different events.
+type Feed struct {
+	lock   sync.Mutex
+	id     string
+	size   int
+	events []Event
+	lastID int64
+}
+
+// NewFeed instantiates a Feed retaining at most size events
+func NewFeed(size int) *Feed {
+	if size <= 0 {
+		size = DefaultFeedSize
+	}
+	return &Feed{id: uuid.Generate().String(), size: size}
+}
+
+// Append assigns the event an ID and appends it to the feed, evicting
+// the oldest event if the feed is full. The event is returned with its ID.
+func (f *Feed) Append(event Event) Event {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.lastID++
+	event.ID = f.lastID
+	f.events = append(f.events, event)
+	if len(f.events) > f.size {
+		f.events = f.events[len(f.events)-f.size:]
+	}
+	return event
+}
+
+// Since returns up to limit events that follow cursor, and the cursor to use
+// to retrieve the events after them. An empty cursor starts from the oldest
+// retained event. ErrCursorExpired is returned if events following the
+// cursor have been evicted, and ErrCursorUnknown if the cursor was not
+// issued by this feed.
+func (f *Feed) Since(cursor string, limit int) ([]Event, string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var after int64
+	if cursor != "" {
+		var err error
+		after, err = f.parseCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(f.events) > 0 && after < f.events[0].ID-1 {
+			return nil, "", ErrCursorExpired{Cursor: cursor}
+		}
+	}
+
+	var events []Event
+	next := after
+	for _, e := range f.events {
+		if e.ID <= after {
+			continue
+		}
+		if limit > 0 && len(events) >= limit {
+			break
+		}
+		events = append(events, e)
+		next = e.ID
+	}
+	return events, f.cursor(next), nil
+}
+
+func (f *Feed) cursor(id int64) string {
+	return fmt.Sprintf("%s-%d", f.id, id)
+}
+
+// parseCursor returns the event ID a cursor issued by this feed points to
+func (f *Feed) parseCursor(cursor string) (int64, error) {
+	sep := strings.LastIndex(cursor, "-")
+	if sep < 0 || cursor[:sep] != f.id {
+		return 0, ErrCursorUnknown{Cursor: cursor}
+	}
+	id, err := strconv.ParseInt(cursor[sep+1:], 10, 64)
+	if err != nil || id < 0 || id > f.lastID {
+		return 0, ErrCursorUnknown{Cursor: cursor}
+	}
+	return id, nil
+}
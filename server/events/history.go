@@ -0,0 +1,54 @@
+package events
+
+import (
+	"time"
+
+	"github.com/docker/notary/server/storage"
+)
+
+// Kinds of TargetChange
+const (
+	TargetAdded    = "added"
+	TargetRemoved  = "removed"
+	TargetModified = "modified"
+)
+
+// TargetChange records a change to a single target, along with the version
+// of the targets file that introduced it and when that version was stored
+type TargetChange struct {
+	Target  string    `json:"target"`
+	Change  string    `json:"change"`
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+}
+
+// TargetsHistory walks consecutive versions of a targets file, oldest
+// first, returning every change each version introduced. The first version
+// is compared against baseline, which may be nil if the history starts at
+// the creation of the repository.
+func TargetsHistory(baseline []byte, versions []storage.StoredMeta) []TargetChange {
+	changes := []TargetChange{}
+	previous := baseline
+	for _, v := range versions {
+		diff := DiffTargets(previous, v.Data)
+		for _, kind := range []struct {
+			change  string
+			targets []string
+		}{
+			{TargetAdded, diff.Added},
+			{TargetRemoved, diff.Removed},
+			{TargetModified, diff.Modified},
+		} {
+			for _, name := range kind.targets {
+				changes = append(changes, TargetChange{
+					Target:  name,
+					Change:  kind.change,
+					Version: v.Version,
+					Time:    v.CreatedAt,
+				})
+			}
+		}
+		previous = v.Data
+	}
+	return changes
+}
@@ -0,0 +1,157 @@
+package events
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/docker/notary/pkg/metrics"
+)
+
+// Headers set on every webhook delivery
+const (
+	SignatureHeader = "X-Notary-Signature"
+	EventIDHeader   = "X-Notary-Event-Id"
+)
+
+// Defaults applied to zero valued WebhookConfig fields
+const (
+	DefaultRetries   = 5
+	DefaultTimeout   = 10 * time.Second
+	DefaultQueueSize = 100
+)
+
+// WebhookConfig describes an endpoint events are delivered to
+type WebhookConfig struct {
+	URL string `mapstructure:"url"`
+	// Secret is used to sign the body of every delivery with HMAC-SHA256.
+	// The hex encoded signature is sent in the X-Notary-Signature header,
+	// prefixed with "sha256=".
+	Secret string `mapstructure:"secret"`
+	// Retries is the number of times a failed delivery is retried, with
+	// an exponential backoff between attempts.
+	Retries   int           `mapstructure:"retries"`
+	Timeout   time.Duration `mapstructure:"timeout"`
+	QueueSize int           `mapstructure:"queue_size"`
+}
+
+var droppedEvents = metrics.NewCounterVec(
+	"notary_server_webhook_dropped_events_total",
+	"Number of events not delivered to a webhook because its queue was full, partitioned by webhook URL.",
+	"url",
+)
+
+// Webhook delivers events to a single endpoint. Deliveries are made
+// asynchronously, in order, by a dedicated goroutine so a slow endpoint
+// cannot hold up updates to the server.
+type Webhook struct {
+	config  WebhookConfig
+	client  *http.Client
+	backoff time.Duration
+	queue   chan Event
+
+	lock    sync.Mutex
+	dropped int64
+}
+
+// NewWebhook creates a Webhook and starts its delivery goroutine
+func NewWebhook(config WebhookConfig) *Webhook {
+	if config.Retries <= 0 {
+		config.Retries = DefaultRetries
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultQueueSize
+	}
+	w := &Webhook{
+		config:  config,
+		client:  &http.Client{Timeout: config.Timeout},
+		backoff: time.Second,
+		queue:   make(chan Event, config.QueueSize),
+	}
+	go w.run()
+	return w
+}
+
+// Send queues an event for delivery. If the queue is full the event is
+// dropped, and the next event delivered records how many were missed in its
+// Missed field so the receiver can catch up from the changefeed.
+func (w *Webhook) Send(event Event) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	event.Missed = w.dropped
+	select {
+	case w.queue <- event:
+		w.dropped = 0
+	default:
+		w.dropped++
+		droppedEvents.Inc(w.config.URL)
+		logrus.Errorf("webhook queue for %s is full, dropping event %d", w.config.URL, event.ID)
+	}
+}
+
+func (w *Webhook) run() {
+	for event := range w.queue {
+		w.deliver(event)
+	}
+}
+
+func (w *Webhook) deliver(event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		logrus.Errorf("unable to marshal event %d: %v", event.ID, err)
+		return
+	}
+	backoff := w.backoff
+	for attempt := 0; attempt <= w.config.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = w.post(event.ID, body); err == nil {
+			return
+		}
+		logrus.Warnf("delivery of event %d to %s failed (attempt %d): %v", event.ID, w.config.URL, attempt+1, err)
+	}
+	logrus.Errorf("giving up on delivery of event %d to %s", event.ID, w.config.URL)
+}
+
+func (w *Webhook) post(id int64, body []byte) error {
+	req, err := http.NewRequest("POST", w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIDHeader, strconv.FormatInt(id, 10))
+	if w.config.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(w.config.Secret, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of body using secret. Receivers
+// of webhooks can use it to verify the X-Notary-Signature header.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,68 @@
+package events
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookDeliveryWithRetry(t *testing.T) {
+	var lock sync.Mutex
+	attempts := 0
+	delivered := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- body
+		delivered <- r
+	}))
+	defer ts.Close()
+
+	w := NewWebhook(WebhookConfig{URL: ts.URL, Secret: "secret"})
+	w.backoff = time.Millisecond
+	broker := NewBroker(NewFeed(10), w)
+	broker.Publish(Event{GUN: "gun"})
+
+	select {
+	case r := <-delivered:
+		body := <-bodies
+		assert.Equal(t, "1", r.Header.Get(EventIDHeader))
+		assert.Equal(t, "sha256="+Sign("secret", body), r.Header.Get(SignatureHeader))
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+	lock.Lock()
+	assert.Equal(t, 2, attempts)
+	lock.Unlock()
+}
+
+func TestWebhookReportsDroppedEvents(t *testing.T) {
+	// no delivery goroutine, so the queue fills up
+	w := &Webhook{config: WebhookConfig{URL: "TestWebhookReportsDroppedEvents"}, queue: make(chan Event, 1)}
+	for i := int64(1); i <= 3; i++ {
+		w.Send(Event{ID: i})
+	}
+	assert.Equal(t, float64(2), droppedEvents.Value("TestWebhookReportsDroppedEvents"))
+	assert.Equal(t, int64(0), (<-w.queue).Missed)
+
+	w.Send(Event{ID: 4})
+	event := <-w.queue
+	assert.Equal(t, int64(4), event.ID)
+	assert.Equal(t, int64(2), event.Missed)
+
+	w.Send(Event{ID: 5})
+	assert.Equal(t, int64(0), (<-w.queue).Missed)
+}
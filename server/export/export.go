@@ -0,0 +1,155 @@
+// Package export writes the metadata held by notary-server to a directory
+// tree that a static file host can serve in place of the server.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/signed"
+
+	"github.com/docker/notary/server/storage"
+	"github.com/docker/notary/server/timestamp"
+)
+
+// Options configures an export
+type Options struct {
+	// Dir is the directory the metadata is written under
+	Dir string
+	// GUNs are the GUNs to export. If empty, every GUN in the store is
+	// exported.
+	GUNs []string
+}
+
+// Export writes the current root, targets and snapshot of each GUN to
+// <Dir>/v2/<gun>/_trust/tuf/<role>.json, and every root version to
+// root.<version>.json beside them, matching the notary-server URLs, so
+// a client can be pointed at a static host serving Dir. A new timestamp is
+// signed for each GUN using cryptoService, which must hold the GUNs'
+// timestamp private keys. If cryptoService is nil, as for a mirror, the
+// stored timestamp is exported unchanged.
+func Export(opts Options, store storage.MetaStore, cryptoService signed.CryptoService) error {
+	guns := opts.GUNs
+	if len(guns) == 0 {
+		var err error
+		if guns, err = store.ListGUNs(); err != nil {
+			return err
+		}
+	}
+	for _, gun := range guns {
+		if err := exportGUN(opts, gun, store, cryptoService); err != nil {
+			return fmt.Errorf("unable to export %s: %v", gun, err)
+		}
+		logrus.Info("Exported ", gun)
+	}
+	return nil
+}
+
+func exportGUN(opts Options, gun string, store storage.MetaStore, cryptoService signed.CryptoService) error {
+	dir := filepath.Join(opts.Dir, "v2", filepath.FromSlash(gun), "_trust", "tuf")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	var snapshot []byte
+	for _, role := range []string{data.CanonicalRootRole, data.CanonicalTargetsRole, data.CanonicalSnapshotRole} {
+		meta, err := store.GetCurrent(gun, role)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(filepath.Join(dir, role+".json"), meta); err != nil {
+			return err
+		}
+		snapshot = meta
+	}
+
+	// every version of the root is kept, so that clients can walk the chain
+	// of roots from the one they trust to the current one
+	roots, err := store.GetVersions(gun, data.CanonicalRootRole, 0, 0)
+	if err != nil {
+		return err
+	}
+	for _, root := range roots {
+		if err := writeFile(filepath.Join(dir, fmt.Sprintf("%s.%d.json", data.CanonicalRootRole, root.Version)), root.Data); err != nil {
+			return err
+		}
+	}
+
+	ts, err := exportTimestamp(gun, snapshot, store, cryptoService)
+	if err != nil {
+		return err
+	}
+	// the timestamp is written last so that it never refers to a snapshot
+	// that has not been written yet
+	return writeFile(filepath.Join(dir, data.CanonicalTimestampRole+".json"), ts)
+}
+
+// exportTimestamp signs a new timestamp for snapshot the way the server
+// does, with the server's timestamp lifetime, and stores it as the current
+// timestamp. The export and the server then serve the same timestamp until
+// the server replaces it with a newer version, so clients can move between
+// them.
+func exportTimestamp(gun string, snapshot []byte, store storage.MetaStore, cryptoService signed.CryptoService) ([]byte, error) {
+	current, err := store.GetCurrent(gun, data.CanonicalTimestampRole)
+	if _, ok := err.(*storage.ErrNotFound); err != nil && !ok {
+		return nil, err
+	}
+	if cryptoService == nil {
+		if current == nil {
+			return nil, fmt.Errorf("no timestamp to export")
+		}
+		return current, nil
+	}
+
+	var prev *data.SignedTimestamp
+	if current != nil {
+		prev = &data.SignedTimestamp{}
+		if err := json.Unmarshal(current, prev); err != nil {
+			return nil, err
+		}
+	}
+	sgnd, version, err := timestamp.CreateTimestamp(gun, prev, snapshot, store, cryptoService)
+	if err != nil {
+		return nil, err
+	}
+	out, err := json.Marshal(sgnd)
+	if err != nil {
+		return nil, err
+	}
+	err = store.UpdateCurrent(gun, storage.MetaUpdate{Role: data.CanonicalTimestampRole, Version: version, Data: out})
+	if _, ok := err.(*storage.ErrOldVersion); ok {
+		return nil, fmt.Errorf("the server signed a new timestamp during the export, it must be rerun")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// writeFile replaces path with data, never leaving a partially written file
+// for the static host to serve
+func writeFile(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,114 @@
+package export
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/keys"
+	"github.com/endophage/gotuf/signed"
+	"github.com/endophage/gotuf/testutils"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/docker/notary/server/storage"
+	"github.com/docker/notary/server/timestamp"
+)
+
+func storeRepo(t *testing.T, store storage.MetaStore, gun string) map[string][]byte {
+	_, repo, _ := testutils.EmptyRepo()
+	r, tg, sn, ts, err := testutils.Sign(repo)
+	assert.NoError(t, err)
+	root, targets, snapshot, _, err := testutils.Serialize(r, tg, sn, ts)
+	assert.NoError(t, err)
+	metas := map[string][]byte{"root": root, "targets": targets, "snapshot": snapshot}
+	for role, meta := range metas {
+		assert.NoError(t, store.UpdateCurrent(gun, storage.MetaUpdate{Role: role, Version: 1, Data: meta}))
+	}
+	return metas
+}
+
+func TestExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notary-export")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store := storage.NewMemStorage()
+	crypto := signed.NewEd25519()
+	metas := storeRepo(t, store, "docker.com/notary")
+	key, err := timestamp.GetOrCreateTimestampKey("docker.com/notary", store, crypto, data.ED25519Key)
+	assert.NoError(t, err)
+
+	err = Export(Options{Dir: dir}, store, crypto)
+	assert.NoError(t, err)
+
+	tufDir := filepath.Join(dir, "v2", "docker.com", "notary", "_trust", "tuf")
+	for role, expected := range metas {
+		exported, err := ioutil.ReadFile(filepath.Join(tufDir, role+".json"))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, exported, role)
+	}
+
+	exported, err := ioutil.ReadFile(filepath.Join(tufDir, "root.1.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, metas["root"], exported)
+
+	tsJSON, err := ioutil.ReadFile(filepath.Join(tufDir, "timestamp.json"))
+	assert.NoError(t, err)
+	s := &data.Signed{}
+	assert.NoError(t, json.Unmarshal(tsJSON, s))
+	kdb := keys.NewDB()
+	kdb.AddKey(key)
+	role, err := data.NewRole("timestamp", 1, []string{key.ID()}, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, kdb.AddRole(role))
+	assert.NoError(t, signed.Verify(s, "timestamp", 0, kdb))
+
+	ts, err := data.TimestampFromSigned(s)
+	assert.NoError(t, err)
+	assert.True(t, ts.Signed.Expires.After(time.Now().Add(timestamp.DefaultLifetime-time.Hour)))
+
+	// the server serves the exported timestamp until it signs a newer one
+	stored, err := store.GetCurrent("docker.com/notary", "timestamp")
+	assert.NoError(t, err)
+	assert.Equal(t, tsJSON, stored)
+
+	first := ts.Signed.Version
+	assert.NoError(t, Export(Options{Dir: dir}, store, crypto))
+	tsJSON, err = ioutil.ReadFile(filepath.Join(tufDir, "timestamp.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(tsJSON, s))
+	ts, err = data.TimestampFromSigned(s)
+	assert.NoError(t, err)
+	assert.Equal(t, first+1, ts.Signed.Version)
+}
+
+func TestExportWithoutSigning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notary-export")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store := storage.NewMemStorage()
+	storeRepo(t, store, "gun")
+
+	// there is nothing to export as the timestamp
+	assert.Error(t, Export(Options{Dir: dir, GUNs: []string{"gun"}}, store, nil))
+
+	store.UpdateCurrent("gun", storage.MetaUpdate{Role: "timestamp", Version: 1, Data: []byte("ts")})
+	assert.NoError(t, Export(Options{Dir: dir, GUNs: []string{"gun"}}, store, nil))
+	exported, err := ioutil.ReadFile(filepath.Join(dir, "v2", "gun", "_trust", "tuf", "timestamp.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ts"), exported)
+}
+
+func TestExportMissingGUN(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notary-export")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = Export(Options{Dir: dir, GUNs: []string{"missing"}}, storage.NewMemStorage(), signed.NewEd25519())
+	assert.Error(t, err)
+}
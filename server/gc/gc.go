@@ -0,0 +1,82 @@
+// Package gc deletes old versions of TUF metadata from a MetaStore, so that
+// storage does not grow forever as timestamps are re-signed.
+package gc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	"github.com/docker/notary/pkg/metrics"
+	"github.com/docker/notary/server/storage"
+)
+
+// DefaultInterval is how often a Collector runs if no interval is configured
+const DefaultInterval = time.Hour
+
+var prunedVersions = metrics.NewCounterVec(
+	"notary_server_gc_pruned_versions_total",
+	"Old metadata versions deleted by the garbage collector.",
+)
+
+// Config is the retention policy a Collector enforces. Each role keeps its
+// KeepVersions newest versions and every version younger than KeepAge;
+// every root version is always kept.
+type Config struct {
+	KeepVersions int           `mapstructure:"keep_versions"`
+	KeepAge      time.Duration `mapstructure:"keep_age"`
+	Interval     time.Duration `mapstructure:"interval"`
+}
+
+// Collector prunes the versions a retention policy no longer keeps
+type Collector struct {
+	config Config
+	store  storage.MetaStore
+}
+
+// NewCollector creates a Collector pruning store
+func NewCollector(config Config, store storage.MetaStore) (*Collector, error) {
+	if config.KeepVersions < 1 {
+		return nil, fmt.Errorf("retention must keep at least one version of each role")
+	}
+	if config.KeepAge < 0 {
+		return nil, fmt.Errorf("retention age must not be negative")
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	return &Collector{config: config, store: store}, nil
+}
+
+// Run collects immediately, then once every interval until ctx is
+// cancelled. Failures are logged and retried on the next run.
+func (c *Collector) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := c.Collect(); err != nil {
+			logrus.Error("Garbage collection failed: ", err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collect deletes every version the retention policy no longer keeps,
+// returning how many were deleted
+func (c *Collector) Collect() (int, error) {
+	pruned, err := c.store.PruneVersions(storage.RetentionPolicy{
+		KeepVersions: c.config.KeepVersions,
+		KeepAfter:    time.Now().Add(-c.config.KeepAge),
+	})
+	prunedVersions.Add(float64(pruned))
+	if pruned > 0 {
+		logrus.Infof("Garbage collected %d old metadata versions", pruned)
+	}
+	return pruned, err
+}
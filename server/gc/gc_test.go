@@ -0,0 +1,82 @@
+package gc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/docker/notary/server/storage"
+)
+
+func storeVersions(t *testing.T, store storage.MetaStore, role string, count int) {
+	for i := 1; i <= count; i++ {
+		assert.NoError(t, store.UpdateCurrent("gun", storage.MetaUpdate{Role: role, Version: i, Data: []byte(role)}))
+	}
+}
+
+func TestNewCollectorValidates(t *testing.T) {
+	_, err := NewCollector(Config{}, storage.NewMemStorage())
+	assert.Error(t, err)
+	_, err = NewCollector(Config{KeepVersions: 1, KeepAge: -time.Hour}, storage.NewMemStorage())
+	assert.Error(t, err)
+
+	c, err := NewCollector(Config{KeepVersions: 1}, storage.NewMemStorage())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultInterval, c.config.Interval)
+}
+
+func TestCollect(t *testing.T) {
+	store := storage.NewMemStorage()
+	storeVersions(t, store, "root", 3)
+	storeVersions(t, store, "timestamp", 5)
+
+	c, err := NewCollector(Config{KeepVersions: 2}, store)
+	assert.NoError(t, err)
+	pruned, err := c.Collect()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, pruned)
+
+	versions, err := store.GetVersions("gun", "timestamp", 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, versions, 2)
+	versions, err = store.GetVersions("gun", "root", 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, versions, 3)
+
+	// versions younger than the age are kept
+	storeVersions(t, store, "targets", 5)
+	c, err = NewCollector(Config{KeepVersions: 1, KeepAge: time.Hour}, store)
+	assert.NoError(t, err)
+	pruned, err = c.Collect()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, pruned)
+}
+
+func TestRun(t *testing.T) {
+	store := storage.NewMemStorage()
+	storeVersions(t, store, "timestamp", 3)
+
+	c, err := NewCollector(Config{KeepVersions: 1, Interval: time.Millisecond}, store)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if versions, _ := store.GetVersions("gun", "timestamp", 0, 0); len(versions) == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	versions, err := store.GetVersions("gun", "timestamp", 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, versions, 1)
+}
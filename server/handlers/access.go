@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"github.com/docker/distribution/registry/auth"
+	"golang.org/x/net/context"
+)
+
+// pullChecker reports whether the caller of a request may pull a GUN, for
+// handlers such as the changefeed that return data about many GUNs. Each
+// GUN is only checked once per request.
+type pullChecker struct {
+	ctx     context.Context
+	ac      auth.AccessController
+	checked map[string]bool
+}
+
+// newPullChecker creates a pullChecker using the access controller the
+// request was authorized with. If access is not controlled, every GUN may
+// be pulled.
+func newPullChecker(ctx context.Context) *pullChecker {
+	ac, _ := ctx.Value("accessController").(auth.AccessController)
+	return &pullChecker{
+		ctx:     ctx,
+		ac:      ac,
+		checked: make(map[string]bool),
+	}
+}
+
+func (c *pullChecker) allowed(gun string) bool {
+	if c.ac == nil {
+		return true
+	}
+	allowed, ok := c.checked[gun]
+	if !ok {
+		_, err := c.ac.Authorized(c.ctx, auth.Access{
+			Resource: auth.Resource{Type: "repository", Name: gun},
+			Action:   "pull",
+		})
+		allowed = err == nil
+		c.checked[gun] = allowed
+	}
+	return allowed
+}
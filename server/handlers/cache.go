@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/endophage/gotuf/data"
+	"golang.org/x/net/context"
+
+	"github.com/docker/notary/server/storage"
+)
+
+// Cache lifetimes for metadata. The timestamp is re-signed by the server
+// and is what clients use to detect freshness, so it must not be cached
+// for long. The other top level roles may change on any push, but a
+// client always validates them against the timestamp and snapshot, so a
+// stale copy is only a performance concern. Content addressed
+// (consistent) metadata can never change.
+const (
+	timestampMaxAge  = 30 * time.Second
+	currentMaxAge    = 5 * time.Minute
+	consistentMaxAge = 30 * 24 * time.Hour
+)
+
+// maxAge returns the Cache-Control max-age to use for the given role.
+// consistent should be true when the requested file is addressed by
+// version or checksum, and therefore immutable.
+func maxAge(role string, consistent bool) time.Duration {
+	switch {
+	case consistent:
+		return consistentMaxAge
+	case role == data.CanonicalTimestampRole:
+		return timestampMaxAge
+	default:
+		return currentMaxAge
+	}
+}
+
+// etag returns a strong entity tag derived from the sha256 of the metadata
+func etag(meta []byte) string {
+	digest := sha256.Sum256(meta)
+	return `"` + hex.EncodeToString(digest[:]) + `"`
+}
+
+// etagMatches reports whether any of the tags in an If-None-Match header
+// value matches the entity tag
+func etagMatches(header, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		candidate = strings.TrimPrefix(candidate, "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheControl returns the Cache-Control header for the given role. When
+// access to metadata is controlled, shared caches such as proxies and CDNs
+// must not store it, since they would serve it to clients that were never
+// authorized, and the timestamp is not stored at all.
+func cacheControl(ctx context.Context, role string, consistent bool) string {
+	if accessControlled, _ := ctx.Value("accessControlled").(bool); accessControlled {
+		if role == data.CanonicalTimestampRole && !consistent {
+			return "no-store"
+		}
+		return fmt.Sprintf("private, max-age=%d", int(maxAge(role, consistent).Seconds()))
+	}
+	return fmt.Sprintf("public, max-age=%d", int(maxAge(role, consistent).Seconds()))
+}
+
+// notModified reports whether the request's conditional headers match the
+// metadata. If-Modified-Since is only considered without If-None-Match.
+func notModified(r *http.Request, tag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, tag)
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modified.IsZero() {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// writeMeta writes metadata to the response with ETag, Last-Modified and
+// Cache-Control headers set. If the request's conditional headers match the
+// metadata a 304 is written instead of the body.
+func writeMeta(ctx context.Context, w http.ResponseWriter, r *http.Request, role string, consistent bool, meta *storage.StoredMeta) {
+	tag := etag(meta.Data)
+	w.Header().Set("ETag", tag)
+	w.Header().Set("Cache-Control", cacheControl(ctx, role, consistent))
+	if !meta.CreatedAt.IsZero() {
+		w.Header().Set("Last-Modified", meta.CreatedAt.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, tag, meta.CreatedAt) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Write(meta.Data)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/docker/notary/server/storage"
+)
+
+func TestWriteMetaSetsHeaders(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	created := time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)
+	writeMeta(context.Background(), w, req, data.CanonicalTargetsRole, false,
+		&storage.StoredMeta{Data: []byte("targets"), CreatedAt: created})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "targets", w.Body.String())
+	assert.Equal(t, etag([]byte("targets")), w.Header().Get("ETag"))
+	assert.Equal(t, "public, max-age=300", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "Wed, 21 Oct 2015 07:28:00 GMT", w.Header().Get("Last-Modified"))
+}
+
+func TestWriteMetaNotModified(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", `"other", `+etag([]byte("timestamp")))
+	w := httptest.NewRecorder()
+	writeMeta(context.Background(), w, req, data.CanonicalTimestampRole, false,
+		&storage.StoredMeta{Data: []byte("timestamp")})
+
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, "", w.Body.String())
+	assert.Equal(t, "public, max-age=30", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "", w.Header().Get("Last-Modified"))
+}
+
+func TestWriteMetaModified(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", etag([]byte("old")))
+	w := httptest.NewRecorder()
+	writeMeta(context.Background(), w, req, data.CanonicalRootRole, true,
+		&storage.StoredMeta{Data: []byte("new")})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "new", w.Body.String())
+	assert.Equal(t, "public, max-age=2592000", w.Header().Get("Cache-Control"))
+}
+
+func TestWriteMetaIfModifiedSince(t *testing.T) {
+	created := time.Date(2015, 10, 21, 7, 28, 0, 500, time.UTC)
+	meta := &storage.StoredMeta{Data: []byte("root"), CreatedAt: created}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("If-Modified-Since", "Wed, 21 Oct 2015 07:28:00 GMT")
+	w := httptest.NewRecorder()
+	writeMeta(context.Background(), w, req, data.CanonicalRootRole, false, meta)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	req.Header.Set("If-Modified-Since", "Wed, 21 Oct 2015 07:27:59 GMT")
+	w = httptest.NewRecorder()
+	writeMeta(context.Background(), w, req, data.CanonicalRootRole, false, meta)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// If-None-Match takes precedence
+	req.Header.Set("If-Modified-Since", "Wed, 21 Oct 2015 07:28:00 GMT")
+	req.Header.Set("If-None-Match", etag([]byte("old")))
+	w = httptest.NewRecorder()
+	writeMeta(context.Background(), w, req, data.CanonicalRootRole, false, meta)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestWriteMetaAccessControlled(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "accessControlled", true)
+	req, _ := http.NewRequest("GET", "/", nil)
+
+	w := httptest.NewRecorder()
+	writeMeta(ctx, w, req, data.CanonicalTargetsRole, false, &storage.StoredMeta{Data: []byte("targets")})
+	assert.Equal(t, "private, max-age=300", w.Header().Get("Cache-Control"))
+
+	w = httptest.NewRecorder()
+	writeMeta(ctx, w, req, data.CanonicalTimestampRole, false, &storage.StoredMeta{Data: []byte("timestamp")})
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/gorilla/mux"
+	"golang.org/x/net/context"
+
+	ctxu "github.com/docker/distribution/context"
+	"github.com/docker/notary/errors"
+	"github.com/docker/notary/server/events"
+	"github.com/docker/notary/server/storage"
+)
+
+// Limits on the number of events returned by a single changefeed request
+const (
+	defaultChangefeedLimit = 100
+	maxChangefeedLimit     = 1000
+)
+
+// Limits on the number of targets versions read by a single request for the
+// history of a GUN. Each version is a whole targets file, so these are low.
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// changefeedResponse is the body returned by ChangefeedHandler
+type changefeedResponse struct {
+	Events []events.Event `json:"events"`
+	Cursor string         `json:"cursor"`
+}
+
+// ChangefeedHandler returns the events recorded since the cursor given in
+// the "cursor" query parameter (omitted to start from the oldest retained
+// event), along with the cursor to pass to retrieve the next page. Only
+// events for GUNs the caller may pull are returned. A cursor the feed can no
+// longer serve is rejected with ErrInvalidCursor, so that missed events are
+// never silently skipped.
+func ChangefeedHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	broker, ok := ctx.Value("eventBroker").(*events.Broker)
+	if !ok {
+		return errors.ErrNoEventFeed.WithDetail(nil)
+	}
+
+	cursor, limit, err := changefeedParams(r)
+	if err != nil {
+		return err
+	}
+
+	evts, next, err := broker.Feed().Since(cursor, limit)
+	if err != nil {
+		return errors.ErrInvalidCursor.WithDetail(err.Error())
+	}
+	pullable := newPullChecker(ctx)
+	visible := []events.Event{}
+	for _, evt := range evts {
+		if pullable.allowed(evt.GUN) {
+			visible = append(visible, evt)
+		}
+	}
+	evts = visible
+	out, err := json.Marshal(changefeedResponse{Events: evts, Cursor: next})
+	if err != nil {
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+	return nil
+}
+
+func changefeedParams(r *http.Request) (cursor string, limit int, err error) {
+	query := r.URL.Query()
+	limit = defaultChangefeedLimit
+	if l := query.Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxChangefeedLimit {
+			return "", 0, errors.ErrInvalidParameter.WithDetail("limit must be between 1 and 1000")
+		}
+	}
+	return query.Get("cursor"), limit, nil
+}
+
+// repoChangefeedResponse is the body returned by RepoChangefeedHandler.
+// If More is set, the next page starts from Version.
+type repoChangefeedResponse struct {
+	GUN     string                `json:"gun"`
+	Version int                   `json:"version"`
+	Changes []events.TargetChange `json:"changes"`
+	More    bool                  `json:"more"`
+}
+
+// RepoChangefeedHandler returns the target additions, removals and
+// modifications made to a GUN after the targets version given in the
+// "from" query parameter, or from the start of its history if "from" is
+// omitted. At most "limit" targets versions are considered per request.
+func RepoChangefeedHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	s := ctx.Value("metaStore")
+	store, ok := s.(storage.MetaStore)
+	if !ok {
+		return errors.ErrNoStorage.WithDetail(nil)
+	}
+	vars := mux.Vars(r)
+	gun := vars["imageName"]
+	logger := ctxu.GetLoggerWithField(ctx, gun, "gun")
+
+	from := 0
+	if f := r.URL.Query().Get("from"); f != "" {
+		var err error
+		from, err = strconv.Atoi(f)
+		if err != nil || from < 0 {
+			return errors.ErrInvalidParameter.WithDetail("from must be a non-negative integer")
+		}
+	}
+
+	limit := defaultHistoryLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxHistoryLimit {
+			return errors.ErrInvalidParameter.WithDetail(fmt.Sprintf("limit must be between 1 and %d", maxHistoryLimit))
+		}
+	}
+
+	// besides the page, read the "from" version and one more to know
+	// whether there is another page
+	versions, err := store.GetVersions(gun, data.CanonicalTargetsRole, from, limit+2)
+	if err != nil {
+		if _, ok := err.(*storage.ErrNotFound); ok {
+			return errors.ErrMetadataNotFound.WithDetail(nil)
+		}
+		logger.Error("500 GET changefeed")
+		return errors.ErrUnknown.WithDetail(err)
+	}
+
+	// the "from" version itself is the baseline changes are computed against
+	var baseline []byte
+	if from > 0 && len(versions) > 0 && versions[0].Version == from {
+		baseline = versions[0].Data
+		versions = versions[1:]
+	}
+	more := len(versions) > limit
+	if more {
+		versions = versions[:limit]
+	}
+	resp := repoChangefeedResponse{
+		GUN:     gun,
+		Version: from,
+		Changes: events.TargetsHistory(baseline, versions),
+		More:    more,
+	}
+	if len(versions) > 0 {
+		resp.Version = versions[len(versions)-1].Version
+	}
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+	logger.Debug("200 GET changefeed")
+	return nil
+}
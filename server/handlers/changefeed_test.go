@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/distribution/registry/auth"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/signed"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/docker/notary/server/events"
+	"github.com/docker/notary/server/storage"
+	"github.com/docker/notary/utils"
+)
+
+func TestChangefeedHandler(t *testing.T) {
+	broker := events.NewBroker(events.NewFeed(10))
+	broker.Publish(events.Event{GUN: "a"})
+	broker.Publish(events.Event{GUN: "b"})
+
+	ctx := context.WithValue(context.Background(), "eventBroker", broker)
+	hand := utils.RootHandlerFactory(nil, ctx, &signed.Ed25519{})
+	ts := httptest.NewServer(hand(ChangefeedHandler))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "?limit=1")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	feed := changefeedResponse{}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&feed))
+	assert.Len(t, feed.Events, 1)
+	assert.Equal(t, "a", feed.Events[0].GUN)
+
+	res, err = http.Get(ts.URL + "?cursor=" + feed.Cursor)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&feed))
+	assert.Len(t, feed.Events, 1)
+	assert.Equal(t, "b", feed.Events[0].GUN)
+}
+
+// gunController only authorizes pulls of a single GUN
+type gunController string
+
+func (c gunController) Authorized(ctx context.Context, access ...auth.Access) (context.Context, error) {
+	for _, a := range access {
+		if a.Name != string(c) {
+			return nil, fmt.Errorf("access to %s denied", a.Name)
+		}
+	}
+	return ctx, nil
+}
+
+func TestChangefeedHandlerFiltersByAccess(t *testing.T) {
+	broker := events.NewBroker(events.NewFeed(10))
+	broker.Publish(events.Event{GUN: "a"})
+	broker.Publish(events.Event{GUN: "b"})
+	broker.Publish(events.Event{GUN: "a"})
+
+	ctx := context.WithValue(context.Background(), "eventBroker", broker)
+	hand := utils.RootHandlerFactory(gunController("a"), ctx, &signed.Ed25519{})
+	ts := httptest.NewServer(hand(ChangefeedHandler))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	feed := changefeedResponse{}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&feed))
+	assert.Len(t, feed.Events, 2)
+	for _, evt := range feed.Events {
+		assert.Equal(t, "a", evt.GUN)
+	}
+}
+
+func TestReplacedTargets(t *testing.T) {
+	store := storage.NewMemStorage()
+	updates := make(map[int]storage.MetaUpdate)
+	for _, version := range []int{1, 3, 5} {
+		updates[version] = storage.MetaUpdate{Role: "targets", Version: version,
+			Data: targetsJSON(t, data.Files{fmt.Sprintf("v%d", version): {Length: 1}})}
+	}
+	assert.Nil(t, replacedTargets(store, "gun", []storage.MetaUpdate{updates[1]}))
+
+	// another update is applied between two others
+	for _, version := range []int{1, 3, 5} {
+		assert.NoError(t, store.UpdateCurrent("gun", updates[version]))
+	}
+	assert.Equal(t, updates[3].Data, replacedTargets(store, "gun", []storage.MetaUpdate{updates[5]}))
+	assert.Equal(t, updates[1].Data, replacedTargets(store, "gun", []storage.MetaUpdate{updates[3]}))
+	assert.Nil(t, replacedTargets(store, "gun", []storage.MetaUpdate{{Role: "snapshot", Version: 5}}))
+}
+
+func TestChangefeedHandlerBadCursor(t *testing.T) {
+	broker := events.NewBroker(events.NewFeed(10))
+	ctx := context.WithValue(context.Background(), "eventBroker", broker)
+	hand := utils.RootHandlerFactory(nil, ctx, &signed.Ed25519{})
+	ts := httptest.NewServer(hand(ChangefeedHandler))
+	defer ts.Close()
+
+	// e.g. a cursor from another server, or from before a restart
+	res, err := http.Get(ts.URL + "?cursor=abc")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusGone, res.StatusCode)
+
+	res, err = http.Get(ts.URL + "?limit=0")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestRepoChangefeedHandler(t *testing.T) {
+	store := storage.NewMemStorage()
+	store.UpdateCurrent("gun", storage.MetaUpdate{Role: "targets", Version: 1,
+		Data: targetsJSON(t, data.Files{"a": {Length: 1}})})
+	store.UpdateCurrent("gun", storage.MetaUpdate{Role: "targets", Version: 2,
+		Data: targetsJSON(t, data.Files{"a": {Length: 1}, "b": {Length: 1}})})
+
+	ctx := context.WithValue(context.Background(), "metaStore", store)
+	hand := utils.RootHandlerFactory(nil, ctx, &signed.Ed25519{})
+	r := mux.NewRouter()
+	r.Methods("GET").Path("/v2/{imageName:.*}/_trust/changefeed").Handler(hand(RepoChangefeedHandler))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/v2/gun/_trust/changefeed?from=1")
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	feed := repoChangefeedResponse{}
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&feed))
+	assert.Equal(t, 2, feed.Version)
+	assert.Len(t, feed.Changes, 1)
+	assert.Equal(t, "b", feed.Changes[0].Target)
+	assert.Equal(t, events.TargetAdded, feed.Changes[0].Change)
+
+	res, err = http.Get(ts.URL + "/v2/missing/_trust/changefeed")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res, err = http.Get(ts.URL + "/v2/gun/_trust/changefeed?from=-1")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestRepoChangefeedHandlerPages(t *testing.T) {
+	store := storage.NewMemStorage()
+	files := data.Files{}
+	for i := 1; i <= 5; i++ {
+		files[fmt.Sprintf("t%d", i)] = data.FileMeta{Length: 1}
+		store.UpdateCurrent("gun", storage.MetaUpdate{Role: "targets", Version: i,
+			Data: targetsJSON(t, files)})
+	}
+
+	ctx := context.WithValue(context.Background(), "metaStore", store)
+	hand := utils.RootHandlerFactory(nil, ctx, &signed.Ed25519{})
+	r := mux.NewRouter()
+	r.Methods("GET").Path("/v2/{imageName:.*}/_trust/changefeed").Handler(hand(RepoChangefeedHandler))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	var targets []string
+	from, pages := 0, 0
+	for {
+		res, err := http.Get(fmt.Sprintf("%s/v2/gun/_trust/changefeed?from=%d&limit=2", ts.URL, from))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		feed := repoChangefeedResponse{}
+		assert.NoError(t, json.NewDecoder(res.Body).Decode(&feed))
+		res.Body.Close()
+		pages++
+		for _, change := range feed.Changes {
+			targets = append(targets, change.Target)
+		}
+		if !feed.More {
+			assert.Equal(t, 5, feed.Version)
+			break
+		}
+		from = feed.Version
+	}
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, []string{"t1", "t2", "t3", "t4", "t5"}, targets)
+
+	res, err := http.Get(ts.URL + "/v2/gun/_trust/changefeed?limit=1000")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func targetsJSON(t *testing.T, files data.Files) []byte {
+	targets := data.NewTargets()
+	targets.Signed.Targets = files
+	out, err := json.Marshal(targets)
+	assert.NoError(t, err)
+	return out
+}
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/endophage/gotuf/data"
@@ -14,6 +16,8 @@ import (
 
 	ctxu "github.com/docker/distribution/context"
 	"github.com/docker/notary/errors"
+	"github.com/docker/notary/server/events"
+	"github.com/docker/notary/server/policy"
 	"github.com/docker/notary/server/storage"
 	"github.com/docker/notary/server/timestamp"
 )
@@ -35,6 +39,9 @@ func MainHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) er
 // backend is atomically updated with all the new records.
 func AtomicUpdateHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	defer r.Body.Close()
+	if readOnly(ctx) {
+		return errors.ErrReadOnly.WithDetail(nil)
+	}
 	s := ctx.Value("metaStore")
 	store, ok := s.(storage.MetaStore)
 	if !ok {
@@ -42,28 +49,47 @@ func AtomicUpdateHandler(ctx context.Context, w http.ResponseWriter, r *http.Req
 	}
 	vars := mux.Vars(r)
 	gun := vars["imageName"]
+	limits := uploadLimits(ctx)
+	r.Body = ioutil.NopCloser(newLimitReader(r.Body, limits.MaxRequestSize))
 	reader, err := r.MultipartReader()
 	if err != nil {
 		return errors.ErrMalformedUpload.WithDetail(nil)
 	}
 	var updates []storage.MetaUpdate
+	seen := make(map[string]bool)
 	for {
 		part, err := reader.NextPart()
 		if err == io.EOF {
 			break
+		} else if err != nil {
+			if isTooLarge(err) {
+				return errors.ErrUploadTooLarge.WithDetail(map[string]interface{}{"limit": limits.MaxRequestSize})
+			}
+			return errors.ErrMalformedUpload.WithDetail(nil)
+		}
+		if len(updates) >= limits.MaxParts {
+			return errors.ErrTooManyParts.WithDetail(map[string]interface{}{"limit": limits.MaxParts})
 		}
 		role := strings.TrimSuffix(part.FileName(), ".json")
 		if role == "" {
 			return errors.ErrNoFilename.WithDetail(nil)
 		} else if !data.ValidRole(role) {
 			return errors.ErrInvalidRole.WithDetail(role)
+		} else if !uploadable(role) {
+			return errors.ErrUnexpectedRole.WithDetail(role)
+		} else if seen[role] {
+			return errors.ErrDuplicateRole.WithDetail(role)
 		}
+		seen[role] = true
 		meta := &data.SignedMeta{}
 		var input []byte
 		inBuf := bytes.NewBuffer(input)
-		dec := json.NewDecoder(io.TeeReader(part, inBuf))
+		dec := json.NewDecoder(io.TeeReader(newLimitReader(part, limits.MaxMetadataSize), inBuf))
 		err = dec.Decode(meta)
 		if err != nil {
+			if isTooLarge(err) {
+				return errors.ErrUploadTooLarge.WithDetail(map[string]interface{}{"role": role, "limit": limits.MaxMetadataSize})
+			}
 			return errors.ErrMalformedJSON.WithDetail(nil)
 		}
 		version := meta.Signed.Version
@@ -73,16 +99,86 @@ func AtomicUpdateHandler(ctx context.Context, w http.ResponseWriter, r *http.Req
 			Data:    inBuf.Bytes(),
 		})
 	}
-	if err = validateUpdate(gun, updates, store); err != nil {
-		return errors.ErrMalformedUpload.WithDetail(err)
+	policies, _ := ctx.Value("targetsPolicy").(*policy.Engine)
+	if err = validateUpdate(gun, updates, store, policies); err != nil {
+		validationFailures.Inc(validationErrorType(err))
+		return serializeValidationError(err)
 	}
 	err = store.UpdateMany(gun, updates)
 	if err != nil {
+		if _, ok := err.(*storage.ErrOldVersion); ok {
+			return errors.ErrVersionConflict.WithDetail(validationDetail{Reason: err.Error()})
+		}
 		return errors.ErrUpdating.WithDetail(err)
 	}
+	if broker, ok := ctx.Value("eventBroker").(*events.Broker); ok {
+		broker.Publish(events.NewUpdateEvent(gun, updates, replacedTargets(store, gun, updates)))
+	}
 	return nil
 }
 
+// replacedTargets returns the targets file that a successful update
+// replaced, or nil if it did not update the targets or they are new. It is
+// read back after the update rather than before, because a concurrent
+// update may have been applied in between; versions only increase, so the
+// replaced file is the newest one older than the update.
+func replacedTargets(store storage.MetaStore, gun string, updates []storage.MetaUpdate) []byte {
+	version, updated := 0, false
+	for _, u := range updates {
+		if u.Role == data.CanonicalTargetsRole {
+			version, updated = u.Version, true
+		}
+	}
+	if !updated {
+		return nil
+	}
+	// versions are normally consecutive, so the previous one is tried first
+	for _, page := range []struct{ from, limit int }{{version - 1, 1}, {0, 0}} {
+		versions, err := store.GetVersions(gun, data.CanonicalTargetsRole, page.from, page.limit)
+		if err != nil {
+			return nil
+		}
+		var replaced []byte
+		for _, v := range versions {
+			if v.Version < version {
+				replaced = v.Data
+			}
+		}
+		if replaced != nil {
+			return replaced
+		}
+	}
+	return nil
+}
+
+// validationDetail is the detail sent to clients with validation errors
+type validationDetail struct {
+	Role   string `json:"role,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// serializeValidationError converts an error from validateUpdate into the
+// error code the client receives, so clients can tell failures apart
+func serializeValidationError(err error) error {
+	switch err := err.(type) {
+	case ErrBadHierarchy:
+		return errors.ErrBadHierarchy.WithDetail(validationDetail{Reason: err.msg})
+	case ErrBadRoot:
+		return errors.ErrBadRoot.WithDetail(validationDetail{Role: data.CanonicalRootRole, Reason: err.msg})
+	case ErrBadTargets:
+		return errors.ErrBadTargets.WithDetail(validationDetail{Role: err.role, Reason: err.msg})
+	case ErrBadSnapshot:
+		return errors.ErrBadSnapshot.WithDetail(validationDetail{Role: data.CanonicalSnapshotRole, Reason: err.msg})
+	case ErrValidation:
+		if len(err.Violations) > 0 {
+			return errors.ErrPolicyViolation.WithDetail(map[string]interface{}{"violations": err.Violations})
+		}
+		return errors.ErrMalformedUpload.WithDetail(validationDetail{Reason: err.msg})
+	default:
+		return errors.ErrMalformedUpload.WithDetail(validationDetail{Reason: err.Error()})
+	}
+}
+
 // GetHandler returns the json for a specified role and GUN.
 func GetHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	s := ctx.Value("metaStore")
@@ -96,7 +192,7 @@ func GetHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) err
 
 	logger := ctxu.GetLoggerWithFields(ctx, map[string]interface{}{"gun": gun, "tufRole": tufRole})
 
-	out, err := store.GetCurrent(gun, tufRole)
+	meta, err := store.GetCurrentMeta(gun, tufRole)
 	if err != nil {
 		if _, ok := err.(*storage.ErrNotFound); ok {
 			return errors.ErrMetadataNotFound.WithDetail(nil)
@@ -104,11 +200,46 @@ func GetHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) err
 		logger.Error("500 GET")
 		return errors.ErrUnknown.WithDetail(err)
 	}
-	if out == nil {
+	if meta.Data == nil {
 		logger.Error("404 GET")
 		return errors.ErrMetadataNotFound.WithDetail(nil)
 	}
-	w.Write(out)
+	writeMeta(ctx, w, r, tufRole, false, meta)
+	logger.Debug("200 GET")
+
+	return nil
+}
+
+// GetVersionHandler returns the json for a specific version of a role and
+// GUN. Clients use it to walk the chain of root versions.
+func GetVersionHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	s := ctx.Value("metaStore")
+	store, ok := s.(storage.MetaStore)
+	if !ok {
+		return errors.ErrNoStorage.WithDetail(nil)
+	}
+	vars := mux.Vars(r)
+	gun := vars["imageName"]
+	tufRole := vars["tufRole"]
+	version, err := strconv.Atoi(vars["version"])
+	if err != nil || version < 1 {
+		return errors.ErrMetadataNotFound.WithDetail(nil)
+	}
+
+	logger := ctxu.GetLoggerWithFields(ctx, map[string]interface{}{"gun": gun, "tufRole": tufRole, "version": version})
+
+	versions, err := store.GetVersions(gun, tufRole, version, 1)
+	if err != nil {
+		if _, ok := err.(*storage.ErrNotFound); ok {
+			return errors.ErrMetadataNotFound.WithDetail(nil)
+		}
+		logger.Error("500 GET")
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	if len(versions) == 0 || versions[0].Version != version {
+		return errors.ErrMetadataNotFound.WithDetail(nil)
+	}
+	writeMeta(ctx, w, r, tufRole, true, &versions[0])
 	logger.Debug("200 GET")
 
 	return nil
@@ -116,6 +247,9 @@ func GetHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) err
 
 // DeleteHandler deletes all data for a GUN. A 200 responses indicates success.
 func DeleteHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if readOnly(ctx) {
+		return errors.ErrReadOnly.WithDetail(nil)
+	}
 	s := ctx.Value("metaStore")
 	store, ok := s.(storage.MetaStore)
 	if !ok {
@@ -132,24 +266,66 @@ func DeleteHandler(ctx context.Context, w http.ResponseWriter, r *http.Request)
 	return nil
 }
 
-// GetTimestampHandler returns a timestamp.json given a GUN
-func GetTimestampHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+// ListGUNsHandler returns the GUNs the server holds metadata for that the
+// caller may pull. Mirrors use it to replicate every GUN on their upstream.
+func ListGUNsHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	s := ctx.Value("metaStore")
 	store, ok := s.(storage.MetaStore)
 	if !ok {
 		return errors.ErrNoStorage.WithDetail(nil)
 	}
-	cryptoServiceVal := ctx.Value("cryptoService")
-	cryptoService, ok := cryptoServiceVal.(signed.CryptoService)
+	guns, err := store.ListGUNs()
+	if err != nil {
+		ctxu.GetLogger(ctx).Error("500 GET GUN list")
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	access := newPullChecker(ctx)
+	allowed := make([]string, 0, len(guns))
+	for _, gun := range guns {
+		if access.allowed(gun) {
+			allowed = append(allowed, gun)
+		}
+	}
+	out, err := json.Marshal(gunListResponse{GUNs: allowed})
+	if err != nil {
+		return errors.ErrUnknown.WithDetail(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+	return nil
+}
+
+// gunListResponse is the body returned by ListGUNsHandler
+type gunListResponse struct {
+	GUNs []string `json:"guns"`
+}
+
+// GetTimestampHandler returns a timestamp.json given a GUN. A read-only
+// mirror returns the timestamp it replicated rather than signing a new one.
+func GetTimestampHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	s := ctx.Value("metaStore")
+	store, ok := s.(storage.MetaStore)
 	if !ok {
-		return errors.ErrNoCryptoService.WithDetail(nil)
+		return errors.ErrNoStorage.WithDetail(nil)
 	}
 
 	vars := mux.Vars(r)
 	gun := vars["imageName"]
 	logger := ctxu.GetLoggerWithField(ctx, gun, "gun")
 
-	out, err := timestamp.GetOrCreateTimestamp(gun, store, cryptoService)
+	var (
+		meta *storage.StoredMeta
+		err  error
+	)
+	if readOnly(ctx) {
+		meta, err = store.GetCurrentMeta(gun, data.CanonicalTimestampRole)
+	} else {
+		cryptoService, ok := ctx.Value("cryptoService").(signed.CryptoService)
+		if !ok {
+			return errors.ErrNoCryptoService.WithDetail(nil)
+		}
+		meta, err = timestamp.GetOrCreateTimestamp(gun, store, cryptoService)
+	}
 	if err != nil {
 		switch err.(type) {
 		case *storage.ErrNoKey, *storage.ErrNotFound:
@@ -162,13 +338,16 @@ func GetTimestampHandler(ctx context.Context, w http.ResponseWriter, r *http.Req
 	}
 
 	logger.Debug("200 GET timestamp")
-	w.Write(out)
+	writeMeta(ctx, w, r, data.CanonicalTimestampRole, false, meta)
 	return nil
 }
 
 // GetTimestampKeyHandler returns a timestamp public key, creating a new key-pair
 // it if it doesn't yet exist
 func GetTimestampKeyHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if readOnly(ctx) {
+		return errors.ErrReadOnly.WithDetail(nil)
+	}
 	vars := mux.Vars(r)
 	gun := vars["imageName"]
 
@@ -209,3 +388,10 @@ func GetTimestampKeyHandler(ctx context.Context, w http.ResponseWriter, r *http.
 	w.Write(out)
 	return nil
 }
+
+// readOnly reports whether the server is a mirror that must not modify its
+// store or sign anything
+func readOnly(ctx context.Context) bool {
+	ro, _ := ctx.Value("readOnly").(bool)
+	return ro
+}
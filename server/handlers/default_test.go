@@ -1,14 +1,20 @@
 package handlers
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"golang.org/x/net/context"
 
+	"github.com/docker/distribution/registry/api/errcode"
 	"github.com/endophage/gotuf/signed"
+	"github.com/gorilla/mux"
 
+	"github.com/docker/notary/errors"
+	"github.com/docker/notary/server/storage"
 	"github.com/docker/notary/utils"
 )
 
@@ -38,3 +44,148 @@ func TestMainHandlerNotGet(t *testing.T) {
 		t.Fatalf("Expected 404, received %d", res.StatusCode)
 	}
 }
+
+func TestSerializeValidationError(t *testing.T) {
+	cases := []struct {
+		err  error
+		code errcode.ErrorCode
+	}{
+		{ErrBadHierarchy{msg: "m"}, errors.ErrBadHierarchy},
+		{ErrBadRoot{msg: "m"}, errors.ErrBadRoot},
+		{ErrBadTargets{role: "targets", msg: "m"}, errors.ErrBadTargets},
+		{ErrBadSnapshot{msg: "m"}, errors.ErrBadSnapshot},
+		{ErrValidation{msg: "m"}, errors.ErrMalformedUpload},
+		{&storage.ErrNotFound{}, errors.ErrMalformedUpload},
+	}
+	for _, c := range cases {
+		serialized, ok := serializeValidationError(c.err).(errcode.Error)
+		if !ok {
+			t.Fatalf("Expected an errcode.Error for %v", c.err)
+		}
+		if serialized.Code != c.code {
+			t.Fatalf("Expected %s for %v, received %s", c.code, c.err, serialized.Code)
+		}
+	}
+
+	serialized := serializeValidationError(ErrBadRoot{msg: "m"}).(errcode.Error)
+	detail, ok := serialized.Detail.(validationDetail)
+	if !ok || detail.Role != "root" || detail.Reason != "m" {
+		t.Fatalf("Unexpected detail: %v", serialized.Detail)
+	}
+}
+
+func TestReadOnlyRejectsWrites(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "metaStore", storage.NewMemStorage())
+	ctx = context.WithValue(ctx, "readOnly", true)
+	hand := utils.RootHandlerFactory(nil, ctx, nil)
+
+	for _, h := range []http.Handler{hand(AtomicUpdateHandler), hand(DeleteHandler), hand(GetTimestampKeyHandler)} {
+		ts := httptest.NewServer(h)
+		res, err := http.Post(ts.URL, "text/plain", nil)
+		ts.Close()
+		if err != nil {
+			t.Fatalf("Received error: %s", err.Error())
+		}
+		if res.StatusCode != http.StatusMethodNotAllowed {
+			t.Fatalf("Expected 405, received %d", res.StatusCode)
+		}
+	}
+}
+
+func TestReadOnlyServesStoredTimestamp(t *testing.T) {
+	store := storage.NewMemStorage()
+	store.UpdateCurrent("", storage.MetaUpdate{Role: "timestamp", Version: 1, Data: []byte("{}")})
+	ctx := context.WithValue(context.Background(), "metaStore", store)
+	ctx = context.WithValue(ctx, "readOnly", true)
+	hand := utils.RootHandlerFactory(nil, ctx, nil)
+	ts := httptest.NewServer(hand(GetTimestampHandler))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Received error: %s", err.Error())
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, received %d", res.StatusCode)
+	}
+}
+
+func TestListGUNsHandler(t *testing.T) {
+	store := storage.NewMemStorage()
+	store.UpdateCurrent("b/two", storage.MetaUpdate{Role: "root", Version: 1, Data: []byte("{}")})
+	store.UpdateCurrent("a/one", storage.MetaUpdate{Role: "root", Version: 1, Data: []byte("{}")})
+	ctx := context.WithValue(context.Background(), "metaStore", store)
+	hand := utils.RootHandlerFactory(nil, ctx, nil)
+	ts := httptest.NewServer(hand(ListGUNsHandler))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Received error: %s", err.Error())
+	}
+	defer res.Body.Close()
+	var list gunListResponse
+	if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+		t.Fatalf("Unable to decode response: %s", err.Error())
+	}
+	if len(list.GUNs) != 2 || list.GUNs[0] != "a/one" || list.GUNs[1] != "b/two" {
+		t.Fatalf("Unexpected GUNs: %v", list.GUNs)
+	}
+}
+
+func TestListGUNsHandlerFiltersByAccess(t *testing.T) {
+	store := storage.NewMemStorage()
+	store.UpdateCurrent("b/two", storage.MetaUpdate{Role: "root", Version: 1, Data: []byte("{}")})
+	store.UpdateCurrent("a/one", storage.MetaUpdate{Role: "root", Version: 1, Data: []byte("{}")})
+	ctx := context.WithValue(context.Background(), "metaStore", store)
+	hand := utils.RootHandlerFactory(gunController("b/two"), ctx, nil)
+	ts := httptest.NewServer(hand(ListGUNsHandler))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Received error: %s", err.Error())
+	}
+	defer res.Body.Close()
+	var list gunListResponse
+	if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+		t.Fatalf("Unable to decode response: %s", err.Error())
+	}
+	if len(list.GUNs) != 1 || list.GUNs[0] != "b/two" {
+		t.Fatalf("Unexpected GUNs: %v", list.GUNs)
+	}
+}
+
+func TestGetVersionHandler(t *testing.T) {
+	store := storage.NewMemStorage()
+	store.UpdateCurrent("gun", storage.MetaUpdate{Role: "root", Version: 1, Data: []byte("one")})
+	store.UpdateCurrent("gun", storage.MetaUpdate{Role: "root", Version: 3, Data: []byte("three")})
+	ctx := context.WithValue(context.Background(), "metaStore", store)
+	hand := utils.RootHandlerFactory(nil, ctx, nil)
+	r := mux.NewRouter()
+	r.Methods("GET").Path("/{imageName:.*}/{tufRole:root}.{version:[0-9]+}.json").Handler(hand(GetVersionHandler))
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/gun/root.1.json")
+	if err != nil {
+		t.Fatalf("Received error: %s", err.Error())
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(body) != "one" {
+		t.Fatalf("Expected 200 with version 1, received %d: %s", res.StatusCode, body)
+	}
+
+	// version 2 was never stored, so the next version must not be served
+	for _, path := range []string{"/gun/root.2.json", "/gun/root.4.json", "/gun/root.0.json", "/other/root.1.json"} {
+		res, err = http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("Received error: %s", err.Error())
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusNotFound {
+			t.Fatalf("Expected 404 for %s, received %d", path, res.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/endophage/gotuf/data"
+	"golang.org/x/net/context"
+)
+
+// Defaults applied to zero valued UploadLimits fields
+const (
+	DefaultMaxRequestSize  = 20 << 20
+	DefaultMaxMetadataSize = 5 << 20
+	DefaultMaxParts        = 100
+)
+
+// UploadLimits bounds the updates accepted by AtomicUpdateHandler. They
+// are read from the "uploadLimits" context value.
+type UploadLimits struct {
+	// MaxRequestSize is the maximum size in bytes of a request body
+	MaxRequestSize int64
+	// MaxMetadataSize is the maximum size in bytes of the metadata for
+	// any single role
+	MaxMetadataSize int64
+	// MaxParts is the maximum number of roles, including delegations, in
+	// a single update
+	MaxParts int
+}
+
+// uploadable returns true if clients may upload role: root, targets and
+// its delegations, and snapshot. The timestamp is generated by the server.
+func uploadable(role string) bool {
+	switch role {
+	case data.CanonicalRootRole, data.CanonicalTargetsRole, data.CanonicalSnapshotRole:
+		return true
+	}
+	return strings.HasPrefix(role, data.CanonicalTargetsRole+"/")
+}
+
+func uploadLimits(ctx context.Context) UploadLimits {
+	limits, _ := ctx.Value("uploadLimits").(UploadLimits)
+	if limits.MaxRequestSize <= 0 {
+		limits.MaxRequestSize = DefaultMaxRequestSize
+	}
+	if limits.MaxMetadataSize <= 0 {
+		limits.MaxMetadataSize = DefaultMaxMetadataSize
+	}
+	if limits.MaxParts <= 0 {
+		limits.MaxParts = DefaultMaxParts
+	}
+	return limits
+}
+
+var errTooLarge = errors.New("size limit exceeded")
+
+// limitReader is like io.LimitReader, but returns errTooLarge rather than
+// io.EOF if there is more to read than the limit
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func newLimitReader(r io.Reader, n int64) io.Reader {
+	return &limitReader{r: r, n: n}
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errTooLarge
+	}
+	// allow reading one byte past the limit to detect overflow
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errTooLarge
+	}
+	return n, err
+}
+
+// isTooLarge returns true if err was caused by a limitReader. The multipart
+// reader wraps some read errors, so the message is checked as well.
+func isTooLarge(err error) bool {
+	return err == errTooLarge || strings.Contains(err.Error(), errTooLarge.Error())
+}
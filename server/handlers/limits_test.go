@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/endophage/gotuf/signed"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+
+	"github.com/docker/notary/server/storage"
+	"github.com/docker/notary/utils"
+)
+
+type part struct {
+	role string
+	body string
+}
+
+func uploadTestServer(limits UploadLimits) *httptest.Server {
+	ctx := context.WithValue(context.Background(), "metaStore", storage.NewMemStorage())
+	ctx = context.WithValue(ctx, "uploadLimits", limits)
+	hand := utils.RootHandlerFactory(nil, ctx, &signed.Ed25519{})
+	r := mux.NewRouter()
+	r.Methods("POST").Path("/v2/{imageName:.*}/_trust/tuf/").Handler(hand(AtomicUpdateHandler))
+	return httptest.NewServer(r)
+}
+
+func upload(t *testing.T, ts *httptest.Server, parts ...part) (int, string) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, p := range parts {
+		w, err := writer.CreateFormFile("files", p.role+".json")
+		assert.NoError(t, err)
+		w.Write([]byte(p.body))
+	}
+	writer.Close()
+
+	res, err := http.Post(ts.URL+"/v2/gun/_trust/tuf/", writer.FormDataContentType(), body)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+
+	errs := errcode.Errors{}
+	raw, _ := ioutil.ReadAll(res.Body)
+	json.Unmarshal(raw, &errs)
+	if len(errs) == 0 {
+		return res.StatusCode, ""
+	}
+	return res.StatusCode, errs[0].(errcode.Error).Code.Descriptor().Value
+}
+
+func TestAtomicUpdateRejectsDuplicateRole(t *testing.T) {
+	ts := uploadTestServer(UploadLimits{})
+	defer ts.Close()
+
+	status, code := upload(t, ts, part{"targets", "{}"}, part{"targets", "{}"})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "DUPLICATE_ROLE", code)
+}
+
+func TestAtomicUpdateRejectsTimestamp(t *testing.T) {
+	ts := uploadTestServer(UploadLimits{})
+	defer ts.Close()
+
+	status, code := upload(t, ts, part{"timestamp", "{}"})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "UNEXPECTED_ROLE", code)
+}
+
+func TestAtomicUpdateMetadataTooLarge(t *testing.T) {
+	ts := uploadTestServer(UploadLimits{MaxMetadataSize: 100})
+	defer ts.Close()
+
+	status, code := upload(t, ts, part{"targets", `{"signed": {"pad": "` + strings.Repeat("a", 200) + `"}}`})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+	assert.Equal(t, "UPLOAD_TOO_LARGE", code)
+}
+
+func TestAtomicUpdateRequestTooLarge(t *testing.T) {
+	ts := uploadTestServer(UploadLimits{MaxRequestSize: 100})
+	defer ts.Close()
+
+	status, code := upload(t, ts, part{"targets", `{"signed": {"pad": "` + strings.Repeat("a", 200) + `"}}`})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+	assert.Equal(t, "UPLOAD_TOO_LARGE", code)
+}
+
+func TestAtomicUpdateTooManyParts(t *testing.T) {
+	ts := uploadTestServer(UploadLimits{MaxParts: 2})
+	defer ts.Close()
+
+	status, code := upload(t, ts, part{"root", "{}"}, part{"targets", "{}"}, part{"snapshot", "{}"})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+	assert.Equal(t, "TOO_MANY_PARTS", code)
+
+	// at the limit, the update goes on to be validated
+	_, code = upload(t, ts, part{"targets", "{}"}, part{"snapshot", "{}"})
+	assert.NotEqual(t, "TOO_MANY_PARTS", code)
+}
+
+func TestLimitReader(t *testing.T) {
+	out, err := ioutil.ReadAll(newLimitReader(strings.NewReader("abc"), 3))
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", string(out))
+
+	_, err = ioutil.ReadAll(newLimitReader(strings.NewReader("abcd"), 3))
+	assert.Equal(t, errTooLarge, err)
+}
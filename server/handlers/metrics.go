@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"github.com/docker/notary/pkg/metrics"
+)
+
+var validationFailures = metrics.NewCounterVec(
+	"notary_server_validation_failures_total",
+	"Number of updates rejected by validation, partitioned by error type.",
+	"error",
+)
+
+// validationErrorType returns the name used to label a validation failure
+// in the validation failure metrics
+func validationErrorType(err error) string {
+	switch err.(type) {
+	case ErrValidation:
+		return "ErrValidation"
+	case ErrBadHierarchy:
+		return "ErrBadHierarchy"
+	case ErrBadRoot:
+		return "ErrBadRoot"
+	case ErrBadTargets:
+		return "ErrBadTargets"
+	case ErrBadSnapshot:
+		return "ErrBadSnapshot"
+	default:
+		return "Other"
+	}
+}
@@ -10,15 +10,18 @@ import (
 	"github.com/endophage/gotuf/data"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/docker/notary/server/policy"
 	"github.com/docker/notary/server/storage"
 	"github.com/endophage/gotuf/keys"
 	"github.com/endophage/gotuf/signed"
 	"github.com/endophage/gotuf/utils"
 )
 
-// ErrValidation represents a general validation error
+// ErrValidation represents a general validation error. If the update was
+// rejected by the targets policy, Violations lists the rules it broke.
 type ErrValidation struct {
-	msg string
+	msg        string
+	Violations []policy.Violation
 }
 
 func (err ErrValidation) Error() string {
@@ -47,7 +50,8 @@ func (err ErrBadRoot) Error() string {
 
 // ErrBadTargets represents a failure to validate a targets (incl delegations)
 type ErrBadTargets struct {
-	msg string
+	role string
+	msg  string
 }
 
 func (err ErrBadTargets) Error() string {
@@ -65,7 +69,7 @@ func (err ErrBadSnapshot) Error() string {
 
 // validateUpload checks that the updates being pushed
 // are semantically correct and the signatures are correct
-func validateUpdate(gun string, updates []storage.MetaUpdate, store storage.MetaStore) error {
+func validateUpdate(gun string, updates []storage.MetaUpdate, store storage.MetaStore, policies *policy.Engine) error {
 	kdb := keys.NewDB()
 	repo := tuf.NewTufRepo(kdb, nil)
 	rootRole := data.RoleName(data.CanonicalRootRole)
@@ -118,12 +122,13 @@ func validateUpdate(gun string, updates []storage.MetaUpdate, store storage.Meta
 		}
 	}
 
-	// TODO: validate delegated targets roles.
+	// TODO: validate the signatures of delegated targets roles. Until then
+	//       they are not checked against the policy either.
 	var t *data.SignedTargets
 	if _, ok := roles[targetsRole]; ok {
 		if t, err = validateTargets(targetsRole, roles, kdb); err != nil {
 			logrus.Error("ErrBadTargets: ", err.Error())
-			return ErrBadTargets{msg: err.Error()}
+			return ErrBadTargets{role: targetsRole, msg: err.Error()}
 		}
 		repo.SetTargets(targetsRole, t)
 	}
@@ -148,6 +153,23 @@ func validateUpdate(gun string, updates []storage.MetaUpdate, store storage.Meta
 		return ErrBadSnapshot{msg: err.Error()}
 	}
 	logrus.Debug("Successfully validated snapshot")
+
+	// policy is only checked once the update is known to be correctly signed
+	if policies != nil && t != nil {
+		return checkPolicy(gun, t, policies)
+	}
+	return nil
+}
+
+// checkPolicy checks the validated targets role against the policy for gun.
+// Delegations are not checked: their signatures are not verified, so
+// anything they contain could have been added by anyone able to push.
+func checkPolicy(gun string, t *data.SignedTargets, policies *policy.Engine) error {
+	violations := policies.Check(gun, data.CanonicalTargetsRole, t)
+	if len(violations) > 0 {
+		logrus.Error("ErrValidation: targets violate policy")
+		return ErrValidation{msg: "targets violate policy", Violations: violations}
+	}
 	return nil
 }
 
@@ -240,10 +262,8 @@ func validateTargets(role string, roles map[string]storage.MetaUpdate, kdb *keys
 //    root metadata. This requires they also provide a new
 //    snapshot.
 // N.B. users should never be updating timestamps. The server
-//      always handles timestamping. If the user does send a
-//      timestamp, the server will replace it on next
-//      GET timestamp.jsonshould it detect the current
-//      snapshot has a different hash to the one in the timestamp.
+//      always handles timestamping, and AtomicUpdateHandler rejects
+//      updates that include a timestamp.
 func hierarchyOK(roles map[string]storage.MetaUpdate) error {
 	snapshotRole := data.RoleName(data.CanonicalSnapshotRole)
 	if _, ok := roles[snapshotRole]; !ok {
@@ -1,13 +1,16 @@
 package handlers
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/endophage/gotuf/data"
 	"github.com/endophage/gotuf/signed"
 	"github.com/endophage/gotuf/testutils"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/docker/notary/server/policy"
 	"github.com/docker/notary/server/storage"
 )
 
@@ -43,7 +46,7 @@ func TestValidateEmptyNew(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.NoError(t, err)
 }
 
@@ -83,7 +86,7 @@ func TestValidateNoNewRoot(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.NoError(t, err)
 }
 
@@ -123,7 +126,7 @@ func TestValidateNoNewTargets(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.NoError(t, err)
 }
 
@@ -161,7 +164,7 @@ func TestValidateOnlySnapshot(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.NoError(t, err)
 }
 
@@ -206,7 +209,7 @@ func TestValidateOldRoot(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.NoError(t, err)
 }
 
@@ -278,7 +281,7 @@ func TestValidateRootRotation(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.NoError(t, err)
 }
 
@@ -309,7 +312,7 @@ func TestValidateNoRoot(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.Error(t, err)
 	assert.IsType(t, ErrValidation{}, err)
 }
@@ -336,7 +339,7 @@ func TestValidateSnapshotMissing(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.Error(t, err)
 	assert.IsType(t, ErrBadHierarchy{}, err)
 }
@@ -378,7 +381,7 @@ func TestValidateRootRoleMissing(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.Error(t, err)
 	assert.IsType(t, ErrBadRoot{}, err)
 }
@@ -417,7 +420,7 @@ func TestValidateTargetsRoleMissing(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.Error(t, err)
 	assert.IsType(t, ErrBadRoot{}, err)
 }
@@ -456,7 +459,7 @@ func TestValidateSnapshotRoleMissing(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.Error(t, err)
 	assert.IsType(t, ErrBadRoot{}, err)
 }
@@ -501,7 +504,7 @@ func TestValidateRootSigMissing(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.Error(t, err)
 	assert.IsType(t, ErrBadRoot{}, err)
 }
@@ -541,7 +544,7 @@ func TestValidateTargetsSigMissing(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.Error(t, err)
 	assert.IsType(t, ErrBadTargets{}, err)
 }
@@ -581,7 +584,7 @@ func TestValidateSnapshotSigMissing(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.Error(t, err)
 	assert.IsType(t, ErrBadSnapshot{}, err)
 }
@@ -624,7 +627,7 @@ func TestValidateRootCorrupt(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.Error(t, err)
 	assert.IsType(t, ErrBadRoot{}, err)
 }
@@ -664,7 +667,7 @@ func TestValidateTargetsCorrupt(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.Error(t, err)
 	assert.IsType(t, ErrBadTargets{}, err)
 }
@@ -704,7 +707,7 @@ func TestValidateSnapshotCorrupt(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.Error(t, err)
 	assert.IsType(t, ErrBadSnapshot{}, err)
 }
@@ -751,7 +754,7 @@ func TestValidateRootModifiedSize(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.Error(t, err)
 	assert.IsType(t, ErrBadRoot{}, err)
 }
@@ -792,7 +795,7 @@ func TestValidateTargetsModifiedSize(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.Error(t, err)
 	assert.IsType(t, ErrBadSnapshot{}, err)
 }
@@ -840,7 +843,7 @@ func TestValidateRootModifiedHash(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.Error(t, err)
 	assert.IsType(t, ErrBadSnapshot{}, err)
 }
@@ -885,9 +888,77 @@ func TestValidateTargetsModifiedHash(t *testing.T) {
 		},
 	}
 
-	err = validateUpdate("testGUN", updates, store)
+	err = validateUpdate("testGUN", updates, store, nil)
 	assert.Error(t, err)
 	assert.IsType(t, ErrBadSnapshot{}, err)
 }
 
 // ### End snapshot hash mismatch negative tests ###
+
+func TestValidateTargetsPolicy(t *testing.T) {
+	_, repo, _ := testutils.EmptyRepo()
+	store := storage.NewMemStorage()
+
+	r, tg, sn, ts, err := testutils.Sign(repo)
+	assert.NoError(t, err)
+	root, targets, snapshot, _, err := testutils.Serialize(r, tg, sn, ts)
+	assert.NoError(t, err)
+
+	updates := []storage.MetaUpdate{
+		{Role: "root", Version: 1, Data: root},
+		{Role: "targets", Version: 1, Data: targets},
+		{Role: "snapshot", Version: 1, Data: snapshot},
+	}
+
+	// the empty repo's targets expire well after an hour from now
+	policies, err := policy.NewEngine([]policy.Config{{GUNPrefix: "test", MaxExpiry: time.Hour}})
+	assert.NoError(t, err)
+
+	err = validateUpdate("testGUN", updates, store, policies)
+	verr, ok := err.(ErrValidation)
+	assert.True(t, ok)
+	assert.Len(t, verr.Violations, 1)
+	assert.Equal(t, policy.RuleMaxExpiry, verr.Violations[0].Rule)
+
+	err = validateUpdate("otherGUN", updates, store, policies)
+	assert.NoError(t, err)
+}
+
+func TestValidateDelegationPolicy(t *testing.T) {
+	_, repo, _ := testutils.EmptyRepo()
+	store := storage.NewMemStorage()
+
+	repo.Targets[data.CanonicalTargetsRole].Signed.Targets = data.Files{"stable": {Length: 1}}
+	delegation := data.NewTargets()
+	delegation.Signed.Targets = data.Files{"latest": {Length: 1}}
+	repo.Targets["targets/releases"] = delegation
+
+	r, tg, sn, ts, err := testutils.Sign(repo)
+	assert.NoError(t, err)
+	root, targets, snapshot, _, err := testutils.Serialize(r, tg, sn, ts)
+	assert.NoError(t, err)
+	sd, err := delegation.ToSigned()
+	assert.NoError(t, err)
+	delegated, err := json.Marshal(sd)
+	assert.NoError(t, err)
+
+	updates := []storage.MetaUpdate{
+		{Role: "root", Version: 1, Data: root},
+		{Role: "targets", Version: 1, Data: targets},
+		{Role: "targets/releases", Version: 1, Data: delegated},
+		{Role: "snapshot", Version: 1, Data: snapshot},
+	}
+
+	policies, err := policy.NewEngine([]policy.Config{{GUNPrefix: "test", TargetNamePattern: "^v"}})
+	assert.NoError(t, err)
+
+	// the delegation's signatures are not verified, so only the targets
+	// role is checked
+	err = validateUpdate("testGUN", updates, store, policies)
+	verr, ok := err.(ErrValidation)
+	assert.True(t, ok)
+	if assert.Len(t, verr.Violations, 1) {
+		assert.Equal(t, "targets", verr.Violations[0].Role)
+		assert.Equal(t, "stable", verr.Violations[0].Target)
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/signed"
+	"golang.org/x/net/context"
+
+	"github.com/docker/notary/server/storage"
+	"github.com/docker/notary/utils"
+)
+
+// The checks are run in the background rather than on every request, so
+// that the unauthenticated health endpoint can't be used to load the
+// storage backend or the signer. Signing may be expensive, so the
+// timestamp key is checked less often.
+const (
+	healthCheckPeriod       = 10 * time.Second
+	timestampKeyCheckPeriod = 5 * time.Minute
+)
+
+// healthChecker is implemented by signing services that can report on
+// whether they are reachable
+type healthChecker interface {
+	CheckHealth() error
+}
+
+// healthChecks builds the readiness checks for the server: the storage
+// backend can be reached and, for a remote signing service, the service can
+// be reached and can sign with the timestamp keys it holds. Every check runs
+// once before healthChecks returns, and stops when ctx is done.
+func healthChecks(ctx context.Context, trust signed.CryptoService) *utils.HealthChecks {
+	checks := utils.NewHealthChecks()
+
+	store, ok := ctx.Value("metaStore").(storage.MetaStore)
+	if ok {
+		checks.RegisterPeriodicFunc(ctx, "storage", store.CheckHealth, healthCheckPeriod)
+	} else {
+		checks.RegisterFunc("storage", func() error {
+			return fmt.Errorf("no storage configured")
+		})
+	}
+
+	// a local signing service is part of the server, so there is nothing
+	// to reach
+	hc, remote := trust.(healthChecker)
+	if !remote {
+		return checks
+	}
+	checks.RegisterPeriodicFunc(ctx, "trust_service", hc.CheckHealth, healthCheckPeriod)
+
+	if readOnly, _ := ctx.Value("readOnly").(bool); readOnly || store == nil {
+		// mirrors do no signing
+		return checks
+	}
+	keyCheck := &timestampKeyCheck{trust: trust, store: store}
+	checks.RegisterPeriodicFunc(ctx, "timestamp_key", keyCheck.Check, timestampKeyCheckPeriod)
+	return checks
+}
+
+// timestampKeyCheck verifies that the signing service can sign with the
+// timestamp key of an existing repository. It never creates keys, and
+// passes while no repository has a timestamp key yet.
+type timestampKeyCheck struct {
+	trust signed.CryptoService
+	store storage.MetaStore
+
+	lock sync.Mutex
+	gun  string
+}
+
+// Check signs with a timestamp key
+func (c *timestampKeyCheck) Check() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	algorithm, public, err := c.timestampKey()
+	if err != nil {
+		return fmt.Errorf("unable to find a timestamp key: %v", err)
+	}
+	if public == nil {
+		return nil
+	}
+	keyID := data.NewPublicKey(algorithm, public).ID()
+	if _, err := c.trust.Sign([]string{keyID}, []byte("health check")); err != nil {
+		return fmt.Errorf("unable to sign with the timestamp key of %s: %v", c.gun, err)
+	}
+	return nil
+}
+
+// timestampKey returns the timestamp key of the GUN used by the previous
+// check if it still has one, otherwise that of the first GUN that has one
+func (c *timestampKeyCheck) timestampKey() (data.KeyAlgorithm, []byte, error) {
+	if c.gun != "" {
+		algorithm, public, err := c.store.GetTimestampKey(c.gun)
+		if _, ok := err.(*storage.ErrNoKey); !ok {
+			return algorithm, public, err
+		}
+		c.gun = ""
+	}
+	guns, err := c.store.ListGUNs()
+	if err != nil {
+		return "", nil, err
+	}
+	for _, gun := range guns {
+		algorithm, public, err := c.store.GetTimestampKey(gun)
+		if _, ok := err.(*storage.ErrNoKey); ok {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		c.gun = gun
+		return algorithm, public, nil
+	}
+	return "", nil, nil
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/docker/notary/pkg/metrics"
+)
+
+var (
+	requestCount = metrics.NewCounterVec(
+		"notary_server_http_requests_total",
+		"Number of HTTP requests handled, partitioned by handler and status code.",
+		"handler", "code",
+	)
+	requestLatency = metrics.NewHistogramVec(
+		"notary_server_http_request_duration_seconds",
+		"Latency of HTTP requests, partitioned by handler.",
+		nil,
+		"handler",
+	)
+)
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// instrument wraps an http.Handler, recording the count and latency of
+// requests under the given handler name
+func instrument(name string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(rec, r)
+		requestLatency.ObserveSince(start, name)
+		requestCount.Inc(name, strconv.Itoa(rec.status))
+	})
+}
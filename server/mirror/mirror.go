@@ -0,0 +1,338 @@
+// Package mirror replicates TUF metadata from an upstream notary-server
+// into a local MetaStore, so that a read-only notary-server can serve it.
+package mirror
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/gotuf"
+	tufclient "github.com/endophage/gotuf/client"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/keys"
+	"github.com/endophage/gotuf/signed"
+	"github.com/endophage/gotuf/store"
+	"golang.org/x/net/context"
+
+	"github.com/docker/notary/client"
+	"github.com/docker/notary/server/storage"
+)
+
+// DefaultInterval is how often a Mirror syncs if no interval is configured
+const DefaultInterval = 5 * time.Minute
+
+// maxSize bounds the size of the metadata downloaded from upstream
+const maxSize int64 = 5 << 20
+
+// roles are the TUF roles a Mirror replicates
+var roles = []string{
+	data.CanonicalRootRole,
+	data.CanonicalTargetsRole,
+	data.CanonicalSnapshotRole,
+	data.CanonicalTimestampRole,
+}
+
+// Config describes the upstream server a Mirror replicates and the GUNs it
+// replicates from it. If GUNs is empty every GUN on the upstream that the
+// mirror may pull is replicated. Username and Password, if set, answer the
+// upstream's authentication challenges. TokenHosts are the hosts, other than
+// the upstream's, of token services they may be sent to.
+type Config struct {
+	Upstream   string        `mapstructure:"upstream"`
+	GUNs       []string      `mapstructure:"guns"`
+	Interval   time.Duration `mapstructure:"interval"`
+	Username   string        `mapstructure:"username"`
+	Password   string        `mapstructure:"password"`
+	TokenHosts []string      `mapstructure:"token_hosts"`
+}
+
+// Mirror periodically pulls the metadata for a set of GUNs from an upstream
+// notary-server, verifies it, and stores it unchanged.
+type Mirror struct {
+	config    Config
+	store     storage.MetaStore
+	roundTrip http.RoundTripper
+}
+
+// NewMirror creates a Mirror writing to store. A nil roundTrip uses
+// http.DefaultTransport.
+func NewMirror(config Config, store storage.MetaStore, roundTrip http.RoundTripper) (*Mirror, error) {
+	upstream, err := url.Parse(config.Upstream)
+	if err != nil {
+		return nil, err
+	}
+	if !upstream.IsAbs() {
+		return nil, fmt.Errorf("mirror upstream must be an absolute URL")
+	}
+	config.Upstream = strings.TrimRight(config.Upstream, "/")
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	if roundTrip == nil {
+		roundTrip = http.DefaultTransport
+	}
+	if config.Username != "" {
+		roundTrip = client.NewAuthTransport(roundTrip, client.StaticCredentials{
+			Username: config.Username,
+			Password: config.Password,
+		}, config.TokenHosts...)
+	}
+	return &Mirror{config: config, store: store, roundTrip: roundTrip}, nil
+}
+
+// Run syncs immediately, then once every interval until ctx is cancelled.
+// Failures are logged and retried on the next sync.
+func (m *Mirror) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+	for {
+		if err := m.SyncAll(); err != nil {
+			logrus.Error("Mirror sync failed: ", err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SyncAll syncs every configured GUN, or every GUN on the upstream if none
+// are configured. It carries on past GUNs that fail to sync, returning the
+// last error.
+func (m *Mirror) SyncAll() error {
+	guns := m.config.GUNs
+	if len(guns) == 0 {
+		var err error
+		if guns, err = m.listGUNs(); err != nil {
+			return fmt.Errorf("unable to list upstream GUNs: %v", err)
+		}
+	}
+	var lastErr error
+	for _, gun := range guns {
+		if err := m.Sync(gun); err != nil {
+			logrus.Errorf("Unable to mirror %s: %s", gun, err.Error())
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// Sync downloads the upstream metadata for gun and, once it has been
+// verified, stores every role that changed in a single update. The first
+// time a GUN is synced its root is trusted on first use; afterwards new
+// metadata must verify against the root already stored, and may not roll
+// back any version. Every root version between the stored root and the
+// upstream's is verified and stored too, so that clients can walk the chain
+// of roots through the mirror.
+func (m *Mirror) Sync(gun string) error {
+	remote, err := store.NewHTTPStore(
+		m.config.Upstream+"/v2/"+gun+"/_trust/tuf/",
+		"",
+		"json",
+		"",
+		"key",
+		m.roundTrip,
+	)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string][]byte)
+	for _, role := range roles {
+		meta, err := m.store.GetCurrent(gun, role)
+		if _, ok := err.(*storage.ErrNotFound); err != nil && !ok {
+			return err
+		}
+		if meta != nil {
+			current[role] = meta
+		}
+	}
+
+	rootJSON, ok := current[data.CanonicalRootRole]
+	if !ok {
+		logrus.Infof("Trusting the upstream root for %s on first use", gun)
+		if rootJSON, err = remote.GetMeta(data.CanonicalRootRole, maxSize); err != nil {
+			return err
+		}
+	}
+	kdb := keys.NewDB()
+	repo := tuf.NewTufRepo(kdb, nil)
+	if err := trustRoot(repo, kdb, rootJSON); err != nil {
+		return err
+	}
+
+	cached := make(map[string][]byte)
+	for role, meta := range current {
+		cached[role] = meta
+	}
+	cached[data.CanonicalRootRole] = rootJSON
+	cache := store.NewMemoryStore(cached, nil)
+
+	if err := tufclient.NewClient(repo, remote, kdb, cache).Update(); err != nil {
+		return err
+	}
+
+	newestRoot, _ := cache.GetMeta(data.CanonicalRootRole, maxSize)
+	updates, err := rootChain(gun, remote, current[data.CanonicalRootRole], newestRoot)
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		meta, _ := cache.GetMeta(role, maxSize)
+		if meta == nil || bytes.Equal(meta, current[role]) {
+			continue
+		}
+		version, err := metaVersion(meta)
+		if err != nil {
+			return err
+		}
+		updates = append(updates, storage.MetaUpdate{Role: role, Version: version, Data: meta})
+	}
+	if len(updates) == 0 {
+		logrus.Debugf("%s is up to date", gun)
+		return nil
+	}
+	logrus.Infof("Mirrored %d updated files for %s", len(updates), gun)
+	return m.store.UpdateMany(gun, updates)
+}
+
+// rootChain returns the updates storing each root version after the one in
+// storedRoot, or after none on the first sync, and before the one in
+// newestRoot, oldest first. Each must be signed by its own root keys and by
+// those of the root before it, and newestRoot by those of the last one. On
+// the first sync the oldest root has no predecessor and is trusted on first
+// use. As for clients walking the chain, expiry is not checked since only
+// newestRoot needs to be current. If the upstream does not serve every
+// version the chain can't be verified, so none are returned.
+func rootChain(gun string, remote store.RemoteStore, storedRoot, newestRoot []byte) ([]storage.MetaUpdate, error) {
+	if newestRoot == nil || bytes.Equal(storedRoot, newestRoot) {
+		return nil, nil
+	}
+	newestSigned, newest, err := parseRoot(newestRoot)
+	if err != nil {
+		return nil, err
+	}
+	var prev *data.SignedRoot
+	first := 1
+	if storedRoot != nil {
+		if _, prev, err = parseRoot(storedRoot); err != nil {
+			return nil, err
+		}
+		first = prev.Signed.Version + 1
+	}
+
+	var chain []storage.MetaUpdate
+	for version := first; version < newest.Signed.Version; version++ {
+		raw, err := remote.GetMeta(fmt.Sprintf("%s.%d", data.CanonicalRootRole, version), maxSize)
+		if _, ok := err.(store.ErrMetaNotFound); ok {
+			logrus.Warnf("Upstream does not serve root version %d for %s, its intermediate roots are not mirrored", version, gun)
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		s, root, err := parseRoot(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid root version %d: %v", version, err)
+		}
+		if root.Signed.Version != version {
+			return nil, fmt.Errorf("upstream returned root version %d for version %d", root.Signed.Version, version)
+		}
+		if prev != nil {
+			if err := signedByRoot(s, prev); err != nil {
+				return nil, fmt.Errorf("root version %d is not signed by version %d: %v", version, prev.Signed.Version, err)
+			}
+		}
+		if err := signedByRoot(s, root); err != nil {
+			return nil, fmt.Errorf("root version %d is not signed by its own keys: %v", version, err)
+		}
+		chain = append(chain, storage.MetaUpdate{Role: data.CanonicalRootRole, Version: version, Data: raw})
+		prev = root
+	}
+	if len(chain) > 0 {
+		if err := signedByRoot(newestSigned, prev); err != nil {
+			return nil, fmt.Errorf("root version %d is not signed by version %d: %v", newest.Signed.Version, prev.Signed.Version, err)
+		}
+	}
+	return chain, nil
+}
+
+// listGUNs retrieves the GUNs held by the upstream server that the mirror
+// may pull
+func (m *Mirror) listGUNs() ([]string, error) {
+	req, err := http.NewRequest("GET", m.config.Upstream+"/v2/_trust/guns", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.roundTrip.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upstream returned %d", resp.StatusCode)
+	}
+	var list struct {
+		GUNs []string `json:"guns"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	return list.GUNs, nil
+}
+
+// trustRoot loads rootJSON into repo, checking that it is signed by its own
+// root keys
+func trustRoot(repo *tuf.TufRepo, kdb *keys.KeyDB, rootJSON []byte) error {
+	s, root, err := parseRoot(rootJSON)
+	if err != nil {
+		return err
+	}
+	if err := repo.SetRoot(root); err != nil {
+		return err
+	}
+	return signed.Verify(s, data.CanonicalRootRole, 0, kdb)
+}
+
+// parseRoot parses a serialized root
+func parseRoot(rootJSON []byte) (*data.Signed, *data.SignedRoot, error) {
+	s := &data.Signed{}
+	if err := json.Unmarshal(rootJSON, s); err != nil {
+		return nil, nil, err
+	}
+	root, err := data.RootFromSigned(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, root, nil
+}
+
+// signedByRoot checks that s is signed by the threshold of the root keys of
+// root, without checking its expiry
+func signedByRoot(s *data.Signed, root *data.SignedRoot) error {
+	kdb := keys.NewDB()
+	if err := tuf.NewTufRepo(kdb, nil).SetRoot(root); err != nil {
+		return err
+	}
+	return signed.VerifySignatures(s, data.CanonicalRootRole, kdb)
+}
+
+// metaVersion returns the version of a serialized TUF file
+func metaVersion(meta []byte) (int, error) {
+	s := &data.Signed{}
+	if err := json.Unmarshal(meta, s); err != nil {
+		return 0, err
+	}
+	common := &data.SignedCommon{}
+	if err := json.Unmarshal(s.Signed, common); err != nil {
+		return 0, err
+	}
+	return common.Version, nil
+}
@@ -0,0 +1,255 @@
+package mirror
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/endophage/gotuf"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/testutils"
+	"github.com/endophage/gotuf/utils"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/docker/notary/server/storage"
+)
+
+// upstream serves TUF files the way notary-server does. If password is
+// set, requests must authenticate with it.
+type upstream struct {
+	lock     sync.Mutex
+	files    map[string][]byte
+	password string
+}
+
+func (u *upstream) set(gun string, root, targets, snapshot, timestamp []byte) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.files[gun+"/root"] = root
+	u.files[gun+"/targets"] = targets
+	u.files[gun+"/snapshot"] = snapshot
+	u.files[gun+"/timestamp"] = timestamp
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if _, password, _ := r.BasicAuth(); password != u.password {
+		w.Header().Set("WWW-Authenticate", `Basic realm="notary"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Path == "/v2/_trust/guns" {
+		guns := []string{}
+		for k := range u.files {
+			if strings.HasSuffix(k, "/root") {
+				guns = append(guns, strings.TrimSuffix(k, "/root"))
+			}
+		}
+		json.NewEncoder(w).Encode(map[string][]string{"guns": guns})
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	path = strings.Replace(path, "/_trust/tuf/", "/", 1)
+	meta, ok := u.files[strings.TrimSuffix(path, ".json")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(meta)
+}
+
+func newUpstream() (*upstream, *httptest.Server) {
+	u := &upstream{files: make(map[string][]byte)}
+	return u, httptest.NewServer(u)
+}
+
+func publish(t *testing.T, u *upstream, gun string, repo *tuf.TufRepo) (root, targets, snapshot, timestamp []byte) {
+	r, tg, sn, ts, err := testutils.Sign(repo)
+	assert.NoError(t, err)
+	root, targets, snapshot, timestamp, err = testutils.Serialize(r, tg, sn, ts)
+	assert.NoError(t, err)
+	u.set(gun, root, targets, snapshot, timestamp)
+	u.lock.Lock()
+	u.files[fmt.Sprintf("%s/root.%d", gun, repo.Root.Signed.Version)] = root
+	u.lock.Unlock()
+	return
+}
+
+func addTarget(t *testing.T, repo *tuf.TufRepo, name string) {
+	content := []byte(name)
+	_, err := repo.AddTargets("targets", data.Files{name: data.FileMeta{
+		Length: int64(len(content)),
+		Hashes: data.Hashes{"sha256": utils.DoHash("sha256", content)},
+	}})
+	assert.NoError(t, err)
+}
+
+func TestSyncStoresVerifiedMetadata(t *testing.T) {
+	u, ts := newUpstream()
+	defer ts.Close()
+	_, repo, _ := testutils.EmptyRepo()
+	root, targets, snapshot, timestamp := publish(t, u, "gun", repo)
+
+	store := storage.NewMemStorage()
+	m, err := NewMirror(Config{Upstream: ts.URL, GUNs: []string{"gun"}}, store, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, m.SyncAll())
+
+	for role, expected := range map[string][]byte{"root": root, "targets": targets, "snapshot": snapshot, "timestamp": timestamp} {
+		stored, err := store.GetCurrent("gun", role)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, stored, role)
+	}
+
+	// a new target is picked up on the next sync
+	addTarget(t, repo, "latest")
+	_, targets, _, _ = publish(t, u, "gun", repo)
+	assert.NoError(t, m.Sync("gun"))
+	stored, err := store.GetCurrent("gun", "targets")
+	assert.NoError(t, err)
+	assert.Equal(t, targets, stored)
+}
+
+func TestSyncStoresRootChain(t *testing.T) {
+	u, ts := newUpstream()
+	defer ts.Close()
+	_, repo, _ := testutils.EmptyRepo()
+	publish(t, u, "gun", repo)
+
+	store := storage.NewMemStorage()
+	m, err := NewMirror(Config{Upstream: ts.URL, GUNs: []string{"gun"}}, store, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Sync("gun"))
+
+	// the root is republished several times between syncs, and each of the
+	// versions the mirror did not see is stored so clients can walk them
+	var roots [][]byte
+	for i := 0; i < 3; i++ {
+		root, _, _, _ := publish(t, u, "gun", repo)
+		roots = append(roots, root)
+	}
+	assert.NoError(t, m.Sync("gun"))
+
+	versions, err := store.GetVersions("gun", "root", 2, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, versions, 3) {
+		for i, v := range versions {
+			assert.Equal(t, i+2, v.Version)
+			assert.Equal(t, roots[i], v.Data)
+		}
+	}
+}
+
+func TestSyncRejectsBrokenRootChain(t *testing.T) {
+	u, ts := newUpstream()
+	defer ts.Close()
+	_, repo, _ := testutils.EmptyRepo()
+	publish(t, u, "gun", repo)
+
+	store := storage.NewMemStorage()
+	m, err := NewMirror(Config{Upstream: ts.URL, GUNs: []string{"gun"}}, store, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Sync("gun"))
+	trusted, err := store.GetCurrent("gun", "targets")
+	assert.NoError(t, err)
+
+	// root version 3 is replaced by one signed only by other keys, so it
+	// isn't signed by version 2 and version 4 isn't signed by it
+	other, otherServer := newUpstream()
+	defer otherServer.Close()
+	_, otherRepo, _ := testutils.EmptyRepo()
+	var forged []byte
+	for i := 0; i < 3; i++ {
+		forged, _, _, _ = publish(t, other, "gun", otherRepo)
+	}
+	for i := 0; i < 3; i++ {
+		publish(t, u, "gun", repo)
+	}
+	addTarget(t, repo, "latest")
+	publish(t, u, "gun", repo)
+	u.lock.Lock()
+	u.files["gun/root.3"] = forged
+	u.lock.Unlock()
+
+	assert.Error(t, m.Sync("gun"))
+
+	// nothing is stored, not even the versions before the broken link
+	versions, err := store.GetVersions("gun", "root", 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, versions, 1)
+	stored, err := store.GetCurrent("gun", "targets")
+	assert.NoError(t, err)
+	assert.Equal(t, trusted, stored)
+}
+
+func TestSyncRejectsUntrustedMetadata(t *testing.T) {
+	u, ts := newUpstream()
+	defer ts.Close()
+	_, repo, _ := testutils.EmptyRepo()
+	publish(t, u, "gun", repo)
+
+	store := storage.NewMemStorage()
+	m, err := NewMirror(Config{Upstream: ts.URL}, store, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Sync("gun"))
+	trusted, err := store.GetCurrent("gun", "targets")
+	assert.NoError(t, err)
+
+	// the upstream is replaced by a repository with different keys
+	_, other, _ := testutils.EmptyRepo()
+	addTarget(t, other, "latest")
+	publish(t, u, "gun", other)
+
+	assert.Error(t, m.Sync("gun"))
+	stored, err := store.GetCurrent("gun", "targets")
+	assert.NoError(t, err)
+	assert.Equal(t, trusted, stored)
+}
+
+func TestSyncAllListsUpstreamGUNs(t *testing.T) {
+	u, ts := newUpstream()
+	defer ts.Close()
+	for _, gun := range []string{"a/one", "b/two"} {
+		_, repo, _ := testutils.EmptyRepo()
+		publish(t, u, gun, repo)
+	}
+
+	store := storage.NewMemStorage()
+	m, err := NewMirror(Config{Upstream: ts.URL}, store, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, m.SyncAll())
+
+	guns, err := store.ListGUNs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a/one", "b/two"}, guns)
+}
+
+func TestSyncAllAuthenticates(t *testing.T) {
+	u, ts := newUpstream()
+	defer ts.Close()
+	u.password = "secret"
+	_, repo, _ := testutils.EmptyRepo()
+	publish(t, u, "gun", repo)
+
+	store := storage.NewMemStorage()
+	m, err := NewMirror(Config{Upstream: ts.URL}, store, nil)
+	assert.NoError(t, err)
+	assert.Error(t, m.SyncAll())
+
+	m, err = NewMirror(Config{Upstream: ts.URL, Username: "mirror", Password: "secret"}, store, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, m.SyncAll())
+	guns, err := store.ListGUNs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gun"}, guns)
+}
+
+func TestNewMirrorRequiresAbsoluteUpstream(t *testing.T) {
+	_, err := NewMirror(Config{Upstream: "notary.example.com"}, storage.NewMemStorage(), nil)
+	assert.Error(t, err)
+}
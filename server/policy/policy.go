@@ -0,0 +1,149 @@
+// Package policy enforces organisational rules on the targets pushed to
+// notary-server, beyond what TUF itself requires.
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/endophage/gotuf/data"
+)
+
+// Names of the rules a Violation can refer to
+const (
+	RuleTargetName     = "target_name_pattern"
+	RuleRequiredHashes = "required_hashes"
+	RuleMaxTargets     = "max_targets"
+	RuleMaxExpiry      = "max_expiry"
+)
+
+// Config describes the rules applied to the GUNs starting with GUNPrefix.
+// Zero valued rules are not enforced.
+type Config struct {
+	GUNPrefix string `mapstructure:"gun_prefix"`
+	// TargetNamePattern is a regular expression every target name must match
+	// in full, as if it were wrapped in ^(?: and )$
+	TargetNamePattern string `mapstructure:"target_name_pattern"`
+	// RequiredHashes are the hash algorithms every target must have a
+	// digest for, e.g. "sha512"
+	RequiredHashes []string `mapstructure:"required_hashes"`
+	// MaxTargets is the maximum number of targets in any one targets role
+	MaxTargets int `mapstructure:"max_targets"`
+	// MaxExpiry is how far in the future a targets role may expire
+	MaxExpiry time.Duration `mapstructure:"max_expiry"`
+}
+
+// Violation describes a way in which a targets role in an update breaks
+// a rule
+type Violation struct {
+	Role    string `json:"role"`
+	Rule    string `json:"rule"`
+	Target  string `json:"target,omitempty"`
+	Message string `json:"message"`
+}
+
+type gunPolicy struct {
+	Config
+	namePattern *regexp.Regexp
+}
+
+// Engine checks targets against the policy for their GUN. When several
+// policies match a GUN, only the one with the longest prefix applies, so
+// a general policy can be overridden for part of the namespace. Of
+// several policies with the same prefix, the first configured applies.
+type Engine struct {
+	policies []gunPolicy
+}
+
+// NewEngine validates the configs and instantiates an Engine
+func NewEngine(configs []Config) (*Engine, error) {
+	e := &Engine{}
+	for _, c := range configs {
+		p := gunPolicy{Config: c}
+		if c.TargetNamePattern != "" {
+			pattern, err := regexp.Compile("^(?:" + c.TargetNamePattern + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid target_name_pattern for %q: %v", c.GUNPrefix, err)
+			}
+			p.namePattern = pattern
+		}
+		if c.MaxTargets < 0 || c.MaxExpiry < 0 {
+			return nil, fmt.Errorf("limits for %q must not be negative", c.GUNPrefix)
+		}
+		e.policies = append(e.policies, p)
+	}
+	// longest prefix first, so the first match is the most specific
+	sort.Stable(byPrefixLength(e.policies))
+	return e, nil
+}
+
+// Check returns every violation of gun's policy by targets, the metadata
+// for role, which is either the targets role or a delegation. If no policy
+// applies to gun, there are none.
+func (e *Engine) Check(gun, role string, targets *data.SignedTargets) []Violation {
+	var p *gunPolicy
+	for i := range e.policies {
+		if strings.HasPrefix(gun, e.policies[i].GUNPrefix) {
+			p = &e.policies[i]
+			break
+		}
+	}
+	if p == nil {
+		return nil
+	}
+
+	var violations []Violation
+	files := targets.Signed.Targets
+	if p.MaxTargets > 0 && len(files) > p.MaxTargets {
+		violations = append(violations, Violation{
+			Role:    role,
+			Rule:    RuleMaxTargets,
+			Message: fmt.Sprintf("%d targets exceeds the maximum of %d", len(files), p.MaxTargets),
+		})
+	}
+	if p.MaxExpiry > 0 {
+		if limit := time.Now().Add(p.MaxExpiry); targets.Signed.Expires.After(limit) {
+			violations = append(violations, Violation{
+				Role:    role,
+				Rule:    RuleMaxExpiry,
+				Message: fmt.Sprintf("%s expires at %s, later than the maximum of %s from now", role, targets.Signed.Expires.Format(time.RFC3339), p.MaxExpiry),
+			})
+		}
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if p.namePattern != nil && !p.namePattern.MatchString(name) {
+			violations = append(violations, Violation{
+				Role:    role,
+				Rule:    RuleTargetName,
+				Target:  name,
+				Message: fmt.Sprintf("target name does not match %s", p.TargetNamePattern),
+			})
+		}
+		for _, alg := range p.RequiredHashes {
+			if _, ok := files[name].Hashes[alg]; !ok {
+				violations = append(violations, Violation{
+					Role:    role,
+					Rule:    RuleRequiredHashes,
+					Target:  name,
+					Message: fmt.Sprintf("target has no %s hash", alg),
+				})
+			}
+		}
+	}
+	return violations
+}
+
+type byPrefixLength []gunPolicy
+
+func (p byPrefixLength) Len() int           { return len(p) }
+func (p byPrefixLength) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byPrefixLength) Less(i, j int) bool { return len(p[i].GUNPrefix) > len(p[j].GUNPrefix) }
@@ -0,0 +1,85 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func testTargets(files data.Files, expires time.Time) *data.SignedTargets {
+	t := data.NewTargets()
+	t.Signed.Targets = files
+	t.Signed.Expires = expires
+	return t
+}
+
+func TestCheck(t *testing.T) {
+	e, err := NewEngine([]Config{{
+		GUNPrefix:         "docker.com/",
+		TargetNamePattern: `^v[0-9]+$`,
+		RequiredHashes:    []string{"sha512"},
+		MaxTargets:        1,
+		MaxExpiry:         24 * time.Hour,
+	}})
+	assert.NoError(t, err)
+
+	targets := testTargets(data.Files{
+		"v1":     {Hashes: data.Hashes{"sha512": []byte("a")}},
+		"latest": {Hashes: data.Hashes{"sha256": []byte("b")}},
+	}, time.Now().Add(48*time.Hour))
+
+	violations := e.Check("docker.com/notary", "targets/releases", targets)
+	assert.Len(t, violations, 4)
+	assert.Equal(t, RuleMaxTargets, violations[0].Rule)
+	assert.Equal(t, RuleMaxExpiry, violations[1].Rule)
+	assert.Equal(t, Violation{Role: "targets/releases", Rule: RuleTargetName, Target: "latest", Message: "target name does not match ^v[0-9]+$"}, violations[2])
+	assert.Equal(t, RuleRequiredHashes, violations[3].Rule)
+	assert.Equal(t, "latest", violations[3].Target)
+
+	assert.Empty(t, e.Check("example.com/notary", "targets", targets))
+}
+
+func TestCheckNamePatternMatchesWholeName(t *testing.T) {
+	e, err := NewEngine([]Config{{TargetNamePattern: `v[0-9]+`}})
+	assert.NoError(t, err)
+
+	targets := testTargets(data.Files{"v1": {}, "evil-v1-backdoor": {}}, time.Now())
+	violations := e.Check("docker.com/notary", "targets", targets)
+	if assert.Len(t, violations, 1) {
+		assert.Equal(t, RuleTargetName, violations[0].Rule)
+		assert.Equal(t, "evil-v1-backdoor", violations[0].Target)
+	}
+}
+
+func TestCheckLongestPrefixWins(t *testing.T) {
+	e, err := NewEngine([]Config{
+		{GUNPrefix: "", MaxTargets: 1},
+		{GUNPrefix: "docker.com/", MaxTargets: 10},
+	})
+	assert.NoError(t, err)
+
+	targets := testTargets(data.Files{"a": {}, "b": {}}, time.Now())
+	assert.Empty(t, e.Check("docker.com/notary", "targets", targets))
+	assert.Len(t, e.Check("example.com/notary", "targets", targets), 1)
+}
+
+func TestCheckSamePrefixFirstWins(t *testing.T) {
+	configs := []Config{{GUNPrefix: "docker.com/", MaxTargets: 10}}
+	for i := 0; i < 10; i++ {
+		configs = append(configs, Config{GUNPrefix: "docker.com/", MaxTargets: 1})
+	}
+	e, err := NewEngine(configs)
+	assert.NoError(t, err)
+
+	targets := testTargets(data.Files{"a": {}, "b": {}}, time.Now())
+	assert.Empty(t, e.Check("docker.com/notary", "targets", targets))
+}
+
+func TestNewEngineInvalid(t *testing.T) {
+	_, err := NewEngine([]Config{{TargetNamePattern: "("}})
+	assert.Error(t, err)
+	_, err = NewEngine([]Config{{MaxTargets: -1}})
+	assert.Error(t, err)
+}
@@ -1,11 +1,11 @@
 package server
 
 import (
-	"crypto/rand"
 	"crypto/tls"
-	"fmt"
 	"net"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/docker/distribution/registry/auth"
@@ -18,6 +18,10 @@ import (
 	"github.com/docker/notary/utils"
 )
 
+// shutdownTimeout is how long Run waits for open connections to finish
+// their requests once its context is cancelled
+const shutdownTimeout = 30 * time.Second
+
 func init() {
 	data.SetDefaultExpiryTimes(
 		map[string]int{
@@ -28,8 +32,13 @@ func init() {
 
 // Run sets up and starts a TLS server that can be cancelled using the
 // given configuration. The context it is passed is the context it should
-// use directly for the TLS server, and generate children off for requests
-func Run(ctx context.Context, addr, tlsCertFile, tlsKeyFile string, trust signed.CryptoService, authMethod string, authOpts interface{}) error {
+// use directly for the TLS server, and generate children off for requests.
+// When the context is cancelled the server stops accepting connections,
+// closes idle ones and returns nil once in-flight requests have completed.
+// Requests aren't cancelled along with ctx, so that updates can complete.
+// A nil tlsConfig disables TLS, and a nil access controller disables
+// authentication.
+func Run(ctx context.Context, addr string, tlsConfig *tls.Config, trust signed.CryptoService, ac auth.AccessController) error {
 
 	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
 	if err != nil {
@@ -41,63 +50,133 @@ func Run(ctx context.Context, addr, tlsCertFile, tlsKeyFile string, trust signed
 		return err
 	}
 
-	if tlsCertFile != "" && tlsKeyFile != "" {
-		keypair, err := tls.LoadX509KeyPair(tlsCertFile, tlsKeyFile)
-		if err != nil {
-			return err
-		}
-		tlsConfig := &tls.Config{
-			MinVersion:               tls.VersionTLS12,
-			PreferServerCipherSuites: true,
-			CipherSuites: []uint16{
-				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-				tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-				tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
-				tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
-				tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
-				tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
-				tls.TLS_RSA_WITH_AES_128_CBC_SHA,
-				tls.TLS_RSA_WITH_AES_256_CBC_SHA,
-			},
-			Certificates: []tls.Certificate{keypair},
-			Rand:         rand.Reader,
-		}
-
+	if tlsConfig != nil {
 		logrus.Info("Enabling TLS")
 		lsnr = tls.NewListener(lsnr, tlsConfig)
-	} else if tlsCertFile != "" || tlsKeyFile != "" {
-		return fmt.Errorf("Partial TLS configuration found. Either include both a cert and key file in the configuration, or include neither to disable TLS.")
 	}
 
-	var ac auth.AccessController
-	if authMethod == "token" {
-		authOptions, ok := authOpts.(map[string]interface{})
-		if !ok {
-			return fmt.Errorf("auth.options must be a map[string]interface{}")
-		}
-		ac, err = auth.GetAccessController(authMethod, authOptions)
-		if err != nil {
-			return err
-		}
-	}
-	hand := utils.RootHandlerFactory(ac, ctx, trust)
+	hand := utils.RootHandlerFactory(ac, detachedContext{ctx}, trust)
 
 	r := mux.NewRouter()
-	r.Methods("GET").Path("/v2/").Handler(hand(handlers.MainHandler))
-	r.Methods("POST").Path("/v2/{imageName:.*}/_trust/tuf/").Handler(hand(handlers.AtomicUpdateHandler, "push", "pull"))
-	r.Methods("GET").Path("/v2/{imageName:.*}/_trust/tuf/{tufRole:(root|targets|snapshot)}.json").Handler(hand(handlers.GetHandler, "pull"))
-	r.Methods("GET").Path("/v2/{imageName:.*}/_trust/tuf/timestamp.json").Handler(hand(handlers.GetTimestampHandler, "pull"))
-	r.Methods("GET").Path("/v2/{imageName:.*}/_trust/tuf/timestamp.key").Handler(hand(handlers.GetTimestampKeyHandler, "push", "pull"))
-	r.Methods("DELETE").Path("/v2/{imageName:.*}/_trust/tuf/").Handler(hand(handlers.DeleteHandler, "push", "pull"))
-	r.Methods("GET", "POST", "PUT", "HEAD", "DELETE").Path("/{other:.*}").Handler(hand(utils.NotFoundHandler))
+	r.Methods("GET").Path("/v2/").Handler(instrument("MainHandler", hand(handlers.MainHandler)))
+	r.Methods("GET").Path("/v2/_trust/changefeed").Handler(instrument("ChangefeedHandler", hand(handlers.ChangefeedHandler)))
+	r.Methods("GET").Path("/v2/_trust/guns").Handler(instrument("ListGUNsHandler", hand(handlers.ListGUNsHandler)))
+	r.Methods("POST").Path("/v2/{imageName:.*}/_trust/tuf/").Handler(instrument("AtomicUpdateHandler", hand(handlers.AtomicUpdateHandler, "push", "pull")))
+	r.Methods("GET").Path("/v2/{imageName:.*}/_trust/tuf/{tufRole:(root|targets|snapshot)}.json").Handler(instrument("GetHandler", hand(handlers.GetHandler, "pull")))
+	r.Methods("GET").Path("/v2/{imageName:.*}/_trust/tuf/{tufRole:root}.{version:[0-9]+}.json").Handler(instrument("GetVersionHandler", hand(handlers.GetVersionHandler, "pull")))
+	r.Methods("GET").Path("/v2/{imageName:.*}/_trust/tuf/timestamp.json").Handler(instrument("GetTimestampHandler", hand(handlers.GetTimestampHandler, "pull")))
+	r.Methods("GET").Path("/v2/{imageName:.*}/_trust/tuf/timestamp.key").Handler(instrument("GetTimestampKeyHandler", hand(handlers.GetTimestampKeyHandler, "push", "pull")))
+	r.Methods("GET").Path("/v2/{imageName:.*}/_trust/changefeed").Handler(instrument("RepoChangefeedHandler", hand(handlers.RepoChangefeedHandler, "pull")))
+	r.Methods("DELETE").Path("/v2/{imageName:.*}/_trust/tuf/").Handler(instrument("DeleteHandler", hand(handlers.DeleteHandler, "delete")))
+	r.Methods("GET").Path("/_notary_server/health").Handler(healthChecks(ctx, trust))
+	r.Methods("GET", "POST", "PUT", "HEAD", "DELETE").Path("/{other:.*}").Handler(instrument("NotFoundHandler", hand(utils.NotFoundHandler)))
+	conns := newConnTracker()
 	svr := http.Server{
-		Addr:    addr,
-		Handler: r,
+		Addr:      addr,
+		Handler:   r,
+		ConnState: conns.track,
 	}
 
+	go func() {
+		<-ctx.Done()
+		svr.SetKeepAlivesEnabled(false)
+		lsnr.Close()
+		conns.closeIdle()
+	}()
+
 	logrus.Info("Starting on ", addr)
 
 	err = svr.Serve(lsnr)
 
-	return err
+	select {
+	case <-ctx.Done():
+		// the listener was closed to shut down, not because of an error
+		logrus.Info("Shutting down, waiting for in-flight requests")
+		if !waitTimeout(&conns.open, shutdownTimeout) {
+			logrus.Warn("Timed out waiting for in-flight requests")
+		}
+		return nil
+	default:
+		return err
+	}
+}
+
+// connTracker follows the state of the server's connections, so that
+// shutdown can close the idle ones and wait for the others to complete
+// their requests, in particular updates.
+type connTracker struct {
+	lock    sync.Mutex
+	open    sync.WaitGroup
+	conns   map[net.Conn]http.ConnState
+	closing bool
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{conns: make(map[net.Conn]http.ConnState)}
+}
+
+// track is an http.Server ConnState hook. New connections are counted as
+// they are accepted, before Serve can return.
+func (c *connTracker) track(conn net.Conn, state http.ConnState) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	switch state {
+	case http.StateNew:
+		c.open.Add(1)
+		c.conns[conn] = state
+	case http.StateActive:
+		c.conns[conn] = state
+	case http.StateIdle:
+		c.conns[conn] = state
+		if c.closing {
+			conn.Close()
+		}
+	case http.StateHijacked, http.StateClosed:
+		if _, ok := c.conns[conn]; ok {
+			delete(c.conns, conn)
+			c.open.Done()
+		}
+	}
+}
+
+// closeIdle closes the connections not serving a request, and any that
+// become idle afterwards
+func (c *connTracker) closeIdle() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.closing = true
+	for conn, state := range c.conns {
+		if state == http.StateNew || state == http.StateIdle {
+			conn.Close()
+		}
+	}
+}
+
+// detachedContext carries the values of a context but not its
+// cancellation, so that requests aren't aborted when the server shuts down
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// waitTimeout waits for wg, returning false if timeout elapses first
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
 }
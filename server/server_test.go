@@ -1,23 +1,29 @@
 package server
 
 import (
+	"fmt"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
-	_ "github.com/docker/distribution/registry/auth/silly"
+	"github.com/endophage/gotuf/data"
 	"github.com/endophage/gotuf/signed"
 	"golang.org/x/net/context"
+
+	"github.com/docker/notary/server/storage"
+	"github.com/docker/notary/utils"
 )
 
 func TestRunBadAddr(t *testing.T) {
 	err := Run(
 		context.Background(),
 		"testAddr",
-		"../fixtures/notary-server.crt",
-		"../fixtures/notary-server.crt",
+		nil,
 		signed.NewEd25519(),
-		"",
 		nil,
 	)
 	if err == nil {
@@ -31,10 +37,8 @@ func TestRunReservedPort(t *testing.T) {
 	err := Run(
 		ctx,
 		"localhost:80",
-		"../fixtures/notary-server.crt",
-		"../fixtures/notary-server.crt",
+		nil,
 		signed.NewEd25519(),
-		"",
 		nil,
 	)
 
@@ -45,3 +49,218 @@ func TestRunReservedPort(t *testing.T) {
 		t.Fatalf("Received unexpected err: %s", err.Error())
 	}
 }
+
+func TestInstrumentRecordsStatus(t *testing.T) {
+	handler := instrument("TestInstrumentHandler", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	// the counters are global, so only the change made by this request is
+	// checked
+	count := requestCount.Value("TestInstrumentHandler", "404")
+	observations := requestLatency.Count("TestInstrumentHandler")
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected 404, received %d", res.StatusCode)
+	}
+	if c := requestCount.Value("TestInstrumentHandler", "404") - count; c != 1 {
+		t.Fatalf("Expected 1 request to be counted, found %v", c)
+	}
+	if c := requestLatency.Count("TestInstrumentHandler") - observations; c != 1 {
+		t.Fatalf("Expected 1 latency observation, found %d", c)
+	}
+}
+
+// remoteCryptoService makes a local crypto service look like a remote
+// signing service, whose signatures fail with err
+type remoteCryptoService struct {
+	signed.CryptoService
+	err error
+}
+
+func (r *remoteCryptoService) CheckHealth() error {
+	return nil
+}
+
+func (r *remoteCryptoService) Sign(keyIDs []string, toSign []byte) ([]data.Signature, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.CryptoService.Sign(keyIDs, toSign)
+}
+
+// storeWithTimestampKey returns a store holding a timestamp key, created in
+// trust, for gun
+func storeWithTimestampKey(t *testing.T, trust signed.CryptoService, gun string) storage.MetaStore {
+	store := storage.NewMemStorage()
+	key, err := trust.Create("timestamp", data.ED25519Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetTimestampKey(gun, key.Algorithm(), key.Public()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateCurrent(gun, storage.MetaUpdate{Role: "root", Version: 1, Data: []byte("{}")}); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestTimestampKeyCheck(t *testing.T) {
+	trust := &remoteCryptoService{CryptoService: signed.NewEd25519()}
+	check := &timestampKeyCheck{trust: trust, store: storage.NewMemStorage()}
+	if err := check.Check(); err != nil {
+		t.Fatalf("Expected timestamp key check to pass without any timestamp keys: %s", err.Error())
+	}
+
+	check = &timestampKeyCheck{trust: trust, store: storeWithTimestampKey(t, trust, "gun")}
+	if err := check.Check(); err != nil {
+		t.Fatalf("Expected timestamp key check to succeed: %s", err.Error())
+	}
+	if check.gun != "gun" {
+		t.Fatalf("Expected the timestamp key of gun to be used, got %q", check.gun)
+	}
+
+	trust.err = fmt.Errorf("signer unavailable")
+	if err := check.Check(); err == nil {
+		t.Fatal("Expected timestamp key check to fail when signing fails")
+	}
+}
+
+func TestHealthChecksRunTimestampKeyCheckImmediately(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trust := &remoteCryptoService{CryptoService: signed.NewEd25519()}
+	ctx = context.WithValue(ctx, "metaStore", storeWithTimestampKey(t, trust, "gun"))
+	trust.err = fmt.Errorf("signer unavailable")
+	status := healthChecks(ctx, trust).Status()
+	if status.Checks["timestamp_key"].Status != utils.HealthError {
+		t.Fatalf("Expected the timestamp key check to fail on startup, got %v", status.Checks["timestamp_key"])
+	}
+	if status.Checks["trust_service"].Status != utils.HealthOK {
+		t.Fatalf("Expected the trust service check to pass, got %v", status.Checks["trust_service"])
+	}
+}
+
+func TestHealthChecksLocalSigner(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = context.WithValue(ctx, "metaStore", storage.NewMemStorage())
+	status := healthChecks(ctx, signed.NewEd25519()).Status()
+	if status.Status != utils.HealthOK || len(status.Checks) != 1 {
+		t.Fatalf("Expected only the passing storage check with a local signer, got %v", status)
+	}
+}
+
+func TestRunShutsDownOnCancel(t *testing.T) {
+	// find a free port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, addr, nil, signed.NewEd25519(), nil)
+	}()
+
+	// wait for the server to come up
+	for i := 0; ; i++ {
+		res, err := http.Get("http://" + addr + "/v2/")
+		if err == nil {
+			res.Body.Close()
+			break
+		}
+		if i == 50 {
+			t.Fatalf("Server did not start: %s", err.Error())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Expected a clean shutdown, received: %s", err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after its context was cancelled")
+	}
+}
+
+func TestConnTrackerClosesIdleConnections(t *testing.T) {
+	c := newConnTracker()
+	idle, active := &fakeConn{}, &fakeConn{}
+	c.track(idle, http.StateNew)
+	c.track(idle, http.StateActive)
+	c.track(idle, http.StateIdle)
+	c.track(active, http.StateNew)
+	c.track(active, http.StateActive)
+
+	c.closeIdle()
+	if !idle.closed {
+		t.Fatal("Expected the idle connection to be closed")
+	}
+	if active.closed {
+		t.Fatal("Expected the active connection to be left open")
+	}
+	c.track(idle, http.StateClosed)
+	if waitTimeout(&c.open, 10*time.Millisecond) {
+		t.Fatal("Expected to wait for the active connection")
+	}
+
+	// once its request completes it's closed too
+	c.track(active, http.StateIdle)
+	if !active.closed {
+		t.Fatal("Expected the connection to be closed once idle")
+	}
+	c.track(active, http.StateClosed)
+	if !waitTimeout(&c.open, time.Second) {
+		t.Fatal("Expected no open connections")
+	}
+}
+
+func TestDetachedContext(t *testing.T) {
+	parent, cancel := context.WithCancel(context.WithValue(context.Background(), "key", "value"))
+	ctx := detachedContext{parent}
+	cancel()
+	if ctx.Err() != nil || ctx.Done() != nil {
+		t.Fatal("Expected the detached context not to be cancelled")
+	}
+	if ctx.Value("key") != "value" {
+		t.Fatal("Expected the detached context to carry its parent's values")
+	}
+}
+
+// fakeConn is a net.Conn that only records whether it was closed
+type fakeConn struct {
+	net.Conn
+	closed bool
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestWaitTimeout(t *testing.T) {
+	var wg sync.WaitGroup
+	if !waitTimeout(&wg, time.Second) {
+		t.Fatal("Expected an idle WaitGroup not to time out")
+	}
+	wg.Add(1)
+	if waitTimeout(&wg, 10*time.Millisecond) {
+		t.Fatal("Expected a busy WaitGroup to time out")
+	}
+	wg.Done()
+}
@@ -0,0 +1,329 @@
+package storage
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/gotuf/data"
+
+	"github.com/docker/notary/pkg/metrics"
+)
+
+var cacheLookups = metrics.NewCounterVec(
+	"notary_server_storage_cache_lookups_total",
+	"Lookups of current metadata in the CachingStore, partitioned by where they were answered from.",
+	"result",
+)
+
+// cachedRoles are the roles CachingStore caches. They are the only roles
+// served by GetHandler, and being a fixed set they can be invalidated when
+// a GUN is deleted without the shared cache supporting key enumeration.
+var cachedRoles = []string{
+	data.CanonicalRootRole,
+	data.CanonicalTargetsRole,
+	data.CanonicalSnapshotRole,
+	data.CanonicalTimestampRole,
+}
+
+// SharedCache is a cache shared by several notary-servers, such as redis,
+// memcached or etcd. Implementations must be safe for concurrent use.
+type SharedCache interface {
+	// Get returns the value stored under key, and whether there was one
+	Get(key string) ([]byte, bool, error)
+	// Set stores value under key, expiring it after ttl if ttl is not zero
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(keys ...string) error
+}
+
+// CacheOptions configures a CachingStore
+type CacheOptions struct {
+	// Size is the number of entries held in the in-process cache
+	Size int
+	// TTL bounds how long a cached entry may be returned. Updates made
+	// through servers that do not share the cache are only seen once it has
+	// passed, so it should be short when several servers share a backend.
+	// It is required if Size or Shared is set.
+	TTL time.Duration
+	// Shared is an optional cache consulted when the in-process cache
+	// misses, before the wrapped store.
+	Shared SharedCache
+}
+
+// errCacheTTL is returned by NewCachingStore for a cache without a TTL
+var errCacheTTL = errors.New("a cache requires a TTL")
+
+// CachingStore wraps a MetaStore, caching the current root, targets,
+// snapshot and timestamp of each GUN so that reads of popular GUNs do not
+// reach the wrapped store. Entries are invalidated by updates and deletes
+// made through the CachingStore.
+//
+// An update replaces the shared cache entry with a marker recording the
+// version written, and readers never replace an entry with an older
+// version, so a reader that missed before the update can't put back the
+// metadata it replaced. Deletes reset the versions of a GUN, so only the
+// TTL bounds how long a racing reader's entry is served after one.
+type CachingStore struct {
+	MetaStore
+	local  *lruCache
+	shared SharedCache
+	ttl    time.Duration
+}
+
+// NewCachingStore creates a CachingStore in front of store
+func NewCachingStore(store MetaStore, opts CacheOptions) (*CachingStore, error) {
+	if (opts.Size > 0 || opts.Shared != nil) && opts.TTL <= 0 {
+		return nil, errCacheTTL
+	}
+	return &CachingStore{
+		MetaStore: store,
+		local:     newLRUCache(opts.Size, opts.TTL),
+		shared:    opts.Shared,
+		ttl:       opts.TTL,
+	}, nil
+}
+
+// UpdateCurrent updates the wrapped store and invalidates the role
+func (st *CachingStore) UpdateCurrent(gun string, update MetaUpdate) error {
+	err := st.MetaStore.UpdateCurrent(gun, update)
+	st.updated(gun, []MetaUpdate{update}, err)
+	return err
+}
+
+// UpdateMany updates the wrapped store and invalidates the updated roles
+func (st *CachingStore) UpdateMany(gun string, updates []MetaUpdate) error {
+	err := st.MetaStore.UpdateMany(gun, updates)
+	st.updated(gun, updates, err)
+	return err
+}
+
+// updated invalidates the roles of an update, replacing them in the shared
+// cache with a marker of the version written if the update succeeded
+func (st *CachingStore) updated(gun string, updates []MetaUpdate, err error) {
+	keys := make([]string, 0, len(updates))
+	for _, u := range updates {
+		keys = append(keys, cacheKey(gun, u.Role))
+	}
+	if err != nil || st.shared == nil {
+		st.invalidate(keys...)
+		return
+	}
+	for i, u := range updates {
+		st.local.remove(keys[i])
+		if isCachedRole(u.Role) {
+			st.putShared(keys[i], &StoredMeta{Version: u.Version})
+		}
+	}
+}
+
+// GetCurrent returns the cached metadata for a role, falling back to the
+// wrapped store
+func (st *CachingStore) GetCurrent(gun, tufRole string) ([]byte, error) {
+	meta, err := st.GetCurrentMeta(gun, tufRole)
+	if err != nil {
+		return nil, err
+	}
+	return meta.Data, nil
+}
+
+// GetCurrentMeta returns the cached current version of a role, falling back
+// to the wrapped store
+func (st *CachingStore) GetCurrentMeta(gun, tufRole string) (*StoredMeta, error) {
+	if !isCachedRole(tufRole) {
+		return st.MetaStore.GetCurrentMeta(gun, tufRole)
+	}
+	key := cacheKey(gun, tufRole)
+	meta, gen, ok := st.local.get(key)
+	if ok {
+		cacheLookups.Inc("local")
+		return meta, nil
+	}
+	if st.shared != nil {
+		if meta := st.getShared(key); meta != nil {
+			cacheLookups.Inc("shared")
+			st.local.set(key, meta, gen)
+			return meta, nil
+		}
+	}
+
+	cacheLookups.Inc("miss")
+	meta, err := st.MetaStore.GetCurrentMeta(gun, tufRole)
+	if err != nil {
+		return nil, err
+	}
+	st.local.set(key, meta, gen)
+	if st.shared != nil {
+		st.setShared(key, meta)
+	}
+	return meta, nil
+}
+
+// getShared returns the metadata held in the shared cache under key, or nil
+// if there is none or it has been invalidated by an update
+func (st *CachingStore) getShared(key string) *StoredMeta {
+	meta := st.getSharedEntry(key)
+	if meta == nil || meta.Data == nil {
+		return nil
+	}
+	return meta
+}
+
+// getSharedEntry returns the entry held in the shared cache under key,
+// which is a marker without Data if an update invalidated it. The shared
+// cache is an optimization, so errors are logged rather than returned.
+func (st *CachingStore) getSharedEntry(key string) *StoredMeta {
+	raw, ok, err := st.shared.Get(key)
+	if err != nil {
+		logrus.Warn("Error reading from shared cache: ", err.Error())
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	meta := &StoredMeta{}
+	if err := json.Unmarshal(raw, meta); err != nil {
+		logrus.Warn("Ignoring corrupt shared cache entry: ", err.Error())
+		return nil
+	}
+	return meta
+}
+
+// setShared caches meta, read from the wrapped store, in the shared cache
+// unless it already holds a newer version. The check isn't atomic, but the
+// window for a racing update is far smaller than the read from the store.
+func (st *CachingStore) setShared(key string, meta *StoredMeta) {
+	if current := st.getSharedEntry(key); current != nil && current.Version > meta.Version {
+		return
+	}
+	st.putShared(key, meta)
+}
+
+func (st *CachingStore) putShared(key string, meta *StoredMeta) {
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+	if err := st.shared.Set(key, raw, st.ttl); err != nil {
+		logrus.Warn("Error writing to shared cache: ", err.Error())
+	}
+}
+
+// Delete deletes the GUN from the wrapped store and invalidates its roles
+func (st *CachingStore) Delete(gun string) error {
+	keys := make([]string, 0, len(cachedRoles))
+	for _, role := range cachedRoles {
+		keys = append(keys, cacheKey(gun, role))
+	}
+	defer st.invalidate(keys...)
+	return st.MetaStore.Delete(gun)
+}
+
+func (st *CachingStore) invalidate(keys ...string) {
+	for _, key := range keys {
+		st.local.remove(key)
+	}
+	if st.shared != nil {
+		if err := st.shared.Delete(keys...); err != nil {
+			// a stale entry would be served until the next update succeeds
+			// in removing it
+			logrus.Error("Error invalidating shared cache: ", err.Error())
+		}
+	}
+}
+
+func isCachedRole(role string) bool {
+	for _, r := range cachedRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func cacheKey(gun, role string) string {
+	return "notary/" + gun + "/" + role
+}
+
+// lruCache is an in-process least recently used cache whose entries can
+// expire. Every removal bumps its generation, so that a value read from the
+// store before an invalidation is not cached after it.
+type lruCache struct {
+	lock    sync.Mutex
+	size    int
+	ttl     time.Duration
+	gen     uint64
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   *StoredMeta
+	expires time.Time
+}
+
+func newLRUCache(size int, ttl time.Duration) *lruCache {
+	return &lruCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns the value cached under key if there is one, and the current
+// generation to pass to set otherwise
+func (c *lruCache) get(key string) (*StoredMeta, uint64, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, c.gen, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if c.ttl > 0 && time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, c.gen, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, c.gen, true
+}
+
+// set caches value under key, unless anything was removed since gen was
+// returned by get
+func (c *lruCache) set(key string, value *StoredMeta, gen uint64) {
+	if c.size <= 0 {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if gen != c.gen {
+		return
+	}
+	entry := &lruEntry{key: key, value: value, expires: time.Now().Add(c.ttl)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (c *lruCache) remove(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.gen++
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStore counts the reads that reach the wrapped MemStorage
+type countingStore struct {
+	*MemStorage
+	reads int
+}
+
+func (st *countingStore) GetCurrent(gun, role string) ([]byte, error) {
+	st.reads++
+	return st.MemStorage.GetCurrent(gun, role)
+}
+
+func (st *countingStore) GetCurrentMeta(gun, role string) (*StoredMeta, error) {
+	st.reads++
+	return st.MemStorage.GetCurrentMeta(gun, role)
+}
+
+// memorySharedCache is an in-memory SharedCache
+type memorySharedCache struct {
+	lock    sync.Mutex
+	entries map[string][]byte
+}
+
+func newMemorySharedCache() *memorySharedCache {
+	return &memorySharedCache{entries: make(map[string][]byte)}
+}
+
+func (c *memorySharedCache) Get(key string) ([]byte, bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	value, ok := c.entries[key]
+	return value, ok, nil
+}
+
+func (c *memorySharedCache) Set(key string, value []byte, ttl time.Duration) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries[key] = value
+	return nil
+}
+
+func (c *memorySharedCache) Delete(keys ...string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+	return nil
+}
+
+func TestCachingStoreCachesReads(t *testing.T) {
+	backend := &countingStore{MemStorage: NewMemStorage()}
+	s, err := NewCachingStore(backend, CacheOptions{Size: 10, TTL: time.Minute})
+	assert.Nil(t, err)
+	backend.UpdateCurrent("gun", MetaUpdate{"root", 1, []byte("v1")})
+
+	for i := 0; i < 3; i++ {
+		d, err := s.GetCurrent("gun", "root")
+		assert.Nil(t, err, "Expected error to be nil")
+		assert.Equal(t, []byte("v1"), d, "Data was incorrect")
+	}
+	assert.Equal(t, 1, backend.reads, "Only the first read should reach the store")
+
+	// missing metadata is not cached
+	_, err = s.GetCurrent("gun", "targets")
+	assert.IsType(t, &ErrNotFound{}, err, "Expected error to be ErrNotFound")
+	s.GetCurrent("gun", "targets")
+	assert.Equal(t, 3, backend.reads)
+}
+
+func TestCachingStoreInvalidates(t *testing.T) {
+	s, err := NewCachingStore(NewMemStorage(), CacheOptions{Size: 10, TTL: time.Minute})
+	assert.Nil(t, err)
+	s.UpdateCurrent("gun", MetaUpdate{"root", 1, []byte("v1")})
+	s.GetCurrent("gun", "root")
+
+	assert.Nil(t, s.UpdateMany("gun", []MetaUpdate{{"root", 2, []byte("v2")}}))
+	d, err := s.GetCurrent("gun", "root")
+	assert.Nil(t, err, "Expected error to be nil")
+	assert.Equal(t, []byte("v2"), d, "Update did not invalidate the cache")
+
+	assert.Nil(t, s.Delete("gun"))
+	_, err = s.GetCurrent("gun", "root")
+	assert.IsType(t, &ErrNotFound{}, err, "Delete did not invalidate the cache")
+}
+
+func TestCachingStoreShared(t *testing.T) {
+	backend := &countingStore{MemStorage: NewMemStorage()}
+	shared := newMemorySharedCache()
+	s1, err := NewCachingStore(backend, CacheOptions{Size: 10, TTL: time.Minute, Shared: shared})
+	assert.Nil(t, err)
+	s2, err := NewCachingStore(backend, CacheOptions{Size: 10, TTL: time.Minute, Shared: shared})
+	assert.Nil(t, err)
+	backend.UpdateCurrent("gun", MetaUpdate{"root", 1, []byte("v1")})
+
+	s1.GetCurrent("gun", "root")
+	d, err := s2.GetCurrent("gun", "root")
+	assert.Nil(t, err, "Expected error to be nil")
+	assert.Equal(t, []byte("v1"), d, "Data was incorrect")
+	assert.Equal(t, 1, backend.reads, "The second server should read from the shared cache")
+
+	// an update through one server invalidates the entry in the shared cache
+	s1.UpdateCurrent("gun", MetaUpdate{"root", 2, []byte("v2")})
+	assert.Nil(t, s1.getShared(cacheKey("gun", "root")), "Update did not invalidate the shared cache")
+
+	// a reader that read the previous version before the update can't put
+	// it back
+	s2.setShared(cacheKey("gun", "root"), &StoredMeta{Version: 1, Data: []byte("v1")})
+	s3, err := NewCachingStore(backend, CacheOptions{Size: 10, TTL: time.Minute, Shared: shared})
+	assert.Nil(t, err)
+	d, err = s3.GetCurrent("gun", "root")
+	assert.Nil(t, err, "Expected error to be nil")
+	assert.Equal(t, []byte("v2"), d, "Stale metadata was put back in the shared cache")
+	assert.Equal(t, []byte("v2"), s1.getShared(cacheKey("gun", "root")).Data)
+}
+
+func TestCachingStoreRequiresTTL(t *testing.T) {
+	_, err := NewCachingStore(NewMemStorage(), CacheOptions{Size: 10})
+	assert.Equal(t, errCacheTTL, err)
+	_, err = NewCachingStore(NewMemStorage(), CacheOptions{Shared: newMemorySharedCache()})
+	assert.Equal(t, errCacheTTL, err)
+}
+
+func TestCachingStoreSkipsDelegations(t *testing.T) {
+	backend := &countingStore{MemStorage: NewMemStorage()}
+	s, err := NewCachingStore(backend, CacheOptions{Size: 10, TTL: time.Minute})
+	assert.Nil(t, err)
+	backend.UpdateCurrent("gun", MetaUpdate{"targets/releases", 1, []byte("v1")})
+
+	s.GetCurrent("gun", "targets/releases")
+	s.GetCurrent("gun", "targets/releases")
+	assert.Equal(t, 2, backend.reads)
+}
+
+func TestLRUCache(t *testing.T) {
+	c := newLRUCache(2, 0)
+	_, gen, _ := c.get("a")
+	c.set("a", &StoredMeta{Data: []byte("a")}, gen)
+	c.set("b", &StoredMeta{Data: []byte("b")}, gen)
+	c.get("a")
+	c.set("c", &StoredMeta{Data: []byte("c")}, gen)
+
+	_, _, ok := c.get("b")
+	assert.False(t, ok, "The least recently used entry should have been evicted")
+	_, _, ok = c.get("a")
+	assert.True(t, ok)
+
+	// a value read before an invalidation is not cached
+	_, gen, _ = c.get("d")
+	c.remove("a")
+	c.set("d", &StoredMeta{Data: []byte("stale")}, gen)
+	_, _, ok = c.get("d")
+	assert.False(t, ok)
+}
+
+func TestLRUCacheExpiry(t *testing.T) {
+	c := newLRUCache(2, time.Millisecond)
+	_, gen, _ := c.get("a")
+	c.set("a", &StoredMeta{Data: []byte("a")}, gen)
+	time.Sleep(5 * time.Millisecond)
+	_, _, ok := c.get("a")
+	assert.False(t, ok, "Entry should have expired")
+}
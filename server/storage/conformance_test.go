@@ -0,0 +1,124 @@
+package storage_test
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/docker/notary/server/storage"
+	"github.com/docker/notary/server/storage/storagetest"
+)
+
+// sqliteSchema is the SQLite equivalent of notarymysql/initial.sql
+var sqliteSchema = []string{
+	`CREATE TABLE tuf_files (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		gun VARCHAR(255) NOT NULL,
+		role VARCHAR(255) NOT NULL,
+		version INTEGER NOT NULL,
+		data BLOB NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (gun, role, version)
+	);`,
+	`CREATE TABLE timestamp_keys (
+		gun VARCHAR(255) NOT NULL PRIMARY KEY,
+		cipher VARCHAR(50) NOT NULL,
+		public BLOB NOT NULL
+	);`,
+}
+
+func TestMemStorageConformance(t *testing.T) {
+	storagetest.RunMetaStoreTests(t, func() storage.MetaStore {
+		return storage.NewMemStorage()
+	})
+}
+
+func TestFileStorageConformance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notary-conformance")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	i := 0
+	storagetest.RunMetaStoreTests(t, func() storage.MetaStore {
+		i++
+		s, err := storage.NewFileStorage(filepath.Join(dir, fmt.Sprint(i)))
+		assert.NoError(t, err)
+		return s
+	})
+}
+
+func TestSQLiteStorageConformance(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the SQLite conformance tests in short mode")
+	}
+	dir, err := ioutil.TempDir("", "notary-conformance")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var dbs []*sql.DB
+	defer func() {
+		for _, db := range dbs {
+			db.Close()
+		}
+	}()
+
+	i := 0
+	storagetest.RunMetaStoreTests(t, func() storage.MetaStore {
+		i++
+		// a file rather than :memory:, so that every connection in the
+		// pool sees the same database
+		db, err := sql.Open("sqlite3", filepath.Join(dir, fmt.Sprintf("%d.db?_busy_timeout=10000", i)))
+		assert.NoError(t, err)
+		dbs = append(dbs, db)
+		for _, stmt := range sqliteSchema {
+			_, err := db.Exec(stmt)
+			assert.NoError(t, err)
+		}
+		return storage.NewMySQLStorage(db)
+	})
+}
+
+// TestMySQLStorageConformance runs against the MySQL database named by the
+// NOTARY_TEST_MYSQL_DSN environment variable, which must have the schema in
+// notarymysql/initial.sql. Its tables are emptied before every test.
+func TestMySQLStorageConformance(t *testing.T) {
+	dsn := os.Getenv("NOTARY_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("NOTARY_TEST_MYSQL_DSN is not set")
+	}
+	db, err := sql.Open("mysql", dsn)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	storagetest.RunMetaStoreTests(t, func() storage.MetaStore {
+		for _, table := range []string{"tuf_files", "timestamp_keys"} {
+			_, err := db.Exec("DELETE FROM `" + table + "`;")
+			assert.NoError(t, err)
+		}
+		return storage.NewMySQLStorage(db)
+	})
+}
+
+func TestCachingStoreConformance(t *testing.T) {
+	storagetest.RunMetaStoreTests(t, func() storage.MetaStore {
+		s, err := storage.NewCachingStore(storage.NewMemStorage(), storage.CacheOptions{Size: 100, TTL: time.Minute})
+		assert.NoError(t, err)
+		return s
+	})
+}
+
+func TestInstrumentedStoreConformance(t *testing.T) {
+	storagetest.RunMetaStoreTests(t, func() storage.MetaStore {
+		return storage.NewInstrumentedStore(storage.NewMemStorage())
+	})
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"database/sql"
+	"strings"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/endophage/gotuf/data"
@@ -16,6 +17,7 @@ import (
 //   `role` VARCHAR(255) NOT NULL
 //   `version` INT
 //   `data` LONGBLOB
+//   `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 //   PRIMARY KEY (`id`)
 //   UNIQUE INDEX (`gun`, `role`, `version`)
 // ) DEFAULT CHARSET=utf8;
@@ -26,13 +28,13 @@ import (
 //   `public` BLOB NOT NULL,
 // ) DEFAULT CHARSET=utf8;
 type MySQLStorage struct {
-	sql.DB
+	*sql.DB
 }
 
 // NewMySQLStorage is a convenience method to create a MySQLStorage
 func NewMySQLStorage(db *sql.DB) *MySQLStorage {
 	return &MySQLStorage{
-		DB: *db,
+		DB: db,
 	}
 }
 
@@ -58,19 +60,16 @@ func (db *MySQLStorage) UpdateCurrent(gun string, update MetaUpdate) error {
 	// needs to rebase.
 	_, err = db.Exec(insertStmt, gun, update.Role, update.Version, update.Data)
 	if err != nil {
-		if err, ok := err.(*mysql.MySQLError); ok {
-			if err.Number == 1022 { // duplicate key error
-				return &ErrOldVersion{}
-			}
+		if db.isDuplicate(err, checkStmt, gun, update.Role, update.Version) {
+			return &ErrOldVersion{}
 		}
-		// need to check error type for duplicate key exception
-		// and return ErrOldVersion if duplicate
 		return err
 	}
 	return nil
 }
 
-// UpdateMany atomically updates many TUF records in a single transaction
+// UpdateMany atomically updates many TUF records in a single transaction. A
+// role may be updated several times in increasing version order.
 func (db *MySQLStorage) UpdateMany(gun string, updates []MetaUpdate) error {
 	checkStmt := "SELECT count(*) FROM `tuf_files` WHERE `gun`=? AND `role`=? AND `version`>=?;"
 	insertStmt := "INSERT INTO `tuf_files` (`gun`, `role`, `version`, `data`) VALUES (?,?,?,?);"
@@ -79,7 +78,17 @@ func (db *MySQLStorage) UpdateMany(gun string, updates []MetaUpdate) error {
 	if err != nil {
 		return err
 	}
+	latest := make(map[string]int)
 	for _, u := range updates {
+		// the check below does not see the versions inserted by this
+		// transaction
+		if version, ok := latest[u.Role]; ok && u.Version <= version {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logrus.Panic("Failed on Tx rollback with error: ", rbErr.Error())
+			}
+			return &ErrOldVersion{}
+		}
+		latest[u.Role] = u.Version
 		// ensure we're not inserting an immediately old version
 		row := db.QueryRow(checkStmt, gun, u.Role, u.Version)
 		var exists int
@@ -109,7 +118,7 @@ func (db *MySQLStorage) UpdateMany(gun string, updates []MetaUpdate) error {
 			if rbErr != nil {
 				logrus.Panic("Failed on Tx rollback with error: ", err.Error())
 			}
-			if err, ok := err.(*mysql.MySQLError); ok && err.Number == 1022 { // duplicate key error
+			if db.isDuplicate(err, checkStmt, gun, u.Role, u.Version) {
 				return &ErrOldVersion{}
 			}
 			return err
@@ -138,6 +147,59 @@ func (db *MySQLStorage) GetCurrent(gun, tufRole string) (data []byte, err error)
 	return data, nil
 }
 
+// GetCurrentMeta gets the current version of a specific TUF record
+func (db *MySQLStorage) GetCurrentMeta(gun, tufRole string) (*StoredMeta, error) {
+	stmt := "SELECT `version`, `data`, `created_at` FROM `tuf_files` WHERE `gun`=? AND `role`=? ORDER BY `version` DESC LIMIT 1;"
+	var (
+		meta    StoredMeta
+		created mysql.NullTime
+	)
+	err := db.QueryRow(stmt, gun, tufRole).Scan(&meta.Version, &meta.Data, &created)
+	if err == sql.ErrNoRows {
+		return nil, &ErrNotFound{}
+	} else if err != nil {
+		return nil, err
+	}
+	meta.CreatedAt = created.Time
+	return &meta, nil
+}
+
+// GetVersions returns the versions of a TUF record that are at least
+// fromVersion, oldest first. At most limit are returned, unless it is 0.
+func (db *MySQLStorage) GetVersions(gun, tufRole string, fromVersion, limit int) ([]StoredMeta, error) {
+	stmt := "SELECT `version`, `data`, `created_at` FROM `tuf_files` WHERE `gun`=? AND `role`=? AND `version`>=? ORDER BY `version` ASC"
+	args := []interface{}{gun, tufRole, fromVersion}
+	if limit > 0 {
+		stmt += " LIMIT ?"
+		args = append(args, limit)
+	}
+	rows, err := db.Query(stmt+";", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []StoredMeta
+	for rows.Next() {
+		var (
+			meta    StoredMeta
+			created mysql.NullTime
+		)
+		if err := rows.Scan(&meta.Version, &meta.Data, &created); err != nil {
+			return nil, err
+		}
+		meta.CreatedAt = created.Time
+		versions = append(versions, meta)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, &ErrNotFound{}
+	}
+	return versions, nil
+}
+
 // Delete deletes all the records for a specific GUN
 func (db *MySQLStorage) Delete(gun string) error {
 	stmt := "DELETE FROM `tuf_files` WHERE `gun`=?;"
@@ -145,6 +207,86 @@ func (db *MySQLStorage) Delete(gun string) error {
 	return err
 }
 
+// ListGUNs returns every GUN that has records stored, sorted
+func (db *MySQLStorage) ListGUNs() ([]string, error) {
+	rows, err := db.Query("SELECT DISTINCT `gun` FROM `tuf_files` ORDER BY `gun` ASC;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	guns := []string{}
+	for rows.Next() {
+		var gun string
+		if err := rows.Scan(&gun); err != nil {
+			return nil, err
+		}
+		guns = append(guns, gun)
+	}
+	return guns, rows.Err()
+}
+
+// pruneBatchSize is the number of rows PruneVersions deletes per statement
+const pruneBatchSize = 100
+
+// PruneVersions deletes the old records selected by policy, returning how
+// many were deleted
+func (db *MySQLStorage) PruneVersions(policy RetentionPolicy) (int, error) {
+	stmt := "SELECT `id`, `gun`, `role`, `created_at` FROM `tuf_files` WHERE `role`!=? ORDER BY `gun`, `role`, `version` DESC;"
+	rows, err := db.Query(stmt, data.CanonicalRootRole)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		ids       []interface{}
+		gun, role string
+		newer     int
+	)
+	for rows.Next() {
+		var (
+			id      int64
+			g, r    string
+			created mysql.NullTime
+		)
+		if err := rows.Scan(&id, &g, &r, &created); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if g != gun || r != role {
+			gun, role, newer = g, r, 0
+		}
+		if !policy.keeps(r, newer, created.Time) {
+			ids = append(ids, id)
+		}
+		newer++
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+	for len(ids) > 0 {
+		batch := ids
+		if len(batch) > pruneBatchSize {
+			batch = batch[:pruneBatchSize]
+		}
+		ids = ids[len(batch):]
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+		res, err := db.Exec("DELETE FROM `tuf_files` WHERE `id` IN ("+placeholders+");", batch...)
+		if err != nil {
+			return pruned, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return pruned, err
+		}
+		pruned += int(n)
+	}
+	return pruned, nil
+}
+
 // GetTimestampKey returns the timestamps Public Key data
 func (db *MySQLStorage) GetTimestampKey(gun string) (algorithm data.KeyAlgorithm, public []byte, err error) {
 	logrus.Debug("retrieving timestamp key for ", gun)
@@ -168,10 +310,29 @@ func (db *MySQLStorage) SetTimestampKey(gun string, algorithm data.KeyAlgorithm,
 	logrus.Debug("Inserting timestamp key for ", gun)
 	_, err := db.Exec(stmt, gun, string(algorithm), public)
 	if err != nil {
-		if err, ok := err.(*mysql.MySQLError); ok && err.Number == 1022 {
+		if db.isDuplicate(err, "SELECT count(*) FROM `timestamp_keys` WHERE `gun`=?;", gun) {
 			return &ErrTimestampKeyExists{gun: gun}
 		}
 		return err
 	}
 	return nil
 }
+
+// CheckHealth verifies the database can be reached
+func (db *MySQLStorage) CheckHealth() error {
+	return db.Ping()
+}
+
+// isDuplicate reports whether a failed insert conflicted with an existing
+// row. MySQL identifies duplicate key errors by number, other drivers are
+// checked by running checkStmt, which counts the conflicting rows.
+func (db *MySQLStorage) isDuplicate(err error, checkStmt string, args ...interface{}) bool {
+	if err, ok := err.(*mysql.MySQLError); ok {
+		return err.Number == 1022 || err.Number == 1062
+	}
+	var exists int
+	if err := db.QueryRow(checkStmt, args...).Scan(&exists); err != nil {
+		return false
+	}
+	return exists != 0
+}
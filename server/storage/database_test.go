@@ -236,6 +236,25 @@ func TestMySQLGetCurrent(t *testing.T) {
 	//assert.Nil(t, err, "Expectation not met: %v", err)
 }
 
+func TestMySQLListGUNs(t *testing.T) {
+	db, err := sqlmock.New()
+	assert.Nil(t, err, "Could not initialize mock DB")
+	s := NewMySQLStorage(db)
+
+	sqlmock.ExpectQuery(
+		"SELECT DISTINCT `gun` FROM `tuf_files` ORDER BY `gun` ASC;",
+	).WillReturnRows(
+		sqlmock.RowsFromCSVString(
+			[]string{"gun"},
+			"a/one\nb/two",
+		),
+	)
+
+	guns, err := s.ListGUNs()
+	assert.Nil(t, err, "Expected nil error from ListGUNs")
+	assert.Equal(t, []string{"a/one", "b/two"}, guns)
+}
+
 func TestMySQLDelete(t *testing.T) {
 	db, err := sqlmock.New()
 	assert.Nil(t, err, "Could not initialize mock DB")
@@ -0,0 +1,447 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/endophage/gotuf/data"
+)
+
+// lockTimeout is how long FileStorage waits for another process to
+// release the lock file
+const lockTimeout = 10 * time.Second
+
+// FileStorage implements a versioned store on the filesystem, for
+// deployments that want persistence without a database. It lays out its
+// directory as:
+//
+//	tuf/<gun>/current.json            the current version of each role
+//	tuf/<gun>/<role>/<version>.json   every version of each role
+//	timestamp_keys/<gun>.json         the public timestamp key
+//	lock                              locked while the store is modified
+//
+// GUNs and roles are escaped so that each is a single path component. All
+// files are written to a temporary file, synced and renamed into place. A
+// version only becomes visible once current.json, which is replaced in a
+// single rename, points at it, so UpdateMany is atomic even if the process
+// dies part way through. Writers take an exclusive lock on the lock file,
+// flock(2) or LockFileEx on Windows, which is released when the holder
+// exits, so several processes on a host may share a directory.
+type FileStorage struct {
+	baseDir string
+	lock    sync.Mutex
+}
+
+// NewFileStorage creates a FileStorage rooted at baseDir, creating the
+// directory if it does not exist
+func NewFileStorage(baseDir string) (*FileStorage, error) {
+	for _, dir := range []string{"tuf", "timestamp_keys"} {
+		if err := os.MkdirAll(filepath.Join(baseDir, dir), 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &FileStorage{baseDir: baseDir}, nil
+}
+
+// UpdateCurrent updates the meta data for a specific role
+func (st *FileStorage) UpdateCurrent(gun string, update MetaUpdate) error {
+	return st.UpdateMany(gun, []MetaUpdate{update})
+}
+
+// UpdateMany atomically updates multiple TUF records. A role may be updated
+// several times in increasing version order, the last update becoming
+// current. If any update is not newer than the version of its role before
+// it, none are applied.
+func (st *FileStorage) UpdateMany(gun string, updates []MetaUpdate) error {
+	unlock, err := st.acquire()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	current, err := st.current(gun)
+	if err != nil {
+		return err
+	}
+	for _, u := range updates {
+		if latest, ok := current[u.Role]; ok && u.Version <= latest {
+			return &ErrOldVersion{}
+		}
+		current[u.Role] = u.Version
+	}
+
+	// versions are invisible until current.json refers to them, so a
+	// failure here leaves the store unchanged
+	for _, u := range updates {
+		roleDir := filepath.Join(st.gunDir(gun), escapeName(u.Role))
+		if err := os.MkdirAll(roleDir, 0700); err != nil {
+			return err
+		}
+		if err := writeFileSync(filepath.Join(roleDir, versionFile(u.Version)), u.Data); err != nil {
+			return err
+		}
+		current[u.Role] = u.Version
+	}
+	out, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	return writeFileSync(filepath.Join(st.gunDir(gun), "current.json"), out)
+}
+
+// GetCurrent returns the current metadata for a given role, under a GUN
+func (st *FileStorage) GetCurrent(gun, role string) ([]byte, error) {
+	meta, err := st.GetCurrentMeta(gun, role)
+	if err != nil {
+		return nil, err
+	}
+	return meta.Data, nil
+}
+
+// GetCurrentMeta returns the current version of a role under a GUN
+func (st *FileStorage) GetCurrentMeta(gun, role string) (*StoredMeta, error) {
+	current, err := st.current(gun)
+	if err != nil {
+		return nil, err
+	}
+	version, ok := current[role]
+	if !ok {
+		return nil, &ErrNotFound{}
+	}
+	f, err := os.Open(filepath.Join(st.gunDir(gun), escapeName(role), versionFile(version)))
+	if os.IsNotExist(err) {
+		// the GUN was deleted after current.json was read
+		return nil, &ErrNotFound{}
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return &StoredMeta{Version: version, Data: data, CreatedAt: info.ModTime()}, nil
+}
+
+// GetVersions returns the versions of a role under a GUN that are at least
+// fromVersion, oldest first. At most limit are returned, unless it is 0.
+func (st *FileStorage) GetVersions(gun, role string, fromVersion, limit int) ([]StoredMeta, error) {
+	current, err := st.current(gun)
+	if err != nil {
+		return nil, err
+	}
+	latest, ok := current[role]
+	if !ok {
+		return nil, &ErrNotFound{}
+	}
+	roleDir := filepath.Join(st.gunDir(gun), escapeName(role))
+	files, err := versionFiles(roleDir, latest)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []StoredMeta
+	for _, f := range files {
+		if limit > 0 && len(versions) == limit {
+			break
+		}
+		if f.Version < fromVersion {
+			continue
+		}
+		meta, err := ioutil.ReadFile(filepath.Join(roleDir, versionFile(f.Version)))
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, StoredMeta{Version: f.Version, Data: meta, CreatedAt: f.CreatedAt})
+	}
+	if len(versions) == 0 {
+		return nil, &ErrNotFound{}
+	}
+	return versions, nil
+}
+
+// Delete deletes all the metadata for a given GUN
+func (st *FileStorage) Delete(gun string) error {
+	unlock, err := st.acquire()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// removing current.json first deletes the GUN atomically, whatever
+	// happens to the rest of its files
+	err = os.Remove(filepath.Join(st.gunDir(gun), "current.json"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.RemoveAll(st.gunDir(gun))
+}
+
+// ListGUNs returns every GUN that has metadata stored, sorted
+func (st *FileStorage) ListGUNs() ([]string, error) {
+	dirs, err := ioutil.ReadDir(filepath.Join(st.baseDir, "tuf"))
+	if err != nil {
+		return nil, err
+	}
+	guns := []string{}
+	for _, d := range dirs {
+		gun, err := url.QueryUnescape(d.Name())
+		if err != nil || !d.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(st.gunDir(gun), "current.json")); err == nil {
+			guns = append(guns, gun)
+		}
+	}
+	sort.Strings(guns)
+	return guns, nil
+}
+
+// PruneVersions deletes the old versions selected by policy, returning how
+// many were deleted. Each GUN is locked in turn, so writers are not held up
+// for the whole run.
+func (st *FileStorage) PruneVersions(policy RetentionPolicy) (int, error) {
+	guns, err := st.ListGUNs()
+	if err != nil {
+		return 0, err
+	}
+	pruned := 0
+	for _, gun := range guns {
+		n, err := st.pruneGUN(gun, policy)
+		pruned += n
+		if err != nil {
+			return pruned, err
+		}
+	}
+	return pruned, nil
+}
+
+func (st *FileStorage) pruneGUN(gun string, policy RetentionPolicy) (int, error) {
+	unlock, err := st.acquire()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	current, err := st.current(gun)
+	if err != nil {
+		return 0, err
+	}
+	pruned := 0
+	for role, latest := range current {
+		roleDir := filepath.Join(st.gunDir(gun), escapeName(role))
+		files, err := versionFiles(roleDir, latest)
+		if err != nil {
+			return pruned, err
+		}
+		for i, f := range files {
+			if policy.keeps(role, len(files)-i-1, f.CreatedAt) {
+				continue
+			}
+			if err := os.Remove(filepath.Join(roleDir, versionFile(f.Version))); err != nil {
+				return pruned, err
+			}
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+// fileTimestampKey is the serialization of a timestamp key
+type fileTimestampKey struct {
+	Algorithm data.KeyAlgorithm `json:"algorithm"`
+	Public    []byte            `json:"public"`
+}
+
+// GetTimestampKey returns the public key material of the timestamp key of a given gun
+func (st *FileStorage) GetTimestampKey(gun string) (algorithm data.KeyAlgorithm, public []byte, err error) {
+	raw, err := ioutil.ReadFile(st.timestampKeyPath(gun))
+	if os.IsNotExist(err) {
+		return "", nil, &ErrNoKey{gun: gun}
+	} else if err != nil {
+		return "", nil, err
+	}
+	var k fileTimestampKey
+	if err := json.Unmarshal(raw, &k); err != nil {
+		return "", nil, err
+	}
+	return k.Algorithm, k.Public, nil
+}
+
+// SetTimestampKey sets a Timestamp key under a gun
+func (st *FileStorage) SetTimestampKey(gun string, algorithm data.KeyAlgorithm, public []byte) error {
+	out, err := json.Marshal(fileTimestampKey{Algorithm: algorithm, Public: public})
+	if err != nil {
+		return err
+	}
+	path := st.timestampKeyPath(gun)
+	tmp, err := writeTempSync(path, out)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	// unlike a rename, linking fails if another server set the key first
+	if err := os.Link(tmp, path); err != nil {
+		if os.IsExist(err) {
+			return &ErrTimestampKeyExists{gun: gun}
+		}
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// CheckHealth checks the storage directory can be read
+func (st *FileStorage) CheckHealth() error {
+	_, err := ioutil.ReadDir(filepath.Join(st.baseDir, "tuf"))
+	return err
+}
+
+func (st *FileStorage) gunDir(gun string) string {
+	return filepath.Join(st.baseDir, "tuf", escapeName(gun))
+}
+
+func (st *FileStorage) timestampKeyPath(gun string) string {
+	return filepath.Join(st.baseDir, "timestamp_keys", escapeName(gun)+".json")
+}
+
+// current reads the current version of every role in a GUN
+func (st *FileStorage) current(gun string) (map[string]int, error) {
+	current := make(map[string]int)
+	raw, err := ioutil.ReadFile(filepath.Join(st.gunDir(gun), "current.json"))
+	if os.IsNotExist(err) {
+		return current, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &current); err != nil {
+		return nil, err
+	}
+	return current, nil
+}
+
+// acquire takes the in-process lock and the lock on the lock file,
+// returning a function that releases both. The lock file itself is never
+// removed, as another process may be waiting on it.
+func (st *FileStorage) acquire() (func(), error) {
+	st.lock.Lock()
+	f, err := os.OpenFile(filepath.Join(st.baseDir, "lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		st.lock.Unlock()
+		return nil, err
+	}
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			st.lock.Unlock()
+			return nil, err
+		}
+		if locked {
+			return func() {
+				unlockFile(f)
+				f.Close()
+				st.lock.Unlock()
+			}, nil
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			st.lock.Unlock()
+			return nil, fmt.Errorf("timed out waiting for the lock on %s", st.baseDir)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// versionFiles lists the versions of a role stored in roleDir that are no
+// newer than latest, oldest first, without reading them. Temporary files
+// and versions left behind by updates that never completed are skipped.
+func versionFiles(roleDir string, latest int) ([]StoredMeta, error) {
+	files, err := ioutil.ReadDir(roleDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var versions []StoredMeta
+	for _, f := range files {
+		version, err := strconv.Atoi(strings.TrimSuffix(f.Name(), ".json"))
+		if err != nil || !strings.HasSuffix(f.Name(), ".json") || version > latest {
+			continue
+		}
+		versions = append(versions, StoredMeta{Version: version, CreatedAt: f.ModTime()})
+	}
+	sort.Sort(byVersion(versions))
+	return versions, nil
+}
+
+// escapeName makes a GUN or role safe to use as a single path component
+func escapeName(name string) string {
+	return strings.Replace(url.QueryEscape(name), ".", "%2E", -1)
+}
+
+func versionFile(version int) string {
+	return strconv.Itoa(version) + ".json"
+}
+
+// writeFileSync atomically replaces path with data, syncing it to disk
+func writeFileSync(path string, data []byte) error {
+	tmp, err := writeTempSync(path, data)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// writeTempSync writes data to a synced temporary file alongside path,
+// returning its name
+func writeTempSync(path string, data []byte) (string, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// syncDir syncs a directory so that renames into it survive a crash. Not
+// every platform supports this, so failures are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+type byVersion []StoredMeta
+
+func (v byVersion) Len() int           { return len(v) }
+func (v byVersion) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v byVersion) Less(i, j int) bool { return v[i].Version < v[j].Version }
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFileStorage(t *testing.T) (*FileStorage, func()) {
+	dir, err := ioutil.TempDir("", "notary-filestorage")
+	assert.Nil(t, err, "Could not create temp dir")
+	s, err := NewFileStorage(dir)
+	assert.Nil(t, err, "Could not create FileStorage")
+	return s, func() { os.RemoveAll(dir) }
+}
+
+func TestFileUpdateAndGetCurrent(t *testing.T) {
+	s, cleanup := newFileStorage(t)
+	defer cleanup()
+
+	_, err := s.GetCurrent("docker.com/notary", "root")
+	assert.IsType(t, &ErrNotFound{}, err, "Expected error to be ErrNotFound")
+
+	assert.Nil(t, s.UpdateCurrent("docker.com/notary", MetaUpdate{"root", 1, []byte("v1")}))
+	assert.Nil(t, s.UpdateCurrent("docker.com/notary", MetaUpdate{"root", 2, []byte("v2")}))
+	d, err := s.GetCurrent("docker.com/notary", "root")
+	assert.Nil(t, err, "Expected error to be nil")
+	assert.Equal(t, []byte("v2"), d, "Data was incorrect")
+
+	err = s.UpdateCurrent("docker.com/notary", MetaUpdate{"root", 2, []byte("again")})
+	assert.IsType(t, &ErrOldVersion{}, err, "Expected error to be ErrOldVersion")
+}
+
+func TestFileUpdateManyIsAtomic(t *testing.T) {
+	s, cleanup := newFileStorage(t)
+	defer cleanup()
+
+	assert.Nil(t, s.UpdateMany("gun", []MetaUpdate{
+		{"root", 1, []byte("root1")},
+		{"targets", 1, []byte("targets1")},
+	}))
+
+	// targets is not newer, so root must not be updated either
+	err := s.UpdateMany("gun", []MetaUpdate{
+		{"root", 2, []byte("root2")},
+		{"targets", 1, []byte("targets1")},
+	})
+	assert.IsType(t, &ErrOldVersion{}, err, "Expected error to be ErrOldVersion")
+	d, err := s.GetCurrent("gun", "root")
+	assert.Nil(t, err, "Expected error to be nil")
+	assert.Equal(t, []byte("root1"), d, "Root should not have been updated")
+
+	// the versions of a role must increase within an update
+	err = s.UpdateMany("gun", []MetaUpdate{
+		{"root", 3, []byte("root3")},
+		{"root", 2, []byte("root2")},
+	})
+	assert.IsType(t, &ErrOldVersion{}, err, "Expected error to be ErrOldVersion")
+	d, err = s.GetCurrent("gun", "root")
+	assert.Nil(t, err, "Expected error to be nil")
+	assert.Equal(t, []byte("root1"), d, "Root should not have been updated")
+}
+
+func TestFileIgnoresIncompleteUpdates(t *testing.T) {
+	s, cleanup := newFileStorage(t)
+	defer cleanup()
+
+	assert.Nil(t, s.UpdateCurrent("gun", MetaUpdate{"root", 1, []byte("v1")}))
+	// a version written by an update that died before committing
+	orphan := filepath.Join(s.gunDir("gun"), "root", "2.json")
+	assert.Nil(t, ioutil.WriteFile(orphan, []byte("v2"), 0600))
+
+	d, err := s.GetCurrent("gun", "root")
+	assert.Nil(t, err, "Expected error to be nil")
+	assert.Equal(t, []byte("v1"), d, "Data was incorrect")
+	versions, err := s.GetVersions("gun", "root", 0, 0)
+	assert.Nil(t, err, "Expected error to be nil")
+	assert.Len(t, versions, 1)
+
+	assert.Nil(t, s.UpdateCurrent("gun", MetaUpdate{"root", 2, []byte("new v2")}))
+	d, err = s.GetCurrent("gun", "root")
+	assert.Nil(t, err, "Expected error to be nil")
+	assert.Equal(t, []byte("new v2"), d, "Data was incorrect")
+}
+
+func TestFileGetVersions(t *testing.T) {
+	s, cleanup := newFileStorage(t)
+	defer cleanup()
+
+	_, err := s.GetVersions("gun", "role", 0, 0)
+	assert.IsType(t, &ErrNotFound{}, err, "Expected error to be ErrNotFound")
+
+	for i, d := range []string{"v1", "v2", "v3", "v4", "v5", "v6", "v7", "v8", "v9", "v10"} {
+		assert.Nil(t, s.UpdateCurrent("gun", MetaUpdate{"role", i + 1, []byte(d)}))
+	}
+
+	versions, err := s.GetVersions("gun", "role", 9, 0)
+	assert.Nil(t, err, "Expected error to be nil")
+	assert.Len(t, versions, 2)
+	assert.Equal(t, 9, versions[0].Version)
+	assert.Equal(t, []byte("v10"), versions[1].Data)
+	assert.False(t, versions[1].CreatedAt.IsZero())
+}
+
+func TestFileDeleteAndListGUNs(t *testing.T) {
+	s, cleanup := newFileStorage(t)
+	defer cleanup()
+
+	s.UpdateCurrent("b/gun", MetaUpdate{"root", 1, []byte("r")})
+	s.UpdateCurrent("a/gun", MetaUpdate{"root", 1, []byte("r")})
+	s.UpdateCurrent("a/gun.extra", MetaUpdate{"root", 1, []byte("r")})
+
+	guns, err := s.ListGUNs()
+	assert.Nil(t, err, "Expected error to be nil")
+	assert.Equal(t, []string{"a/gun", "a/gun.extra", "b/gun"}, guns)
+
+	assert.Nil(t, s.Delete("a/gun"))
+	_, err = s.GetCurrent("a/gun", "root")
+	assert.IsType(t, &ErrNotFound{}, err, "Expected error to be ErrNotFound")
+	_, err = s.GetCurrent("a/gun.extra", "root")
+	assert.Nil(t, err, "Deleting a GUN should not delete GUNs it is a prefix of")
+
+	guns, err = s.ListGUNs()
+	assert.Nil(t, err, "Expected error to be nil")
+	assert.Equal(t, []string{"a/gun.extra", "b/gun"}, guns)
+}
+
+func TestFileTimestampKey(t *testing.T) {
+	s, cleanup := newFileStorage(t)
+	defer cleanup()
+
+	_, _, err := s.GetTimestampKey("gun")
+	assert.IsType(t, &ErrNoKey{}, err, "Expected err to be ErrNoKey")
+
+	assert.Nil(t, s.SetTimestampKey("gun", data.RSAKey, []byte("test")))
+	err = s.SetTimestampKey("gun", data.RSAKey, []byte("test2"))
+	assert.IsType(t, &ErrTimestampKeyExists{}, err, "Expected err to be ErrTimestampKeyExists")
+
+	algorithm, public, err := s.GetTimestampKey("gun")
+	assert.Nil(t, err, "Expected error to be nil")
+	assert.Equal(t, data.RSAKey, algorithm)
+	assert.Equal(t, []byte("test"), public, "Public key did not match expected")
+}
+
+func TestFileLeftoverLockFile(t *testing.T) {
+	s, cleanup := newFileStorage(t)
+	defer cleanup()
+
+	// a lock file left behind by a process that exited isn't locked
+	lockPath := filepath.Join(s.baseDir, "lock")
+	assert.Nil(t, ioutil.WriteFile(lockPath, []byte("1\n"), 0600))
+	assert.Nil(t, s.UpdateCurrent("gun", MetaUpdate{"root", 1, []byte("r")}))
+}
+
+func TestFileLockWaitsForOtherHolder(t *testing.T) {
+	s, cleanup := newFileStorage(t)
+	defer cleanup()
+
+	// another process is simulated by a separate open file description,
+	// whose lock conflicts with the store's
+	f, err := os.OpenFile(filepath.Join(s.baseDir, "lock"), os.O_CREATE|os.O_RDWR, 0600)
+	assert.Nil(t, err)
+	defer f.Close()
+	locked, err := tryLockFile(f)
+	assert.Nil(t, err)
+	assert.True(t, locked)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.UpdateCurrent("gun", MetaUpdate{"root", 1, []byte("r")})
+	}()
+	select {
+	case <-done:
+		t.Fatal("Expected the update to wait for the lock, however long it is held")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.Nil(t, unlockFile(f))
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the update to complete once the lock was released")
+	}
+}
@@ -7,7 +7,12 @@ type MetaStore interface {
 	UpdateCurrent(gun string, update MetaUpdate) error
 	UpdateMany(gun string, updates []MetaUpdate) error
 	GetCurrent(gun, tufRole string) (data []byte, err error)
+	GetCurrentMeta(gun, tufRole string) (*StoredMeta, error)
+	GetVersions(gun, tufRole string, fromVersion, limit int) ([]StoredMeta, error)
 	Delete(gun string) error
+	ListGUNs() ([]string, error)
+	PruneVersions(policy RetentionPolicy) (int, error)
 	GetTimestampKey(gun string) (algorithm data.KeyAlgorithm, public []byte, err error)
 	SetTimestampKey(gun string, algorithm data.KeyAlgorithm, public []byte) error
+	CheckHealth() error
 }
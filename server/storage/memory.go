@@ -1,9 +1,9 @@
 package storage
 
 import (
-	"fmt"
-	"strings"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/endophage/gotuf/data"
 )
@@ -13,53 +13,76 @@ type key struct {
 	public    []byte
 }
 
+// metaKey identifies the versions of a role under a GUN
+type metaKey struct {
+	gun  string
+	role string
+}
+
 type ver struct {
-	version int
-	data    []byte
+	version   int
+	data      []byte
+	createdAt time.Time
 }
 
 // MemStorage is really just designed for dev and testing. It is very
 // inefficient in many scenarios
 type MemStorage struct {
 	lock    sync.Mutex
-	tufMeta map[string][]*ver
+	tufMeta map[metaKey][]*ver
 	tsKeys  map[string]*key
 }
 
 // NewMemStorage instantiates a memStorage instance
 func NewMemStorage() *MemStorage {
 	return &MemStorage{
-		tufMeta: make(map[string][]*ver),
+		tufMeta: make(map[metaKey][]*ver),
 		tsKeys:  make(map[string]*key),
 	}
 }
 
 // UpdateCurrent updates the meta data for a specific role
 func (st *MemStorage) UpdateCurrent(gun string, update MetaUpdate) error {
-	id := entryKey(gun, update.Role)
+	return st.UpdateMany(gun, []MetaUpdate{update})
+}
+
+// UpdateMany atomically updates multiple TUF records, keeping the previous
+// versions. A role may be updated several times in increasing version
+// order, the last update becoming current. If any update is not newer than
+// the version of its role before it, none are applied.
+func (st *MemStorage) UpdateMany(gun string, updates []MetaUpdate) error {
 	st.lock.Lock()
 	defer st.lock.Unlock()
-	if space, ok := st.tufMeta[id]; ok {
-		for _, v := range space {
-			if v.version >= update.Version {
-				return &ErrOldVersion{}
-			}
+	latest := make(map[string]int)
+	for _, u := range updates {
+		version, ok := latest[u.Role]
+		if space := st.tufMeta[entryKey(gun, u.Role)]; !ok && len(space) > 0 {
+			version, ok = space[len(space)-1].version, true
+		}
+		if ok && u.Version <= version {
+			return &ErrOldVersion{}
 		}
+		latest[u.Role] = u.Version
 	}
-	st.tufMeta[id] = append(st.tufMeta[id], &ver{version: update.Version, data: update.Data})
-	return nil
-}
-
-// UpdateMany updates multiple TUF records
-func (st *MemStorage) UpdateMany(gun string, updates []MetaUpdate) error {
+	now := time.Now()
 	for _, u := range updates {
-		st.UpdateCurrent(gun, u)
+		id := entryKey(gun, u.Role)
+		st.tufMeta[id] = append(st.tufMeta[id], &ver{version: u.Version, data: u.Data, createdAt: now})
 	}
 	return nil
 }
 
 // GetCurrent returns the metadada for a given role, under a GUN
 func (st *MemStorage) GetCurrent(gun, role string) (data []byte, err error) {
+	meta, err := st.GetCurrentMeta(gun, role)
+	if err != nil {
+		return nil, err
+	}
+	return meta.Data, nil
+}
+
+// GetCurrentMeta returns the current version of a role under a GUN
+func (st *MemStorage) GetCurrentMeta(gun, role string) (*StoredMeta, error) {
 	id := entryKey(gun, role)
 	st.lock.Lock()
 	defer st.lock.Unlock()
@@ -67,7 +90,33 @@ func (st *MemStorage) GetCurrent(gun, role string) (data []byte, err error) {
 	if !ok || len(space) == 0 {
 		return nil, &ErrNotFound{}
 	}
-	return space[len(space)-1].data, nil
+	v := space[len(space)-1]
+	return &StoredMeta{Version: v.version, Data: v.data, CreatedAt: v.createdAt}, nil
+}
+
+// GetVersions returns the versions of a role under a GUN that are at least
+// fromVersion, oldest first. At most limit are returned, unless it is 0.
+func (st *MemStorage) GetVersions(gun, role string, fromVersion, limit int) ([]StoredMeta, error) {
+	id := entryKey(gun, role)
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	space, ok := st.tufMeta[id]
+	if !ok || len(space) == 0 {
+		return nil, &ErrNotFound{}
+	}
+	var versions []StoredMeta
+	for _, v := range space {
+		if limit > 0 && len(versions) == limit {
+			break
+		}
+		if v.version >= fromVersion {
+			versions = append(versions, StoredMeta{Version: v.version, Data: v.data, CreatedAt: v.createdAt})
+		}
+	}
+	if len(versions) == 0 {
+		return nil, &ErrNotFound{}
+	}
+	return versions, nil
 }
 
 // Delete delets all the metadata for a given GUN
@@ -75,13 +124,49 @@ func (st *MemStorage) Delete(gun string) error {
 	st.lock.Lock()
 	defer st.lock.Unlock()
 	for k := range st.tufMeta {
-		if strings.HasPrefix(k, gun) {
+		if k.gun == gun {
 			delete(st.tufMeta, k)
 		}
 	}
 	return nil
 }
 
+// ListGUNs returns every GUN that has metadata stored, sorted
+func (st *MemStorage) ListGUNs() ([]string, error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	seen := make(map[string]bool)
+	guns := []string{}
+	for k, space := range st.tufMeta {
+		if len(space) == 0 || seen[k.gun] {
+			continue
+		}
+		seen[k.gun] = true
+		guns = append(guns, k.gun)
+	}
+	sort.Strings(guns)
+	return guns, nil
+}
+
+// PruneVersions deletes the old versions selected by policy, returning how
+// many were deleted
+func (st *MemStorage) PruneVersions(policy RetentionPolicy) (int, error) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	pruned := 0
+	for id, space := range st.tufMeta {
+		kept := make([]*ver, 0, len(space))
+		for i, v := range space {
+			if policy.keeps(id.role, len(space)-i-1, v.createdAt) {
+				kept = append(kept, v)
+			}
+		}
+		pruned += len(space) - len(kept)
+		st.tufMeta[id] = kept
+	}
+	return pruned, nil
+}
+
 // GetTimestampKey returns the public key material of the timestamp key of a given gun
 func (st *MemStorage) GetTimestampKey(gun string) (algorithm data.KeyAlgorithm, public []byte, err error) {
 	// no need for lock. It's ok to return nil if an update
@@ -106,6 +191,11 @@ func (st *MemStorage) SetTimestampKey(gun string, algorithm data.KeyAlgorithm, p
 	return nil
 }
 
-func entryKey(gun, role string) string {
-	return fmt.Sprintf("%s.%s", gun, role)
+// CheckHealth always succeeds as there is no backing service to check
+func (st *MemStorage) CheckHealth() error {
+	return nil
+}
+
+func entryKey(gun, role string) metaKey {
+	return metaKey{gun: gun, role: role}
 }
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"testing"
+	"time"
 
 	"github.com/endophage/gotuf/data"
 	"github.com/stretchr/testify/assert"
@@ -19,6 +20,27 @@ func TestUpdateCurrent(t *testing.T) {
 	assert.Equal(t, []byte("test"), v.data, "Data was incorrect")
 }
 
+func TestUpdateManyIsAtomic(t *testing.T) {
+	s := NewMemStorage()
+	s.UpdateMany("gun", []MetaUpdate{{"root", 1, []byte("root1")}, {"targets", 1, []byte("targets1")}})
+
+	// targets is not newer, so root must not be updated either
+	err := s.UpdateMany("gun", []MetaUpdate{{"root", 2, []byte("root2")}, {"targets", 1, []byte("targets1")}})
+	assert.IsType(t, &ErrOldVersion{}, err, "Expected error to be ErrOldVersion")
+	assert.Len(t, s.tufMeta[entryKey("gun", "root")], 1, "Root should not have been updated")
+
+	err = s.UpdateMany("gun", []MetaUpdate{{"root", 3, []byte("root3")}, {"root", 2, []byte("root2")}})
+	assert.IsType(t, &ErrOldVersion{}, err, "Expected error to be ErrOldVersion")
+	assert.Len(t, s.tufMeta[entryKey("gun", "root")], 1, "Root should not have been updated")
+
+	// previous versions are kept
+	assert.Nil(t, s.UpdateMany("gun", []MetaUpdate{{"root", 2, []byte("root2")}}))
+	root := s.tufMeta[entryKey("gun", "root")]
+	assert.Len(t, root, 2)
+	assert.Equal(t, []byte("root1"), root[0].data)
+	assert.Equal(t, []byte("root2"), root[1].data)
+}
+
 func TestGetCurrent(t *testing.T) {
 	s := NewMemStorage()
 
@@ -67,3 +89,56 @@ func TestSetTimestampKey(t *testing.T) {
 	assert.Equal(t, []byte("test"), k.public, "Public key did not match expected")
 
 }
+
+func TestGetVersions(t *testing.T) {
+	s := NewMemStorage()
+
+	_, err := s.GetVersions("gun", "role", 0, 0)
+	assert.IsType(t, &ErrNotFound{}, err, "Expected error to be ErrNotFound")
+
+	s.UpdateCurrent("gun", MetaUpdate{"role", 1, []byte("v1")})
+	s.UpdateCurrent("gun", MetaUpdate{"role", 2, []byte("v2")})
+	s.UpdateCurrent("gun", MetaUpdate{"role", 3, []byte("v3")})
+
+	versions, err := s.GetVersions("gun", "role", 2, 0)
+	assert.Nil(t, err, "Expected error to be nil")
+	assert.Len(t, versions, 2)
+	assert.Equal(t, 2, versions[0].Version)
+	assert.Equal(t, []byte("v3"), versions[1].Data)
+	assert.False(t, versions[1].CreatedAt.IsZero())
+}
+
+func TestListGUNs(t *testing.T) {
+	s := NewMemStorage()
+	guns, err := s.ListGUNs()
+	assert.Nil(t, err, "Expected error to be nil")
+	assert.Empty(t, guns)
+
+	s.UpdateCurrent("b.gun", MetaUpdate{"root", 1, []byte("r")})
+	s.UpdateCurrent("b.gun", MetaUpdate{"targets", 1, []byte("t")})
+	s.UpdateCurrent("a.gun", MetaUpdate{"root", 1, []byte("r")})
+
+	guns, err = s.ListGUNs()
+	assert.Nil(t, err, "Expected error to be nil")
+	assert.Equal(t, []string{"a.gun", "b.gun"}, guns)
+}
+
+func TestPruneVersionsKeepsRecent(t *testing.T) {
+	s := NewMemStorage()
+	for i := 1; i <= 4; i++ {
+		s.UpdateCurrent("gun", MetaUpdate{"timestamp", i, []byte("ts")})
+	}
+	// versions 1 and 2 are a day old
+	now := time.Now()
+	for _, v := range s.tufMeta[entryKey("gun", "timestamp")][:2] {
+		v.createdAt = now.Add(-24 * time.Hour)
+	}
+
+	pruned, err := s.PruneVersions(RetentionPolicy{KeepVersions: 1, KeepAfter: now.Add(-time.Hour)})
+	assert.Nil(t, err, "Expected error to be nil")
+	assert.Equal(t, 2, pruned)
+	versions, err := s.GetVersions("gun", "timestamp", 0, 0)
+	assert.Nil(t, err, "Expected error to be nil")
+	assert.Len(t, versions, 2)
+	assert.Equal(t, 3, versions[0].Version)
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/endophage/gotuf/data"
+
+	"github.com/docker/notary/pkg/metrics"
+)
+
+var storageLatency = metrics.NewHistogramVec(
+	"notary_server_storage_duration_seconds",
+	"Latency of MetaStore operations, partitioned by operation.",
+	nil,
+	"operation",
+)
+
+// InstrumentedStore wraps a MetaStore and records the latency of every
+// operation performed against it
+type InstrumentedStore struct {
+	MetaStore
+}
+
+// NewInstrumentedStore is a convenience method to create an InstrumentedStore
+func NewInstrumentedStore(store MetaStore) *InstrumentedStore {
+	return &InstrumentedStore{MetaStore: store}
+}
+
+// UpdateCurrent records the latency of the wrapped UpdateCurrent
+func (st *InstrumentedStore) UpdateCurrent(gun string, update MetaUpdate) error {
+	defer storageLatency.ObserveSince(time.Now(), "UpdateCurrent")
+	return st.MetaStore.UpdateCurrent(gun, update)
+}
+
+// UpdateMany records the latency of the wrapped UpdateMany
+func (st *InstrumentedStore) UpdateMany(gun string, updates []MetaUpdate) error {
+	defer storageLatency.ObserveSince(time.Now(), "UpdateMany")
+	return st.MetaStore.UpdateMany(gun, updates)
+}
+
+// GetCurrent records the latency of the wrapped GetCurrent
+func (st *InstrumentedStore) GetCurrent(gun, tufRole string) ([]byte, error) {
+	defer storageLatency.ObserveSince(time.Now(), "GetCurrent")
+	return st.MetaStore.GetCurrent(gun, tufRole)
+}
+
+// GetCurrentMeta records the latency of the wrapped GetCurrentMeta
+func (st *InstrumentedStore) GetCurrentMeta(gun, tufRole string) (*StoredMeta, error) {
+	defer storageLatency.ObserveSince(time.Now(), "GetCurrentMeta")
+	return st.MetaStore.GetCurrentMeta(gun, tufRole)
+}
+
+// GetVersions records the latency of the wrapped GetVersions
+func (st *InstrumentedStore) GetVersions(gun, tufRole string, fromVersion, limit int) ([]StoredMeta, error) {
+	defer storageLatency.ObserveSince(time.Now(), "GetVersions")
+	return st.MetaStore.GetVersions(gun, tufRole, fromVersion, limit)
+}
+
+// Delete records the latency of the wrapped Delete
+func (st *InstrumentedStore) Delete(gun string) error {
+	defer storageLatency.ObserveSince(time.Now(), "Delete")
+	return st.MetaStore.Delete(gun)
+}
+
+// ListGUNs records the latency of the wrapped ListGUNs
+func (st *InstrumentedStore) ListGUNs() ([]string, error) {
+	defer storageLatency.ObserveSince(time.Now(), "ListGUNs")
+	return st.MetaStore.ListGUNs()
+}
+
+// PruneVersions records the latency of the wrapped PruneVersions
+func (st *InstrumentedStore) PruneVersions(policy RetentionPolicy) (int, error) {
+	defer storageLatency.ObserveSince(time.Now(), "PruneVersions")
+	return st.MetaStore.PruneVersions(policy)
+}
+
+// GetTimestampKey records the latency of the wrapped GetTimestampKey
+func (st *InstrumentedStore) GetTimestampKey(gun string) (data.KeyAlgorithm, []byte, error) {
+	defer storageLatency.ObserveSince(time.Now(), "GetTimestampKey")
+	return st.MetaStore.GetTimestampKey(gun)
+}
+
+// SetTimestampKey records the latency of the wrapped SetTimestampKey
+func (st *InstrumentedStore) SetTimestampKey(gun string, algorithm data.KeyAlgorithm, public []byte) error {
+	defer storageLatency.ObserveSince(time.Now(), "SetTimestampKey")
+	return st.MetaStore.SetTimestampKey(gun, algorithm, public)
+}
+
+// CheckHealth records the latency of the wrapped CheckHealth
+func (st *InstrumentedStore) CheckHealth() error {
+	defer storageLatency.ObserveSince(time.Now(), "CheckHealth")
+	return st.MetaStore.CheckHealth()
+}
@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/endophage/gotuf/data"
+)
+
+// RetentionPolicy selects the old versions of metadata deleted by
+// PruneVersions. A version is deleted only if it is neither among the
+// KeepVersions newest versions of its role nor created after KeepAfter.
+// The current version of every role, and every version of the root role,
+// are always kept: clients need the old roots to verify root rotations.
+type RetentionPolicy struct {
+	// KeepVersions is the number of newest versions of each role to keep
+	KeepVersions int
+	// KeepAfter keeps every version created after it
+	KeepAfter time.Time
+}
+
+// keeps reports whether the policy keeps a version of role that has newer
+// versions stored after it and was created at created
+func (p RetentionPolicy) keeps(role string, newer int, created time.Time) bool {
+	return role == data.CanonicalRootRole || newer == 0 || newer < p.KeepVersions || created.After(p.KeepAfter)
+}
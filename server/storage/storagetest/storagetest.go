@@ -0,0 +1,386 @@
+// Package storagetest provides a conformance suite for implementations of
+// storage.MetaStore, so that every backend behaves the same way towards the
+// server.
+package storagetest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/docker/notary/server/storage"
+)
+
+// metaStoreTests are the tests run by RunMetaStoreTests, by name. Slow tests
+// are not run with -short.
+var metaStoreTests = []struct {
+	name string
+	test func(t *testing.T, s storage.MetaStore)
+	slow bool
+}{
+	{"GetMissing", testGetMissing, false},
+	{"VersionMonotonicity", testVersionMonotonicity, false},
+	{"GetVersions", testGetVersions, false},
+	{"GetCurrentMeta", testGetCurrentMeta, false},
+	{"UpdateManyOldVersion", testUpdateManyOldVersion, false},
+	{"UpdateManyAtomic", testUpdateManyAtomic, false},
+	{"UpdateManySameRole", testUpdateManySameRole, false},
+	{"Delete", testDelete, false},
+	{"ListGUNs", testListGUNs, false},
+	{"PruneVersions", testPruneVersions, false},
+	{"TimestampKey", testTimestampKey, false},
+	{"ConcurrentUpdates", testConcurrentUpdates, true},
+	{"ConcurrentTimestampKeys", testConcurrentTimestampKeys, true},
+	{"CheckHealth", testCheckHealth, false},
+}
+
+// RunMetaStoreTests runs the conformance suite, calling newStore for an
+// empty MetaStore before each test. The tests named in skip, and the slow
+// tests when running with -short, are not run.
+func RunMetaStoreTests(t *testing.T, newStore func() storage.MetaStore, skip ...string) {
+	skipped := make(map[string]bool)
+	for _, name := range skip {
+		skipped[name] = true
+	}
+	for _, mt := range metaStoreTests {
+		if skipped[mt.name] || (mt.slow && testing.Short()) {
+			t.Logf("skipping %s", mt.name)
+			continue
+		}
+		t.Logf("running %s", mt.name)
+		mt.test(t, newStore())
+	}
+}
+
+func update(role string, version int, meta string) storage.MetaUpdate {
+	return storage.MetaUpdate{Role: role, Version: version, Data: []byte(meta)}
+}
+
+func assertCurrent(t *testing.T, s storage.MetaStore, gun, role, expected string) {
+	meta, err := s.GetCurrent(gun, role)
+	if assert.NoError(t, err, "%s %s", gun, role) {
+		assert.Equal(t, expected, string(meta), "%s %s", gun, role)
+	}
+}
+
+func testGetMissing(t *testing.T, s storage.MetaStore) {
+	_, err := s.GetCurrent("gun", "root")
+	assert.IsType(t, &storage.ErrNotFound{}, err)
+	_, err = s.GetVersions("gun", "root", 0, 0)
+	assert.IsType(t, &storage.ErrNotFound{}, err)
+
+	assert.NoError(t, s.UpdateCurrent("gun", update("root", 1, "root1")))
+	_, err = s.GetCurrent("gun", "targets")
+	assert.IsType(t, &storage.ErrNotFound{}, err)
+	_, err = s.GetCurrent("other", "root")
+	assert.IsType(t, &storage.ErrNotFound{}, err)
+}
+
+func testVersionMonotonicity(t *testing.T, s storage.MetaStore) {
+	assert.NoError(t, s.UpdateCurrent("gun", update("root", 1, "root1")))
+	assert.NoError(t, s.UpdateCurrent("gun", update("root", 2, "root2")))
+	// versions may be skipped
+	assert.NoError(t, s.UpdateCurrent("gun", update("root", 4, "root4")))
+	assertCurrent(t, s, "gun", "root", "root4")
+
+	err := s.UpdateCurrent("gun", update("root", 4, "again"))
+	assert.IsType(t, &storage.ErrOldVersion{}, err, "duplicate version")
+	err = s.UpdateCurrent("gun", update("root", 3, "root3"))
+	assert.IsType(t, &storage.ErrOldVersion{}, err, "older version")
+	assertCurrent(t, s, "gun", "root", "root4")
+
+	// versions are per role and per GUN
+	assert.NoError(t, s.UpdateCurrent("gun", update("targets", 1, "targets1")))
+	assert.NoError(t, s.UpdateCurrent("other", update("root", 1, "other1")))
+	assertCurrent(t, s, "gun", "root", "root4")
+}
+
+func testGetVersions(t *testing.T, s storage.MetaStore) {
+	for i := 1; i <= 5; i++ {
+		assert.NoError(t, s.UpdateCurrent("gun", update("targets", i, fmt.Sprintf("targets%d", i))))
+	}
+
+	versions, err := s.GetVersions("gun", "targets", 0, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, versions, 5) {
+		for i, v := range versions {
+			assert.Equal(t, i+1, v.Version, "versions should be oldest first")
+			assert.Equal(t, fmt.Sprintf("targets%d", i+1), string(v.Data))
+			assert.False(t, v.CreatedAt.IsZero(), "CreatedAt should be set")
+		}
+	}
+
+	versions, err = s.GetVersions("gun", "targets", 4, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, versions, 2) {
+		assert.Equal(t, 4, versions[0].Version)
+		assert.Equal(t, 5, versions[1].Version)
+	}
+
+	versions, err = s.GetVersions("gun", "targets", 2, 2)
+	assert.NoError(t, err)
+	if assert.Len(t, versions, 2, "limit should bound the versions returned") {
+		assert.Equal(t, 2, versions[0].Version)
+		assert.Equal(t, 3, versions[1].Version)
+	}
+
+	_, err = s.GetVersions("gun", "targets", 6, 0)
+	assert.IsType(t, &storage.ErrNotFound{}, err)
+}
+
+func testGetCurrentMeta(t *testing.T, s storage.MetaStore) {
+	_, err := s.GetCurrentMeta("gun", "targets")
+	assert.IsType(t, &storage.ErrNotFound{}, err)
+
+	assert.NoError(t, s.UpdateCurrent("gun", update("targets", 1, "targets1")))
+	assert.NoError(t, s.UpdateCurrent("gun", update("targets", 3, "targets3")))
+	meta, err := s.GetCurrentMeta("gun", "targets")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, meta.Version)
+		assert.Equal(t, "targets3", string(meta.Data))
+		assert.False(t, meta.CreatedAt.IsZero(), "CreatedAt should be set")
+	}
+}
+
+func testUpdateManyOldVersion(t *testing.T, s storage.MetaStore) {
+	assert.NoError(t, s.UpdateMany("gun", []storage.MetaUpdate{
+		update("root", 1, "root1"),
+		update("targets", 1, "targets1"),
+	}))
+	assertCurrent(t, s, "gun", "root", "root1")
+	assertCurrent(t, s, "gun", "targets", "targets1")
+
+	err := s.UpdateMany("gun", []storage.MetaUpdate{update("targets", 1, "again")})
+	assert.IsType(t, &storage.ErrOldVersion{}, err)
+	assertCurrent(t, s, "gun", "targets", "targets1")
+}
+
+func testUpdateManyAtomic(t *testing.T, s storage.MetaStore) {
+	assert.NoError(t, s.UpdateMany("gun", []storage.MetaUpdate{
+		update("root", 1, "root1"),
+		update("targets", 1, "targets1"),
+	}))
+
+	// the last update is old, so none may be applied
+	err := s.UpdateMany("gun", []storage.MetaUpdate{
+		update("root", 2, "root2"),
+		update("snapshot", 1, "snapshot1"),
+		update("targets", 1, "again"),
+	})
+	assert.IsType(t, &storage.ErrOldVersion{}, err)
+	assertCurrent(t, s, "gun", "root", "root1")
+	assertCurrent(t, s, "gun", "targets", "targets1")
+	_, err = s.GetCurrent("gun", "snapshot")
+	assert.IsType(t, &storage.ErrNotFound{}, err, "snapshot should not have been stored")
+	versions, err := s.GetVersions("gun", "root", 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, versions, 1, "root version 2 should not have been stored")
+
+	// the versions of a failed update can still be used
+	assert.NoError(t, s.UpdateMany("gun", []storage.MetaUpdate{
+		update("root", 2, "root2"),
+		update("snapshot", 1, "snapshot1"),
+	}))
+	assertCurrent(t, s, "gun", "root", "root2")
+}
+
+func testUpdateManySameRole(t *testing.T, s storage.MetaStore) {
+	assert.NoError(t, s.UpdateMany("gun", []storage.MetaUpdate{
+		update("root", 1, "root1"),
+		update("root", 2, "root2"),
+		update("targets", 1, "targets1"),
+	}))
+	assertCurrent(t, s, "gun", "root", "root2")
+	versions, err := s.GetVersions("gun", "root", 0, 0)
+	if assert.NoError(t, err) && assert.Len(t, versions, 2) {
+		assert.Equal(t, "root1", string(versions[0].Data))
+		assert.Equal(t, "root2", string(versions[1].Data))
+	}
+
+	// the versions of a role must increase within an update too
+	err = s.UpdateMany("gun", []storage.MetaUpdate{
+		update("root", 4, "root4"),
+		update("root", 3, "root3"),
+	})
+	assert.IsType(t, &storage.ErrOldVersion{}, err)
+	assertCurrent(t, s, "gun", "root", "root2")
+}
+
+func testDelete(t *testing.T, s storage.MetaStore) {
+	guns := []string{"docker.com/notary", "docker.com/notary2", "docker.com/notary/sub"}
+	for _, gun := range guns {
+		assert.NoError(t, s.UpdateCurrent(gun, update("root", 1, gun)))
+		assert.NoError(t, s.UpdateCurrent(gun, update("targets", 1, gun)))
+	}
+
+	assert.NoError(t, s.Delete("docker.com/notary"))
+	for _, role := range []string{"root", "targets"} {
+		_, err := s.GetCurrent("docker.com/notary", role)
+		assert.IsType(t, &storage.ErrNotFound{}, err, "%s should have been deleted", role)
+		_, err = s.GetVersions("docker.com/notary", role, 0, 0)
+		assert.IsType(t, &storage.ErrNotFound{}, err, "%s should have been deleted", role)
+	}
+	// GUNs the deleted one is a prefix of are kept
+	for _, gun := range guns[1:] {
+		assertCurrent(t, s, gun, "root", gun)
+		assertCurrent(t, s, gun, "targets", gun)
+	}
+
+	// deleting a GUN that does not exist is not an error
+	assert.NoError(t, s.Delete("docker.com/missing"))
+
+	// a deleted GUN starts again from scratch
+	assert.NoError(t, s.UpdateCurrent("docker.com/notary", update("root", 1, "recreated")))
+	assertCurrent(t, s, "docker.com/notary", "root", "recreated")
+}
+
+func testListGUNs(t *testing.T, s storage.MetaStore) {
+	guns, err := s.ListGUNs()
+	assert.NoError(t, err)
+	assert.Len(t, guns, 0)
+
+	assert.NoError(t, s.UpdateCurrent("docker.com/b", update("root", 1, "root1")))
+	assert.NoError(t, s.UpdateCurrent("docker.com/a", update("root", 1, "root1")))
+	assert.NoError(t, s.UpdateCurrent("docker.com/a", update("targets", 1, "targets1")))
+	assert.NoError(t, s.UpdateCurrent("docker.com/a.b", update("root", 1, "root1")))
+
+	guns, err = s.ListGUNs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"docker.com/a", "docker.com/a.b", "docker.com/b"}, guns)
+
+	assert.NoError(t, s.Delete("docker.com/a"))
+	guns, err = s.ListGUNs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"docker.com/a.b", "docker.com/b"}, guns)
+}
+
+func assertVersions(t *testing.T, s storage.MetaStore, gun, role string, expected ...int) {
+	versions, err := s.GetVersions(gun, role, 0, 0)
+	if !assert.NoError(t, err, "%s %s", gun, role) {
+		return
+	}
+	stored := make([]int, 0, len(versions))
+	for _, v := range versions {
+		stored = append(stored, v.Version)
+	}
+	assert.Equal(t, expected, stored, "%s %s", gun, role)
+}
+
+func testPruneVersions(t *testing.T, s storage.MetaStore) {
+	for i := 1; i <= 5; i++ {
+		assert.NoError(t, s.UpdateCurrent("gun", update("root", i, fmt.Sprintf("root%d", i))))
+		assert.NoError(t, s.UpdateCurrent("gun", update("targets", i, fmt.Sprintf("targets%d", i))))
+	}
+	assert.NoError(t, s.UpdateCurrent("other", update("timestamp", 1, "timestamp1")))
+	assert.NoError(t, s.UpdateCurrent("other", update("timestamp", 2, "timestamp2")))
+
+	// everything is recent enough to keep
+	pruned, err := s.PruneVersions(storage.RetentionPolicy{KeepVersions: 2, KeepAfter: time.Now().Add(-time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, pruned)
+	assertVersions(t, s, "gun", "targets", 1, 2, 3, 4, 5)
+
+	// a cutoff in the future leaves only the newest versions
+	pruned, err = s.PruneVersions(storage.RetentionPolicy{KeepVersions: 2, KeepAfter: time.Now().Add(time.Minute)})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, pruned)
+	assertVersions(t, s, "gun", "targets", 4, 5)
+	assertVersions(t, s, "gun", "root", 1, 2, 3, 4, 5)
+	assertVersions(t, s, "other", "timestamp", 1, 2)
+	assertCurrent(t, s, "gun", "targets", "targets5")
+
+	// the current version is kept whatever the policy
+	pruned, err = s.PruneVersions(storage.RetentionPolicy{KeepAfter: time.Now().Add(time.Minute)})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, pruned)
+	assertVersions(t, s, "gun", "targets", 5)
+	assertVersions(t, s, "gun", "root", 1, 2, 3, 4, 5)
+	assertVersions(t, s, "other", "timestamp", 2)
+
+	// pruned versions cannot be reused
+	err = s.UpdateCurrent("gun", update("targets", 3, "again"))
+	assert.IsType(t, &storage.ErrOldVersion{}, err)
+	assert.NoError(t, s.UpdateCurrent("gun", update("targets", 6, "targets6")))
+}
+
+func testTimestampKey(t *testing.T, s storage.MetaStore) {
+	_, _, err := s.GetTimestampKey("gun")
+	assert.IsType(t, &storage.ErrNoKey{}, err)
+
+	assert.NoError(t, s.SetTimestampKey("gun", data.ED25519Key, []byte("key1")))
+	err = s.SetTimestampKey("gun", data.ECDSAKey, []byte("key2"))
+	assert.IsType(t, &storage.ErrTimestampKeyExists{}, err)
+
+	algorithm, public, err := s.GetTimestampKey("gun")
+	assert.NoError(t, err)
+	assert.Equal(t, data.ED25519Key, algorithm)
+	assert.Equal(t, []byte("key1"), public, "the first key set should be kept")
+
+	// keys are per GUN
+	assert.NoError(t, s.SetTimestampKey("gun2", data.ECDSAKey, []byte("key2")))
+}
+
+// concurrency is the number of goroutines racing in the concurrency tests
+const concurrency = 10
+
+func testConcurrentUpdates(t *testing.T, s storage.MetaStore) {
+	errs := make([]error, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.UpdateCurrent("gun", update("root", 1, fmt.Sprintf("writer%d", i)))
+		}(i)
+	}
+	wg.Wait()
+
+	winner := -1
+	for i, err := range errs {
+		if err == nil {
+			assert.Equal(t, -1, winner, "only one writer should succeed")
+			winner = i
+		} else {
+			assert.IsType(t, &storage.ErrOldVersion{}, err)
+		}
+	}
+	if assert.NotEqual(t, -1, winner, "one writer should succeed") {
+		assertCurrent(t, s, "gun", "root", fmt.Sprintf("writer%d", winner))
+	}
+}
+
+func testConcurrentTimestampKeys(t *testing.T, s storage.MetaStore) {
+	errs := make([]error, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.SetTimestampKey("gun", data.ED25519Key, []byte(fmt.Sprintf("key%d", i)))
+		}(i)
+	}
+	wg.Wait()
+
+	winner := -1
+	for i, err := range errs {
+		if err == nil {
+			assert.Equal(t, -1, winner, "only one key should be set")
+			winner = i
+		} else {
+			assert.IsType(t, &storage.ErrTimestampKeyExists{}, err)
+		}
+	}
+	if assert.NotEqual(t, -1, winner, "one key should be set") {
+		_, public, err := s.GetTimestampKey("gun")
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("key%d", winner), string(public))
+	}
+}
+
+func testCheckHealth(t *testing.T, s storage.MetaStore) {
+	assert.NoError(t, s.CheckHealth())
+}
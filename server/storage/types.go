@@ -1,8 +1,17 @@
 package storage
 
+import "time"
+
 // MetaUpdate packages up the fields required to update a TUF record
 type MetaUpdate struct {
 	Role    string
 	Version int
 	Data    []byte
 }
+
+// StoredMeta is a single version of a TUF record as held in a MetaStore
+type StoredMeta struct {
+	Version   int
+	Data      []byte
+	CreatedAt time.Time
+}
@@ -3,6 +3,7 @@ package timestamp
 import (
 	"bytes"
 	"encoding/json"
+	"time"
 
 	"github.com/endophage/gotuf/data"
 	"github.com/endophage/gotuf/signed"
@@ -49,12 +50,12 @@ func GetOrCreateTimestampKey(gun string, store storage.MetaStore, crypto signed.
 // GetOrCreateTimestamp returns the current timestamp for the gun. This may mean
 // a new timestamp is generated either because none exists, or because the current
 // one has expired. Once generated, the timestamp is saved in the store.
-func GetOrCreateTimestamp(gun string, store storage.MetaStore, cryptoService signed.CryptoService) ([]byte, error) {
+func GetOrCreateTimestamp(gun string, store storage.MetaStore, cryptoService signed.CryptoService) (*storage.StoredMeta, error) {
 	snapshot, err := store.GetCurrent(gun, "snapshot")
 	if err != nil {
 		return nil, err
 	}
-	d, err := store.GetCurrent(gun, "timestamp")
+	current, err := store.GetCurrentMeta(gun, "timestamp")
 	if err != nil {
 		if _, ok := err.(*storage.ErrNotFound); !ok {
 			logrus.Error("error retrieving timestamp: ", err.Error())
@@ -63,14 +64,14 @@ func GetOrCreateTimestamp(gun string, store storage.MetaStore, cryptoService sig
 		logrus.Debug("No timestamp found, will proceed to create first timestamp")
 	}
 	ts := &data.SignedTimestamp{}
-	if d != nil {
-		err := json.Unmarshal(d, ts)
+	if current != nil {
+		err := json.Unmarshal(current.Data, ts)
 		if err != nil {
 			logrus.Error("Failed to unmarshal existing timestamp")
 			return nil, err
 		}
 		if !timestampExpired(ts) && !snapshotExpired(ts, snapshot) {
-			return d, nil
+			return current, nil
 		}
 	}
 	sgnd, version, err := CreateTimestamp(gun, ts, snapshot, store, cryptoService)
@@ -83,11 +84,12 @@ func GetOrCreateTimestamp(gun string, store storage.MetaStore, cryptoService sig
 		logrus.Error("Failed to marshal new timestamp")
 		return nil, err
 	}
+	created := time.Now()
 	err = store.UpdateCurrent(gun, storage.MetaUpdate{Role: "timestamp", Version: version, Data: out})
 	if err != nil {
 		return nil, err
 	}
-	return out, nil
+	return &storage.StoredMeta{Version: version, Data: out, CreatedAt: created}, nil
 }
 
 // timestampExpired compares the current time to the expiry time of the timestamp
@@ -107,6 +109,18 @@ func snapshotExpired(ts *data.SignedTimestamp, snapshot []byte) bool {
 	return !bytes.Equal(hash, ts.Signed.Meta["snapshot"].Hashes["sha256"])
 }
 
+// DefaultLifetime is how long new timestamps are valid for unless
+// SetLifetime has been called
+const DefaultLifetime = 24 * time.Hour
+
+var lifetime = DefaultLifetime
+
+// SetLifetime sets how long the timestamps created from now on are valid
+// for. It is not safe to call while timestamps are being created.
+func SetLifetime(d time.Duration) {
+	lifetime = d
+}
+
 // CreateTimestamp creates a new timestamp. If a prev timestamp is provided, it
 // is assumed this is the immediately previous one, and the new one will have a
 // version number one higher than prev. The store is used to lookup the current
@@ -132,6 +146,7 @@ func CreateTimestamp(gun string, prev *data.SignedTimestamp, snapshot []byte, st
 	if prev != nil {
 		ts.Signed.Version = prev.Signed.Version + 1
 	}
+	ts.Signed.Expires = time.Now().Add(lifetime)
 	sgndTs, err := cjson.Marshal(ts.Signed)
 	if err != nil {
 		return nil, 0, err
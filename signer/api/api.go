@@ -185,6 +185,8 @@ func Sign(cryptoServices signer.CryptoServiceIndex) http.Handler {
 			w.Write([]byte(err.Error()))
 			return
 		}
+		signCount.Inc(tufKey.Algorithm().String())
+
 		signature := &pb.Signature{
 			KeyInfo: &pb.KeyInfo{
 				KeyID:     &pb.KeyID{ID: tufKey.ID()},
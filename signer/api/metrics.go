@@ -0,0 +1,19 @@
+package api
+
+import (
+	"github.com/docker/notary/pkg/metrics"
+)
+
+var (
+	rpcLatency = metrics.NewHistogramVec(
+		"notary_signer_rpc_duration_seconds",
+		"Latency of RPC calls served by the signer, partitioned by method.",
+		nil,
+		"method",
+	)
+	signCount = metrics.NewCounterVec(
+		"notary_signer_signatures_total",
+		"Number of signatures created, partitioned by key algorithm.",
+		"algorithm",
+	)
+)
@@ -2,6 +2,7 @@ package api
 
 import (
 	"fmt"
+	"time"
 
 	ctxu "github.com/docker/distribution/context"
 	"github.com/docker/notary/signer"
@@ -27,6 +28,8 @@ type SignerServer struct {
 
 //CreateKey returns a PublicKey created using KeyManagementServer's SigningService
 func (s *KeyManagementServer) CreateKey(ctx context.Context, algorithm *pb.Algorithm) (*pb.PublicKey, error) {
+	defer rpcLatency.ObserveSince(time.Now(), "CreateKey")
+
 	keyAlgo := data.KeyAlgorithm(algorithm.Algorithm)
 
 	service := s.CryptoServices[keyAlgo]
@@ -55,6 +58,8 @@ func (s *KeyManagementServer) CreateKey(ctx context.Context, algorithm *pb.Algor
 
 //DeleteKey deletes they key associated with a KeyID
 func (s *KeyManagementServer) DeleteKey(ctx context.Context, keyID *pb.KeyID) (*pb.Void, error) {
+	defer rpcLatency.ObserveSince(time.Now(), "DeleteKey")
+
 	_, service, err := FindKeyByID(s.CryptoServices, keyID)
 
 	logger := ctxu.GetLogger(ctx)
@@ -82,6 +87,8 @@ func (s *KeyManagementServer) DeleteKey(ctx context.Context, keyID *pb.KeyID) (*
 
 //GetKeyInfo returns they PublicKey associated with a KeyID
 func (s *KeyManagementServer) GetKeyInfo(ctx context.Context, keyID *pb.KeyID) (*pb.PublicKey, error) {
+	defer rpcLatency.ObserveSince(time.Now(), "GetKeyInfo")
+
 	_, service, err := FindKeyByID(s.CryptoServices, keyID)
 
 	logger := ctxu.GetLogger(ctx)
@@ -108,6 +115,8 @@ func (s *KeyManagementServer) GetKeyInfo(ctx context.Context, keyID *pb.KeyID) (
 
 //Sign signs a message and returns the signature using a private key associate with the KeyID from the SignatureRequest
 func (s *SignerServer) Sign(ctx context.Context, sr *pb.SignatureRequest) (*pb.Signature, error) {
+	defer rpcLatency.ObserveSince(time.Now(), "Sign")
+
 	tufKey, service, err := FindKeyByID(s.CryptoServices, sr.KeyID)
 
 	logger := ctxu.GetLogger(ctx)
@@ -124,6 +133,7 @@ func (s *SignerServer) Sign(ctx context.Context, sr *pb.SignatureRequest) (*pb.S
 	}
 
 	logger.Info("Sign: Signed ", string(sr.Content), " with KeyID ", sr.KeyID.ID)
+	signCount.Inc(tufKey.Algorithm().String())
 
 	signature := &pb.Signature{
 		KeyInfo: &pb.KeyInfo{
@@ -156,6 +156,27 @@ func (s *KeyDBStore) RemoveKey(name string) error {
 	return nil
 }
 
+// CheckHealth verifies that the database can be reached and that the
+// passphrases for the default alias, and for every alias keys are
+// encrypted under, can be retrieved.
+func (s *KeyDBStore) CheckHealth() error {
+	if err := s.db.DB().Ping(); err != nil {
+		return fmt.Errorf("unable to reach key database: %v", err)
+	}
+
+	var aliases []string
+	if err := s.db.Model(&GormPrivateKey{}).Pluck("DISTINCT(passphrase_alias)", &aliases).Error; err != nil {
+		return fmt.Errorf("unable to list passphrase aliases: %v", err)
+	}
+	aliases = append(aliases, s.defaultPassAlias)
+	for _, alias := range aliases {
+		if _, _, err := s.retriever("", alias, false, 0); err != nil {
+			return fmt.Errorf("unable to resolve passphrase alias %s: %v", alias, err)
+		}
+	}
+	return nil
+}
+
 // RotateKeyPassphrase rotates the key-encryption-key
 func (s *KeyDBStore) RotateKeyPassphrase(name, newPassphraseAlias string) error {
 	// Retrieve the GORM private key from the database
@@ -2,15 +2,28 @@ package signer
 
 import (
 	"net"
+	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/docker/notary/pkg/metrics"
 	pb "github.com/docker/notary/proto"
 	"github.com/endophage/gotuf/data"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 )
 
+// healthCheckTimeout bounds how long CheckHealth waits on the signer
+const healthCheckTimeout = 5 * time.Second
+
+var rpcLatency = metrics.NewHistogramVec(
+	"notary_server_signer_rpc_duration_seconds",
+	"Latency of RPC calls made to the notary-signer, partitioned by method.",
+	nil,
+	"method",
+)
+
 // NotarySigner implements a RPC based Trust service that calls the Notary-signer Service
 type NotarySigner struct {
 	kmClient pb.KeyManagementClient
@@ -48,7 +61,9 @@ func (trust *NotarySigner) Sign(keyIDs []string, toSign []byte) ([]data.Signatur
 			Content: toSign,
 			KeyID:   &keyID,
 		}
+		start := time.Now()
 		sig, err := trust.sClient.Sign(context.Background(), sr)
+		rpcLatency.ObserveSince(start, "Sign")
 		if err != nil {
 			return nil, err
 		}
@@ -63,6 +78,7 @@ func (trust *NotarySigner) Sign(keyIDs []string, toSign []byte) ([]data.Signatur
 
 // Create creates a remote key and returns the PublicKey associated with the remote private key
 func (trust *NotarySigner) Create(role string, algorithm data.KeyAlgorithm) (data.PublicKey, error) {
+	defer rpcLatency.ObserveSince(time.Now(), "CreateKey")
 	publicKey, err := trust.kmClient.CreateKey(context.Background(), &pb.Algorithm{Algorithm: algorithm.String()})
 	if err != nil {
 		return nil, err
@@ -73,15 +89,30 @@ func (trust *NotarySigner) Create(role string, algorithm data.KeyAlgorithm) (dat
 
 // RemoveKey deletes a key
 func (trust *NotarySigner) RemoveKey(keyid string) error {
+	defer rpcLatency.ObserveSince(time.Now(), "DeleteKey")
 	_, err := trust.kmClient.DeleteKey(context.Background(), &pb.KeyID{ID: keyid})
 	return err
 }
 
 // GetKey retrieves a key
 func (trust *NotarySigner) GetKey(keyid string) data.PublicKey {
+	defer rpcLatency.ObserveSince(time.Now(), "GetKeyInfo")
 	publicKey, err := trust.kmClient.GetKeyInfo(context.Background(), &pb.KeyID{ID: keyid})
 	if err != nil {
 		return nil
 	}
 	return data.NewPublicKey(data.KeyAlgorithm(publicKey.KeyInfo.Algorithm.Algorithm), publicKey.PublicKey)
 }
+
+// CheckHealth verifies the remote signer can be reached. It requests a key
+// that cannot exist, so any response other than NotFound is treated as a
+// failure.
+func (trust *NotarySigner) CheckHealth() error {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	_, err := trust.kmClient.GetKeyInfo(ctx, &pb.KeyID{ID: "health-check"})
+	if err == nil || grpc.Code(err) == codes.NotFound {
+		return nil
+	}
+	return err
+}
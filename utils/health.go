@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/distribution/health"
+	"golang.org/x/net/context"
+)
+
+// CheckStatus is the result of a single named health check
+type CheckStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthStatus is the JSON document returned by a HealthChecks handler
+type HealthStatus struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckStatus `json:"checks"`
+}
+
+// Values used for the Status fields of CheckStatus and HealthStatus
+const (
+	HealthOK    = "ok"
+	HealthError = "error"
+)
+
+// HealthChecks is a named set of health checks that can be served over HTTP.
+// It responds with a 200 if all checks pass and a 503 otherwise, so it can
+// be used directly by load balancers.
+type HealthChecks struct {
+	lock   sync.Mutex
+	checks map[string]health.Checker
+}
+
+// NewHealthChecks instantiates an empty HealthChecks
+func NewHealthChecks() *HealthChecks {
+	return &HealthChecks{
+		checks: make(map[string]health.Checker),
+	}
+}
+
+// Register associates the checker with the provided name, replacing
+// any existing check of the same name.
+func (hc *HealthChecks) Register(name string, check health.Checker) {
+	hc.lock.Lock()
+	defer hc.lock.Unlock()
+	hc.checks[name] = check
+}
+
+// RegisterFunc registers an arbitrary func() error as a checker
+func (hc *HealthChecks) RegisterFunc(name string, check func() error) {
+	hc.Register(name, health.CheckFunc(check))
+}
+
+// RegisterPeriodicFunc registers a func() error that is run every period
+// until ctx is done, rather than on every request. Requests are answered
+// with the result of the latest run.
+func (hc *HealthChecks) RegisterPeriodicFunc(ctx context.Context, name string, check func() error, period time.Duration) {
+	hc.Register(name, PeriodicChecker(ctx, health.CheckFunc(check), period))
+}
+
+// Status runs all the registered checks and returns their results
+func (hc *HealthChecks) Status() HealthStatus {
+	hc.lock.Lock()
+	names := make([]string, 0, len(hc.checks))
+	for name := range hc.checks {
+		names = append(names, name)
+	}
+	checks := make(map[string]health.Checker, len(hc.checks))
+	for name, check := range hc.checks {
+		checks[name] = check
+	}
+	hc.lock.Unlock()
+	sort.Strings(names)
+
+	status := HealthStatus{
+		Status: HealthOK,
+		Checks: make(map[string]CheckStatus, len(names)),
+	}
+	for _, name := range names {
+		if err := checks[name].Check(); err != nil {
+			logrus.Debugf("health check %s failed: %v", name, err)
+			status.Status = HealthError
+			status.Checks[name] = CheckStatus{Status: HealthError, Error: err.Error()}
+			continue
+		}
+		status.Checks[name] = CheckStatus{Status: HealthOK}
+	}
+	return status
+}
+
+// ServeHTTP implements http.Handler, writing the status of every check as JSON
+func (hc *HealthChecks) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := hc.Status()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if status.Status != HealthOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		logrus.Error("failed to encode health status: ", err)
+	}
+}
+
+// PeriodicChecker runs check once before returning, then every period until
+// ctx is done, and reports the result of the latest run. Unlike
+// health.PeriodicChecker, it is never healthy before the check has run and
+// its goroutine can be stopped.
+func PeriodicChecker(ctx context.Context, check health.Checker, period time.Duration) health.Checker {
+	u := health.NewStatusUpdater()
+	u.Update(check.Check())
+	go func() {
+		t := time.NewTicker(period)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				u.Update(check.Check())
+			}
+		}
+	}()
+	return u
+}
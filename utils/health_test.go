@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/health"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestHealthChecksAllPassing(t *testing.T) {
+	checks := NewHealthChecks()
+	checks.RegisterFunc("a", func() error { return nil })
+	checks.RegisterFunc("b", func() error { return nil })
+
+	ts := httptest.NewServer(checks)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var status HealthStatus
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&status))
+	assert.Equal(t, HealthOK, status.Status)
+	assert.Equal(t, CheckStatus{Status: HealthOK}, status.Checks["a"])
+	assert.Equal(t, CheckStatus{Status: HealthOK}, status.Checks["b"])
+}
+
+func TestHealthChecksFailing(t *testing.T) {
+	checks := NewHealthChecks()
+	checks.RegisterFunc("a", func() error { return nil })
+	checks.RegisterFunc("b", func() error { return errors.New("unreachable") })
+
+	ts := httptest.NewServer(checks)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+
+	var status HealthStatus
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&status))
+	assert.Equal(t, HealthError, status.Status)
+	assert.Equal(t, CheckStatus{Status: HealthOK}, status.Checks["a"])
+	assert.Equal(t, CheckStatus{Status: HealthError, Error: "unreachable"}, status.Checks["b"])
+}
+
+func TestPeriodicChecker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runs := make(chan struct{}, 10)
+	checker := PeriodicChecker(ctx, health.CheckFunc(func() error {
+		runs <- struct{}{}
+		return errors.New("unhealthy")
+	}), time.Millisecond)
+
+	// the first run happens before PeriodicChecker returns
+	assert.Error(t, checker.Check())
+	<-runs
+	<-runs
+
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	for len(runs) > 0 {
+		<-runs
+	}
+	time.Sleep(10 * time.Millisecond)
+	assert.Len(t, runs, 0, "the check should stop running once the context is done")
+}
+
+func TestRegisterPeriodicFunc(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runs := 0
+	checks := NewHealthChecks()
+	checks.RegisterPeriodicFunc(ctx, "a", func() error {
+		runs++
+		return nil
+	}, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, HealthOK, checks.Status().Status)
+	}
+	assert.Equal(t, 1, runs, "requests should be answered with the result of the latest run")
+}
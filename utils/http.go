@@ -59,6 +59,12 @@ func (root *rootHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	if root.auth != nil {
+		if accessControlled(root.auth) {
+			// responses must not be stored by shared caches, and handlers
+			// serving several GUNs check access to each of them
+			ctx = context.WithValue(ctx, "accessControlled", true)
+			ctx = context.WithValue(ctx, "accessController", root.auth)
+		}
 		var err error
 		access := buildAccessRecords(vars["imageName"], root.actions...)
 		if ctx, err = root.auth.Authorized(ctx, access...); err != nil {
@@ -67,6 +73,11 @@ func (root *rootHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusUnauthorized)
 				return
 			}
+			if _, ok := err.(errcode.ErrorCoder); ok {
+				// the user was authenticated but isn't allowed access
+				errcode.ServeJSON(w, err)
+				return
+			}
 			errcode.ServeJSON(w, v2.ErrorCodeUnauthorized)
 			return
 		}
@@ -80,6 +91,17 @@ func (root *rootHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// accessControlled reports whether ac authorizes requests. Controllers that
+// can have authentication switched off implement Enabled.
+func accessControlled(ac auth.AccessController) bool {
+	if e, ok := ac.(interface {
+		Enabled() bool
+	}); ok {
+		return e.Enabled()
+	}
+	return true
+}
+
 func buildAccessRecords(repo string, actions ...string) []auth.Access {
 	requiredAccess := make([]auth.Access, 0, len(actions))
 	for _, action := range actions {
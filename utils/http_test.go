@@ -4,9 +4,11 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 
+	"github.com/docker/distribution/registry/auth"
 	"github.com/endophage/gotuf/signed"
 	"golang.org/x/net/context"
 
@@ -76,3 +78,29 @@ func TestRootHandlerError(t *testing.T) {
 		t.Fatalf("Error Body Incorrect: `%s`", content)
 	}
 }
+
+// toggleController authorizes everything, reporting whether it is enabled
+type toggleController bool
+
+func (c toggleController) Authorized(ctx context.Context, access ...auth.Access) (context.Context, error) {
+	return ctx, nil
+}
+
+func (c toggleController) Enabled() bool {
+	return bool(c)
+}
+
+func TestRootHandlerAccessControlled(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		var controlled bool
+		hand := RootHandlerFactory(toggleController(enabled), context.Background(), &signed.Ed25519{})
+		handler := hand(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			controlled, _ = ctx.Value("accessControlled").(bool)
+			return nil
+		}, "pull")
+		handler.ServeHTTP(httptest.NewRecorder(), &http.Request{Method: "GET", URL: &url.URL{Path: "/"}})
+		if controlled != enabled {
+			t.Fatalf("Expected accessControlled to be %v", enabled)
+		}
+	}
+}
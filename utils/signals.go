@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// OnSIGHUP calls fn every time the process receives SIGHUP
+func OnSIGHUP(fn func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	go func() {
+		for range c {
+			fn()
+		}
+	}()
+}
@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// DefaultCipherSuites are the cipher suites servers accept when none are
+// configured: only forward secret AEAD suites
+var DefaultCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// cipherSuites maps the names cipher suites are configured with to their
+// values. RC4 and 3DES suites are deliberately not available. The CBC and
+// RSA key exchange suites are only kept for old clients, and a warning is
+// logged when they are configured.
+var cipherSuites = map[string]uint16{
+	"TLS_RSA_WITH_AES_128_CBC_SHA":            tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_RSA_WITH_AES_256_CBC_SHA":            tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":    tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":      tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+}
+
+// weakTLSVersions are the versions a warning is logged for if they are
+// configured as the minimum
+var weakTLSVersions = map[uint16]bool{
+	tls.VersionTLS10: true,
+	tls.VersionTLS11: true,
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify_if_given":    tls.VerifyClientCertIfGiven,
+	"require_and_verify": tls.RequireAndVerifyClientCert,
+}
+
+// ServerTLSOpts describes the TLS configuration of a server. Empty fields
+// take secure defaults: TLS 1.2, DefaultCipherSuites, and if a client CA
+// is given, verifying client certificates when they are presented.
+type ServerTLSOpts struct {
+	ServerCertFile string
+	ServerKeyFile  string
+	ClientCAFile   string
+	// ClientAuth is one of "none", "request", "require", "verify_if_given"
+	// or "require_and_verify"
+	ClientAuth string
+	// MinVersion is one of "1.0", "1.1" or "1.2"
+	MinVersion   string
+	CipherSuites []string
+}
+
+// ConfigureServerTLS builds a tls.Config from opts. The certificate is
+// served by the returned CertificateReloader, so it can be replaced on
+// disk and reloaded without restarting the server.
+func ConfigureServerTLS(opts *ServerTLSOpts) (*tls.Config, *CertificateReloader, error) {
+	reloader, err := NewCertificateReloader(opts.ServerCertFile, opts.ServerKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:               tls.VersionTLS12,
+		PreferServerCipherSuites: true,
+		CipherSuites:             DefaultCipherSuites,
+		GetCertificate:           reloader.GetCertificate,
+		Rand:                     rand.Reader,
+	}
+
+	if opts.MinVersion != "" {
+		version, ok := tlsVersions[opts.MinVersion]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown TLS version %q", opts.MinVersion)
+		}
+		if weakTLSVersions[version] {
+			logrus.Warnf("TLS %s is configured as the minimum version; it is insecure and should only be allowed for old clients", opts.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if len(opts.CipherSuites) > 0 {
+		tlsConfig.CipherSuites = make([]uint16, 0, len(opts.CipherSuites))
+		for _, name := range opts.CipherSuites {
+			suite, ok := cipherSuites[strings.ToUpper(name)]
+			if !ok {
+				return nil, nil, fmt.Errorf("unknown or unsupported cipher suite %q", name)
+			}
+			if !isDefaultCipherSuite(suite) {
+				logrus.Warnf("cipher suite %s is not forward secret or not AEAD; it should only be allowed for old clients", strings.ToUpper(name))
+			}
+			tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, suite)
+		}
+	}
+
+	if opts.ClientCAFile != "" {
+		pemBytes, err := ioutil.ReadFile(opts.ClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(pemBytes) {
+			return nil, nil, fmt.Errorf("no certificates found in %s", opts.ClientCAFile)
+		}
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	if opts.ClientAuth != "" {
+		clientAuth, ok := clientAuthTypes[opts.ClientAuth]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown client auth mode %q", opts.ClientAuth)
+		}
+		if clientAuth >= tls.VerifyClientCertIfGiven && tlsConfig.ClientCAs == nil {
+			return nil, nil, fmt.Errorf("client auth mode %q requires a client CA", opts.ClientAuth)
+		}
+		tlsConfig.ClientAuth = clientAuth
+	}
+	return tlsConfig, reloader, nil
+}
+
+func isDefaultCipherSuite(suite uint16) bool {
+	for _, s := range DefaultCipherSuites {
+		if s == suite {
+			return true
+		}
+	}
+	return false
+}
+
+// CertificateReloader serves a certificate and key loaded from disk, which
+// are reread when Reload is called
+type CertificateReloader struct {
+	certFile string
+	keyFile  string
+
+	lock sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewCertificateReloader loads a certificate and key
+func NewCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	r := &CertificateReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload rereads the certificate and key. If they can't be loaded the
+// previous certificate continues to be served.
+func (r *CertificateReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.lock.Lock()
+	r.cert = &cert
+	r.lock.Unlock()
+	logrus.Infof("loaded TLS certificate from %s", r.certFile)
+	return nil
+}
+
+// GetCertificate can be used as tls.Config's GetCertificate
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cert, nil
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/tls"
+	"os"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testCertFile = "../fixtures/notary-server.crt"
+	testKeyFile  = "../fixtures/notary-server.key"
+	testCAFile   = "../fixtures/root-ca.crt"
+)
+
+func TestConfigureServerTLSDefaults(t *testing.T) {
+	config, reloader, err := ConfigureServerTLS(&ServerTLSOpts{
+		ServerCertFile: testCertFile,
+		ServerKeyFile:  testKeyFile,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+	assert.Equal(t, DefaultCipherSuites, config.CipherSuites)
+	assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+
+	cert, err := config.GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, cert)
+	assert.NoError(t, reloader.Reload())
+}
+
+func TestConfigureServerTLSOptions(t *testing.T) {
+	config, _, err := ConfigureServerTLS(&ServerTLSOpts{
+		ServerCertFile: testCertFile,
+		ServerKeyFile:  testKeyFile,
+		ClientCAFile:   testCAFile,
+		ClientAuth:     "require_and_verify",
+		MinVersion:     "1.1",
+		CipherSuites:   []string{"tls_ecdhe_rsa_with_aes_128_gcm_sha256"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS11), config.MinVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, config.CipherSuites)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+	assert.NotNil(t, config.ClientCAs)
+}
+
+func TestConfigureServerTLSWarnsOfWeakOptions(t *testing.T) {
+	var buf bytes.Buffer
+	logrus.SetOutput(&buf)
+	defer logrus.SetOutput(os.Stderr)
+
+	_, _, err := ConfigureServerTLS(&ServerTLSOpts{
+		ServerCertFile: testCertFile,
+		ServerKeyFile:  testKeyFile,
+		CipherSuites:   []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+	})
+	assert.NoError(t, err)
+	assert.NotContains(t, buf.String(), "level=warning")
+
+	_, _, err = ConfigureServerTLS(&ServerTLSOpts{
+		ServerCertFile: testCertFile,
+		ServerKeyFile:  testKeyFile,
+		MinVersion:     "1.0",
+		CipherSuites:   []string{"TLS_RSA_WITH_AES_128_CBC_SHA", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "TLS 1.0 is configured as the minimum version")
+	assert.Contains(t, buf.String(), "cipher suite TLS_RSA_WITH_AES_128_CBC_SHA")
+	assert.NotContains(t, buf.String(), "cipher suite TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
+}
+
+func TestConfigureServerTLSInvalid(t *testing.T) {
+	for _, opts := range []ServerTLSOpts{
+		{MinVersion: "1.3"},
+		{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		{ClientAuth: "sometimes"},
+		{ClientAuth: "require_and_verify"},
+	} {
+		opts.ServerCertFile = testCertFile
+		opts.ServerKeyFile = testKeyFile
+		_, _, err := ConfigureServerTLS(&opts)
+		assert.Error(t, err)
+	}
+}
+
+func TestCertificateReloaderKeepsCertOnFailure(t *testing.T) {
+	r, err := NewCertificateReloader(testCertFile, testKeyFile)
+	assert.NoError(t, err)
+	before, _ := r.GetCertificate(nil)
+
+	r.keyFile = "missing.key"
+	assert.Error(t, r.Reload())
+	after, _ := r.GetCertificate(nil)
+	assert.Equal(t, before, after)
+}